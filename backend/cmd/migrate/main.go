@@ -0,0 +1,169 @@
+// migrate 管理数据库迁移，连接配置与服务相同（DB_* 环境变量）。
+// 默认使用编译进二进制的迁移文件，-dir 或 MIGRATIONS_DIR 可指定读取的目录。
+//
+//	migrate [-dir DIR] up             执行全部待执行的迁移
+//	migrate [-dir DIR] down N         回滚最近执行的 N 个迁移
+//	migrate [-dir DIR] status         列出迁移及其执行状态
+//	migrate [-dir DIR] redo           回滚最近执行的迁移并重新执行
+//	migrate [-dir DIR] create <name>  创建下一个版本号的 .up.sql 和 .down.sql（默认在源码目录中）
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"prompt-backend/internal/database"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const usage = `Usage: migrate [-dir DIR] <command>
+
+Commands:
+  up             apply all pending migrations
+  down N         roll back the last N applied migrations
+  status         show applied and pending migrations
+  redo           roll back the last applied migration and apply it again
+  create NAME    create NNN_NAME.up.sql and NNN_NAME.down.sql
+
+Options:
+`
+
+func main() {
+	log.SetFlags(0)
+	dir := flag.String("dir", "", "read migration files from this directory instead of the embedded ones (default $MIGRATIONS_DIR; create defaults to "+database.MigrationSourceDir+")")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*dir, args[0], args[1:]); err != nil {
+		if errors.Is(err, errUnknownCommand) {
+			flag.Usage()
+		}
+		log.Fatalf("migrate %s: %v", args[0], err)
+	}
+}
+
+var errUnknownCommand = errors.New("unknown command")
+
+func run(dir, command string, args []string) error {
+	// create 只写文件，不需要连接数据库
+	if command == "create" {
+		if len(args) != 1 {
+			return fmt.Errorf("expected a migration name")
+		}
+		up, down, err := database.CreateMigration(dir, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\nCreated %s\n", up, down)
+		return nil
+	}
+
+	steps, err := parseArgs(command, args)
+	if err != nil {
+		return err
+	}
+
+	m, err := newMigrator(dir)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		_, err = m.Up()
+	case "down":
+		var n int
+		n, err = m.Down(steps)
+		if err == nil {
+			log.Printf("Rolled back %d migration(s)", n)
+		}
+	case "redo":
+		err = m.Redo()
+	case "status":
+		var statuses []database.MigrationStatus
+		if statuses, err = m.Status(); err == nil {
+			err = printStatus(os.Stdout, statuses)
+		}
+	}
+	return err
+}
+
+// parseArgs 校验需要连接数据库的命令的参数，返回 down 回滚的迁移数
+func parseArgs(command string, args []string) (int, error) {
+	switch command {
+	case "up", "status", "redo":
+		if len(args) != 0 {
+			return 0, fmt.Errorf("unexpected arguments %v", args)
+		}
+		return 0, nil
+	case "down":
+		if len(args) != 1 {
+			return 0, fmt.Errorf("expected the number of migrations to roll back")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid number of migrations %q", args[0])
+		}
+		return n, nil
+	default:
+		return 0, errUnknownCommand
+	}
+}
+
+// newMigrator 按 DB_* 环境变量连接数据库
+func newMigrator(dir string) (*database.Migrator, error) {
+	if err := database.Init(database.GetConfigFromEnv()); err != nil {
+		return nil, err
+	}
+	// 只输出警告，避免逐条打印迁移 SQL
+	db := database.GetDB().Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Warn)})
+	return database.NewMigrator(db, dir)
+}
+
+func printStatus(out io.Writer, statuses []database.MigrationStatus) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tROLLBACK")
+	pending := 0
+	for _, s := range statuses {
+		state, appliedAt, rollback := "pending", "-", "yes"
+		if s.Applied {
+			state = "applied"
+			appliedAt = s.AppliedAt.Local().Format(time.DateTime)
+		} else {
+			pending++
+		}
+		switch {
+		case s.Missing:
+			state, rollback = "missing file", "-"
+		case s.Modified:
+			state = "modified"
+		}
+		if !s.Reversible && !s.Missing {
+			rollback = "no"
+		}
+		fmt.Fprintf(w, "%03d\t%s\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt, rollback)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "\n%d migration(s), %d pending\n", len(statuses), pending)
+	return err
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"prompt-backend/internal/database"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		command   string
+		args      []string
+		wantSteps int
+		errPart   string
+	}{
+		{"up", "up", nil, 0, ""},
+		{"status", "status", nil, 0, ""},
+		{"redo", "redo", nil, 0, ""},
+		{"down", "down", []string{"2"}, 2, ""},
+		{"up with arguments", "up", []string{"1"}, 0, "unexpected arguments"},
+		{"redo with arguments", "redo", []string{"2"}, 0, "unexpected arguments"},
+		{"down without count", "down", nil, 0, "expected the number of migrations"},
+		{"down with two counts", "down", []string{"1", "2"}, 0, "expected the number of migrations"},
+		{"down zero", "down", []string{"0"}, 0, `invalid number of migrations "0"`},
+		{"down negative", "down", []string{"-1"}, 0, "invalid number of migrations"},
+		{"down all", "down", []string{"all"}, 0, "invalid number of migrations"},
+		{"unknown", "migrate", nil, 0, "unknown command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := parseArgs(tt.command, tt.args)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil || steps != tt.wantSteps {
+				t.Fatalf("parseArgs = %d, %v, want %d", steps, err, tt.wantSteps)
+			}
+		})
+	}
+	if _, err := parseArgs("nope", nil); !errors.Is(err, errUnknownCommand) {
+		t.Errorf("unknown command: err = %v, want errUnknownCommand", err)
+	}
+}
+
+func TestRunCreate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "001_init.up.sql"), []byte("SELECT 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string // 期望创建的文件名前缀
+		errPart string
+	}{
+		{"next version", []string{"Add Users"}, "002_add_users", ""},
+		{"after the previous one", []string{"index-emails"}, "003_index_emails", ""},
+		{"missing name", nil, "", "expected a migration name"},
+		{"extra arguments", []string{"a", "b"}, "", "expected a migration name"},
+		{"name without letters", []string{"--"}, "", "must contain letters or digits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// create 不连接数据库，未设置 DB_* 时也能执行
+			err := run(dir, "create", tt.args)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("create: %v", err)
+			}
+			for _, suffix := range []string{".up.sql", ".down.sql"} {
+				if _, err := os.Stat(filepath.Join(dir, tt.want+suffix)); err != nil {
+					t.Errorf("missing %s%s: %v", tt.want, suffix, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	var out bytes.Buffer
+	err := printStatus(&out, []database.MigrationStatus{
+		{Version: 1, Name: "001_init", Applied: true, AppliedAt: &appliedAt, Reversible: true},
+		{Version: 2, Name: "002_seed", Applied: true, AppliedAt: &appliedAt, Modified: true},
+		{Version: 3, Name: "003_next", Reversible: true},
+		{Version: 6, Name: "006_removed", Applied: true, AppliedAt: &appliedAt, Missing: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	want := [][]string{
+		{"VERSION", "NAME", "STATUS", "APPLIED", "AT", "ROLLBACK"},
+		{"001", "001_init", "applied", "2026-01-02", "03:04:05", "yes"},
+		{"002", "002_seed", "modified", "2026-01-02", "03:04:05", "no"},
+		{"003", "003_next", "pending", "-", "yes"},
+		{"006", "006_removed", "missing", "file", "2026-01-02", "03:04:05", "-"},
+	}
+	if len(lines) != len(want)+2 {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	for i, fields := range want {
+		if got := strings.Fields(lines[i]); strings.Join(got, " ") != strings.Join(fields, " ") {
+			t.Errorf("line %d = %q, want fields %q", i, lines[i], fields)
+		}
+	}
+	if last := lines[len(lines)-1]; last != "4 migration(s), 1 pending" {
+		t.Errorf("summary = %q", last)
+	}
+}
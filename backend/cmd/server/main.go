@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"prompt-backend/internal/auth"
 	"prompt-backend/internal/database"
 	"prompt-backend/internal/handlers"
+	"prompt-backend/internal/llm"
 	"prompt-backend/internal/middleware"
 	"prompt-backend/internal/services"
 	"prompt-backend/internal/services/repository"
@@ -13,6 +21,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// shutdownTimeout 优雅关闭时等待处理中请求结束的最长时间
+	shutdownTimeout = 30 * time.Second
+	// usageDrainTimeout 关闭时写入剩余使用次数的最长时间
+	usageDrainTimeout = 10 * time.Second
+)
+
 func main() {
 	// 从环境变量获取配置
 	config := database.GetConfigFromEnv()
@@ -22,9 +37,17 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// 执行数据库迁移
-	if err := database.RunMigrations(database.GetDB()); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	// 执行数据库迁移（MIGRATE_ON_START=false 时由 cmd/migrate 单独执行）
+	migrateOnStart, err := database.MigrateOnStartFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load migration config: %v", err)
+	}
+	if migrateOnStart {
+		if err := database.RunMigrations(database.GetDB()); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+	} else {
+		log.Println("MIGRATE_ON_START=false, skipping migrations")
 	}
 
 	// 如果是开发环境，插入一些示例数据（可选，因为迁移文件中已包含）
@@ -33,14 +56,52 @@ func main() {
 		log.Println("Development environment detected - migrations include sample data")
 	}
 
+	// 初始化令牌签发
+	tokenManager, err := auth.NewTokenManagerFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize auth: %v", err)
+	}
+
+	// 初始化模型服务（未配置时 /api/run 返回 503）
+	provider, err := llm.NewProviderFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize llm provider: %v", err)
+	}
+
 	// 创建仓库和服务
 	db := database.GetDB()
 	templateRepo := repository.NewTemplateRepository(db)
-	templateService := services.NewTemplateService(templateRepo)
+	userRepo := repository.NewUserRepository(db)
+	apiKeyRepo := repository.NewAPIKeyRepository(db)
+	runRepo := repository.NewGenerationRunRepository(db)
+	statsRepo := repository.NewUsageStatsRepository(db)
+	usageFlushInterval, err := services.UsageFlushIntervalFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load usage recorder config: %v", err)
+	}
+	usageRecorder := services.NewUsageRecorder(templateRepo, usageFlushInterval)
+	usageRecorder.Start()
+	templateService := services.NewTemplateService(templateRepo, runRepo, statsRepo, usageRecorder)
+	authService := services.NewAuthService(userRepo, apiKeyRepo, tokenManager)
+	runService := services.NewRunService(templateService, provider, llm.AllowedModelsFromEnv())
+
+	// 收到 SIGINT/SIGTERM 时 ctx 结束，开始优雅关闭
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 定期清理过期的生成记录
+	runRetention, err := services.RunRetentionFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load run retention: %v", err)
+	}
+	templateService.StartRunRetention(ctx, runRetention)
 
 	// 创建处理器
 	templateHandler := handlers.NewTemplateHandler(templateService)
+	authHandler := handlers.NewAuthHandler(authService)
+	runHandler := handlers.NewRunHandler(runService)
 	healthHandler := handlers.NewHealthHandler()
+	metricsHandler := handlers.NewMetricsHandler(usageRecorder)
 
 	// 创建 Gin 路由
 	router := gin.Default()
@@ -48,35 +109,78 @@ func main() {
 		log.Fatalf("Failed to set trusted proxies: %v", err)
 	}
 
-	// 安全与稳健性中间件
+	// 安全与稳健性中间件（数据集上传单独使用更大的请求体上限）
+	const datasetPath = "/api/generate/dataset"
 	router.Use(middleware.SecurityHeaders())
 	router.Use(middleware.CORSFromEnv())
-	router.Use(middleware.RequestSizeLimitFromEnv())
+	router.Use(middleware.RequestSizeLimitFromEnv(datasetPath))
 	router.Use(middleware.RateLimitFromEnv())
 
+	requireAuth := middleware.Auth(authService)
+	optionalAuth := middleware.OptionalAuth(authService)
+	requireAdmin := middleware.RequireAdmin()
+
 	// 路由组
 	api := router.Group("/api")
 	{
 		// 健康检查
 		api.GET("/health", healthHandler.Check)
 
+		// 内部运行指标（仅管理员）
+		api.GET("/metrics/usage-recorder", requireAuth, requireAdmin, metricsHandler.UsageRecorder)
+
+		// 认证相关路由
+		authGroup := api.Group("/auth")
+		{
+			authGroup.POST("/register", authHandler.Register)
+			authGroup.POST("/login", authHandler.Login)
+			authGroup.GET("/me", requireAuth, authHandler.Me)
+			authGroup.GET("/api-keys", requireAuth, authHandler.ListAPIKeys)
+			authGroup.POST("/api-keys", requireAuth, authHandler.CreateAPIKey)
+			authGroup.DELETE("/api-keys/:id", requireAuth, authHandler.DeleteAPIKey)
+		}
+
 		// 模板相关路由
 		templates := api.Group("/templates")
 		{
-			templates.POST("", templateHandler.CreateTemplate)
-			templates.GET("", templateHandler.GetTemplates)
+			templates.POST("", requireAuth, templateHandler.CreateTemplate)
+			templates.GET("", optionalAuth, templateHandler.GetTemplates)
+			templates.GET("/mine", requireAuth, templateHandler.GetMyTemplates)
 			templates.GET("/public", templateHandler.GetPublicTemplates)
-			templates.GET("/:id", templateHandler.GetTemplate)
-			templates.PUT("/:id", templateHandler.UpdateTemplate)
-			templates.DELETE("/:id", templateHandler.DeleteTemplate)
+			templates.GET("/search", optionalAuth, templateHandler.SearchTemplates)
+			templates.GET("/diff", optionalAuth, templateHandler.DiffTemplates)
+			templates.POST("/diff", requireAuth, templateHandler.PreviewTemplateDiff)
+			templates.GET("/:id", optionalAuth, templateHandler.GetTemplate)
+			templates.PUT("/:id", requireAuth, templateHandler.UpdateTemplate)
+			templates.DELETE("/:id", requireAuth, templateHandler.DeleteTemplate)
+			templates.GET("/:id/versions", optionalAuth, templateHandler.GetTemplateVersions)
+			templates.GET("/:id/versions/:n", optionalAuth, templateHandler.GetTemplateVersion)
+			templates.POST("/:id/versions/:n/restore", requireAuth, templateHandler.RestoreTemplateVersion)
+			templates.GET("/:id/runs", requireAuth, templateHandler.GetTemplateRuns)
+			templates.GET("/:id/stats", requireAuth, templateHandler.GetTemplateStats)
 		}
 
+		// 生成记录
+		api.GET("/runs/:id", requireAuth, templateHandler.GetRun)
+
+		// 使用统计
+		api.GET("/stats/top", optionalAuth, templateHandler.GetTopTemplates)
+
+		// 标签
+		api.GET("/tags", optionalAuth, templateHandler.GetTags)
+
 		// 生成相关路由
 		generate := api.Group("/generate")
 		{
-			generate.POST("", templateHandler.Generate)
-			generate.POST("/extract-variables", templateHandler.ExtractVariables)
+			generate.POST("", optionalAuth, templateHandler.Generate)
+			generate.POST("/batch", optionalAuth, templateHandler.BatchGenerate)
+			generate.POST("/dataset", optionalAuth, middleware.DatasetSizeLimitFromEnv(), templateHandler.GenerateDataset)
+			generate.POST("/extract-variables", optionalAuth, templateHandler.ExtractVariables)
 		}
+
+		// 运行模板（调用模型会产生费用，需要登录）
+		api.POST("/run", requireAuth, runHandler.Run)
+		api.POST("/run/stream", requireAuth, runHandler.RunStream)
 	}
 
 	// 启动服务器
@@ -84,8 +188,35 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
-	log.Printf("Server starting on port %s...", port)
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Printf("Server starting on port %s...", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Shutting down server...")
+
+	// 先停止接收请求并等待处理中的请求结束，再写入剩余的使用次数
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown did not complete, closing connections: %v", err)
+		server.Close()
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), usageDrainTimeout)
+	defer cancelDrain()
+	if err := usageRecorder.Close(drainCtx); err != nil {
+		metrics := usageRecorder.Metrics()
+		log.Printf("Failed to flush usage counts, %d increments lost: %v", metrics.PendingIncrements, err)
 	}
+	log.Println("Server stopped")
 }
@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// APIKeyPrefix API 密钥的固定前缀，便于识别和扫描泄露的密钥
+const APIKeyPrefix = "pk_"
+
+const apiKeyRandomBytes = 32
+
+// GenerateAPIKey 生成新的 API 密钥明文
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, apiKeyRandomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIKey 计算 API 密钥的哈希，数据库中只保存哈希
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey 判断凭证是否为 API 密钥格式
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
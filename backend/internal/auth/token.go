@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTokenTTL = 24 * time.Hour
+	tokenIssuer     = "prompt-template-api"
+	minSecretLen    = 32
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Identity 已认证的调用方身份
+type Identity struct {
+	UserID uuid.UUID
+	Role   string
+}
+
+// IsAdmin 是否为管理员
+func (i *Identity) IsAdmin() bool {
+	return i != nil && i.Role == "admin"
+}
+
+// Claims JWT 声明
+type Claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenManager 负责签发和校验 HMAC 签名的 JWT
+type TokenManager struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewTokenManager 创建令牌管理器
+func NewTokenManager(secret []byte, ttl time.Duration) *TokenManager {
+	if ttl <= 0 {
+		ttl = defaultTokenTTL
+	}
+	return &TokenManager{secret: secret, ttl: ttl}
+}
+
+// NewTokenManagerFromEnv 从环境变量创建令牌管理器。
+// 生产环境必须配置 JWT_SECRET；开发环境未配置时生成随机密钥（重启后已签发的令牌失效）。
+func NewTokenManagerFromEnv() (*TokenManager, error) {
+	ttl := defaultTokenTTL
+	if value := strings.TrimSpace(os.Getenv("JWT_TTL")); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWT_TTL: %w", err)
+		}
+		ttl = parsed
+	}
+
+	secret := []byte(os.Getenv("JWT_SECRET"))
+	if len(secret) == 0 {
+		if os.Getenv("ENV") != "development" {
+			return nil, errors.New("JWT_SECRET is required")
+		}
+		secret = make([]byte, minSecretLen)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate JWT secret: %w", err)
+		}
+		log.Println("JWT_SECRET not set, using a random secret for development")
+	}
+	if len(secret) < minSecretLen {
+		return nil, fmt.Errorf("JWT_SECRET too short (min %d bytes)", minSecretLen)
+	}
+
+	return NewTokenManager(secret, ttl), nil
+}
+
+// Issue 为指定身份签发令牌
+func (m *TokenManager) Issue(identity Identity) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(m.ttl)
+	claims := Claims{
+		Role: identity.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   identity.UserID.String(),
+			Issuer:    tokenIssuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(m.secret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// Parse 校验令牌并返回其中的身份
+func (m *TokenManager) Parse(tokenString string) (*Identity, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return m.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return &Identity{UserID: userID, Role: claims.Role}, nil
+}
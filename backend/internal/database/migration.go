@@ -1,76 +1,529 @@
 package database
 
 import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
-// RunMigrations 执行数据库迁移
+// migrationLockKey 执行迁移时持有的 PostgreSQL advisory lock 的键，
+// 多个实例同时启动时只有一个在执行迁移，其余等待其完成后再检查
+const migrationLockKey int64 = 7_305_001
+
+// MigrationSourceDir 迁移文件在源码中的目录（相对于 backend），migrate create 默认在此创建文件
+const MigrationSourceDir = "internal/database/migrations"
+
+// embeddedMigrations 编译进二进制的迁移文件
+//
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// migrationFilePattern 迁移文件名：NNN_name.up.sql / NNN_name.down.sql，
+// 或只有升级脚本、不可回滚的 NNN_name.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+?)(\.up|\.down)?\.sql$`)
+
+// migrationNameSeparator 新建迁移时替换名称中字母和数字以外的字符
+var migrationNameSeparator = regexp.MustCompile(`[^a-z0-9]+`)
+
+var ErrNoMigrations = errors.New("no migrations found")
+
+var ErrNoMigrationsApplied = errors.New("no migrations have been applied")
+
+// migration 一个迁移（升级脚本及可选的回滚脚本）
+type migration struct {
+	Version int64
+	// Name 为去掉 .up.sql / .sql 后缀的文件名，如 012_template_tags
+	Name string
+	SQL  string
+	// DownSQL 为回滚脚本，没有 .down.sql 文件时为空
+	DownSQL  string
+	HasDown  bool
+	Checksum string
+}
+
+// appliedMigration schema_migrations 中记录的已执行迁移
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+// MigrationStatus 迁移的执行状态
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt *time.Time
+	// Modified 为 true 表示已执行的升级脚本在执行后被修改（校验和不一致）
+	Modified bool
+	// Missing 为 true 表示已执行的迁移找不到对应的文件
+	Missing    bool
+	Reversible bool
+}
+
+// Migrator 按 schema_migrations 中的记录执行和回滚迁移。
+// 已执行的迁移记录版本号、名称、校验和与执行时间，每个迁移在独立的事务中执行或回滚，
+// 期间持有 advisory lock，避免多个进程同时迁移。
+type Migrator struct {
+	db         *gorm.DB
+	migrations []migration
+}
+
+// NewMigrator 读取迁移文件：dir 不为空时读取该目录，否则读取 MIGRATIONS_DIR 指定的目录，
+// 均未指定时使用编译进二进制的迁移文件。没有任何迁移文件时返回 ErrNoMigrations。
+func NewMigrator(db *gorm.DB, dir string) (*Migrator, error) {
+	fsys, source, err := migrationSource(dir)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNoMigrations, source)
+	}
+	log.Printf("Loaded %d migration(s) from %s", len(migrations), source)
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// RunMigrations 执行尚未执行的迁移（来源见 NewMigrator）。
+// 找不到迁移文件或已执行的升级脚本被修改（校验和不一致）时返回错误，拒绝启动。
 func RunMigrations(db *gorm.DB) error {
-	// 获取迁移文件目录
-	migrationDir := "migrations"
-	if _, err := os.Stat(migrationDir); os.IsNotExist(err) {
-		log.Println("No migrations directory found, skipping migrations")
-		return nil
+	m, err := NewMigrator(db, "")
+	if err != nil {
+		return err
 	}
+	_, err = m.Up()
+	return err
+}
 
-	// 获取所有SQL文件
-	var files []string
-	err := filepath.WalkDir(migrationDir, func(path string, d fs.DirEntry, err error) error {
+// migrationSource 返回迁移文件所在的文件系统及其描述。
+// 开发时可通过 MIGRATIONS_DIR 直接读取源码目录，修改 SQL 后无需重新编译。
+func migrationSource(dir string) (fs.FS, string, error) {
+	if dir == "" {
+		dir = os.Getenv("MIGRATIONS_DIR")
+	}
+	if dir == "" {
+		fsys, err := fs.Sub(embeddedMigrations, "migrations")
 		if err != nil {
+			return nil, "", err
+		}
+		return fsys, "embedded migrations", nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("migrations directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, "", fmt.Errorf("migrations directory %s is not a directory", dir)
+	}
+	return os.DirFS(dir), dir, nil
+}
+
+// MigrateOnStartFromEnv 读取 MIGRATE_ON_START，服务启动时是否自动执行迁移，默认为 true
+func MigrateOnStartFromEnv() (bool, error) {
+	value := os.Getenv("MIGRATE_ON_START")
+	if value == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid MIGRATE_ON_START %q: %w", value, err)
+	}
+	return enabled, nil
+}
+
+// Up 执行全部待执行的迁移，返回执行的个数
+func (m *Migrator) Up() (int, error) {
+	applied := 0
+	err := m.withLock(func(conn *gorm.DB, state *migrationState) error {
+		if err := state.verify(); err != nil {
 			return err
 		}
-		if !d.IsDir() && strings.HasSuffix(strings.ToLower(path), ".sql") {
-			files = append(files, path)
+		for _, mig := range m.migrations {
+			if _, ok := state.applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(conn, mig, state.legacy); err != nil {
+				return err
+			}
+			applied++
 		}
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to read migration files: %w", err)
-	}
-
-	// 按文件名排序
-	sort.Strings(files)
-
-	// 执行每个迁移文件
-	for _, file := range files {
-		// 对于包含 seed 的迁移文件，采用安全策略：
-		// 仅在目标表为空时执行，以避免每次服务重启时重新插入被删除的数据。
-		isSeed := strings.Contains(strings.ToLower(filepath.Base(file)), "seed")
-		if isSeed {
-			var cnt int64
-			// 检查 prompt_templates 表是否已有数据
-			if err := db.Table("prompt_templates").Count(&cnt).Error; err != nil {
-				return fmt.Errorf("failed to check prompt_templates count: %w", err)
-			}
-			if cnt > 0 {
-				log.Printf("Skipping seed migration %s because prompt_templates has %d rows", file, cnt)
-				continue
+		return applied, err
+	}
+	if applied == 0 {
+		log.Println("Database schema is up to date")
+	} else {
+		log.Printf("Applied %d migration(s)", applied)
+	}
+	return applied, nil
+}
+
+// Down 按版本号倒序回滚最近执行的 n 个迁移，返回回滚的个数。
+// 其中任何一个没有回滚脚本时不回滚任何迁移。
+func (m *Migrator) Down(n int) (int, error) {
+	if n < 1 {
+		return 0, fmt.Errorf("number of migrations to roll back must be positive, got %d", n)
+	}
+	rolledBack := 0
+	err := m.withLock(func(conn *gorm.DB, state *migrationState) error {
+		if err := state.verify(); err != nil {
+			return err
+		}
+		targets, err := m.lastApplied(state, n)
+		if err != nil {
+			return err
+		}
+		for _, mig := range targets {
+			if err := m.revert(conn, mig); err != nil {
+				return err
 			}
+			rolledBack++
+		}
+		return nil
+	})
+	return rolledBack, err
+}
+
+// Redo 回滚最近执行的一个迁移并重新执行
+func (m *Migrator) Redo() error {
+	return m.withLock(func(conn *gorm.DB, state *migrationState) error {
+		if err := state.verify(); err != nil {
+			return err
+		}
+		targets, err := m.lastApplied(state, 1)
+		if err != nil {
+			return err
+		}
+		if err := m.revert(conn, targets[0]); err != nil {
+			return err
 		}
+		return m.apply(conn, targets[0], false)
+	})
+}
 
-		log.Printf("Executing migration: %s", file)
+// Status 返回全部迁移（包括找不到文件的已执行迁移）的执行状态，按版本号排序。
+// 只读取 schema_migrations，不加锁也不创建表：表不存在时（新数据库或尚未迁移的旧数据库）所有迁移均为未执行。
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	state, err := m.readState(m.db)
+	if err != nil {
+		return nil, err
+	}
+	return m.statuses(state), nil
+}
 
-		content, err := os.ReadFile(file)
+// statuses 根据迁移记录计算每个迁移的状态
+func (m *Migrator) statuses(state *migrationState) []MigrationStatus {
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Version: mig.Version, Name: mig.Name, Reversible: mig.HasDown}
+		if a, ok := state.applied[mig.Version]; ok {
+			appliedAt := a.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			status.Modified = a.Checksum != mig.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range state.applied {
+		if m.find(a.Version) == nil {
+			appliedAt := a.AppliedAt
+			statuses = append(statuses, MigrationStatus{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: &appliedAt, Missing: true})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses
+}
+
+// migrationState 读取到的迁移记录
+type migrationState struct {
+	migrations []migration
+	applied    map[int64]appliedMigration
+	// legacy 为 true 表示数据库创建于引入 schema_migrations 之前
+	legacy bool
+}
+
+// verify 检查已执行迁移的校验和，已执行的升级脚本被修改时返回错误
+func (s *migrationState) verify() error {
+	for _, mig := range s.migrations {
+		if a, ok := s.applied[mig.Version]; ok && a.Checksum != mig.Checksum {
+			return fmt.Errorf("migration %s was modified after it was applied at %s (checksum %s, recorded %s); restore the original file and add a new migration instead",
+				mig.Name, a.AppliedAt.Format(time.RFC3339), mig.Checksum, a.Checksum)
+		}
+	}
+	return nil
+}
+
+// withLock 在持有迁移锁的连接上读取迁移记录并执行 fn
+func (m *Migrator) withLock(fn func(conn *gorm.DB, state *migrationState) error) error {
+	// advisory lock 属于会话，加锁、迁移和解锁需使用同一个连接
+	return m.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		defer func() {
+			if err := conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockKey).Error; err != nil {
+				log.Printf("Failed to release migration lock: %v", err)
+			}
+		}()
+
+		// 引入 schema_migrations 之前的数据库：迁移文件在每次启动时都会重新执行，
+		// 除示例数据外都可以安全地再执行一次；示例数据只记录为已执行，避免重新插入已被删除的数据
+		legacy := !conn.Migrator().HasTable("schema_migrations") && conn.Migrator().HasTable("prompt_templates")
+		err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`).Error
+		if err != nil {
+			return fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+
+		state, err := m.readState(conn)
 		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", file, err)
+			return err
+		}
+		state.legacy = legacy
+		return fn(conn, state)
+	})
+}
+
+// readState 读取已执行的迁移，schema_migrations 不存在时返回空记录
+func (m *Migrator) readState(conn *gorm.DB) (*migrationState, error) {
+	state := &migrationState{migrations: m.migrations, applied: make(map[int64]appliedMigration)}
+	if !conn.Migrator().HasTable("schema_migrations") {
+		return state, nil
+	}
+
+	var rows []appliedMigration
+	if err := conn.Table("schema_migrations").Order("version").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	for _, row := range rows {
+		state.applied[row.Version] = row
+		if m.find(row.Version) == nil {
+			log.Printf("Applied migration %s has no matching file", row.Name)
+		}
+	}
+	return state, nil
+}
+
+// lastApplied 返回最近执行的 n 个迁移（按版本号倒序），并检查它们都可以回滚
+func (m *Migrator) lastApplied(state *migrationState, n int) ([]migration, error) {
+	versions := make([]int64, 0, len(state.applied))
+	for version := range state.applied {
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, ErrNoMigrationsApplied
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if n > len(versions) {
+		return nil, fmt.Errorf("cannot roll back %d migrations, only %d applied", n, len(versions))
+	}
+
+	targets := make([]migration, 0, n)
+	for _, version := range versions[:n] {
+		mig := m.find(version)
+		if mig == nil {
+			return nil, fmt.Errorf("cannot roll back migration %s: file not found", state.applied[version].Name)
+		}
+		if !mig.HasDown {
+			return nil, fmt.Errorf("cannot roll back migration %s: no %s.down.sql", mig.Name, mig.Name)
 		}
+		targets = append(targets, *mig)
+	}
+	return targets, nil
+}
+
+// apply 在事务中执行迁移并写入记录。legacy 数据库中的示例数据迁移只写入记录。
+func (m *Migrator) apply(conn *gorm.DB, mig migration, legacy bool) error {
+	if legacy && isSeedMigration(mig.Name) {
+		log.Printf("Recording seed migration %s as applied without executing it (existing database)", mig.Name)
+		return recordMigration(conn, mig)
+	}
 
-		// 执行SQL
-		if err := db.Exec(string(content)).Error; err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", file, err)
+	log.Printf("Executing migration: %s", mig.Name)
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(mig.SQL).Error; err != nil {
+			return err
 		}
+		return recordMigration(tx, mig)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute migration %s: %w", mig.Name, err)
+	}
+	log.Printf("Migration completed: %s", mig.Name)
+	return nil
+}
 
-		log.Printf("Migration completed: %s", file)
+// revert 在事务中执行回滚脚本并删除记录
+func (m *Migrator) revert(conn *gorm.DB, mig migration) error {
+	log.Printf("Rolling back migration: %s", mig.Name)
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(mig.DownSQL).Error; err != nil {
+			return err
+		}
+		return tx.Exec("DELETE FROM schema_migrations WHERE version = ?", mig.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back migration %s: %w", mig.Name, err)
+	}
+	log.Printf("Rollback completed: %s", mig.Name)
+	return nil
+}
+
+func (m *Migrator) find(version int64) *migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
 	}
+	return nil
+}
 
-	log.Println("All migrations completed successfully")
+func recordMigration(tx *gorm.DB, mig migration) error {
+	err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum) VALUES (?, ?, ?)", mig.Version, mig.Name, mig.Checksum).Error
+	if err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", mig.Name, err)
+	}
 	return nil
 }
+
+// CreateMigration 在 dir 中创建下一个版本号的 NNN_name.up.sql 和 NNN_name.down.sql，返回两个文件的路径。
+// dir 为空时使用 MIGRATIONS_DIR，未设置时使用源码目录 MigrationSourceDir。
+func CreateMigration(dir, name string) (string, string, error) {
+	if dir == "" {
+		dir = os.Getenv("MIGRATIONS_DIR")
+	}
+	if dir == "" {
+		dir = MigrationSourceDir
+	}
+	name = strings.Trim(migrationNameSeparator.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", errors.New("migration name must contain letters or digits")
+	}
+	migrations, err := loadMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	var version int64 = 1
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%03d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	files := []struct{ path, header string }{
+		{up, fmt.Sprintf("-- %03d_%s: describe the schema change here.\n", version, name)},
+		{down, fmt.Sprintf("-- Reverts %03d_%s.up.sql.\n", version, name)},
+	}
+	for _, f := range files {
+		// O_EXCL：不覆盖已有文件
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = file.WriteString(f.header)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+// loadMigrations 读取 fsys 根目录中的迁移文件，按版本号（文件名开头的数字）排序。
+// 升级脚本的校验和记录在 schema_migrations 中；回滚脚本不参与校验，可在执行前修改。
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration files: %w", err)
+	}
+
+	byVersion := make(map[int64]*migration)
+	downs := make(map[int64]string)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(fileName), ".sql") {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(fileName)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s (expected NNN_name.up.sql, NNN_name.down.sql or NNN_name.sql)", fileName)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %s must start with a positive version number", fileName)
+		}
+		name := match[1] + "_" + match[2]
+
+		content, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", fileName, err)
+		}
+
+		if match[3] == ".down" {
+			if _, ok := downs[version]; ok {
+				return nil, fmt.Errorf("duplicate down migration for version %d (%s)", version, fileName)
+			}
+			downs[version] = string(content)
+			continue
+		}
+		if other, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version %d", other.Name, name, version)
+		}
+		sum := sha256.Sum256(content)
+		byVersion[version] = &migration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(content),
+			Checksum: hex.EncodeToString(sum[:]),
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for version, down := range downs {
+		mig, ok := byVersion[version]
+		if !ok {
+			return nil, fmt.Errorf("down migration for version %d has no matching up migration", version)
+		}
+		mig.DownSQL = down
+		mig.HasDown = true
+	}
+	for _, mig := range byVersion {
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// isSeedMigration 是否为插入示例数据的迁移
+func isSeedMigration(name string) bool {
+	return strings.Contains(strings.ToLower(name), "seed")
+}
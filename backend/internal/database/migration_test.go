@@ -0,0 +1,331 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func file(content string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(content)} }
+
+func checksum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"001_init.up.sql":      file("CREATE TABLE a ();"),
+		"001_init.down.sql":    file("DROP TABLE a;"),
+		"002_legacy.sql":       file("CREATE TABLE b ();"),
+		"010_after_gap.up.sql": file("CREATE TABLE c ();"),
+		"README.md":            file("not a migration"),
+		"nested/003_x.up.sql":  file("ignored"),
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+
+	want := []struct {
+		version int64
+		name    string
+		hasDown bool
+	}{
+		{1, "001_init", true},
+		{2, "002_legacy", false},
+		{10, "010_after_gap", false},
+	}
+	if len(migrations) != len(want) {
+		t.Fatalf("got %d migrations, want %d: %+v", len(migrations), len(want), migrations)
+	}
+	for i, w := range want {
+		m := migrations[i]
+		if m.Version != w.version || m.Name != w.name || m.HasDown != w.hasDown {
+			t.Errorf("migration %d = %d %s down=%v, want %d %s down=%v", i, m.Version, m.Name, m.HasDown, w.version, w.name, w.hasDown)
+		}
+	}
+	if migrations[0].Checksum != checksum("CREATE TABLE a ();") || migrations[0].DownSQL != "DROP TABLE a;" {
+		t.Errorf("checksum or down SQL of 001_init: %+v", migrations[0])
+	}
+
+	// 回滚脚本不参与校验和，修改后已执行的迁移仍然有效
+	fsys["001_init.down.sql"] = file("DROP TABLE IF EXISTS a;")
+	changed, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed[0].Checksum != migrations[0].Checksum {
+		t.Error("editing a down migration changed the up checksum")
+	}
+}
+
+func TestLoadMigrationsRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		fsys    fstest.MapFS
+		errPart string
+	}{
+		{"invalid name", fstest.MapFS{"init.sql": file("")}, "invalid migration file name"},
+		{"zero version", fstest.MapFS{"000_init.up.sql": file("")}, "positive version"},
+		{"duplicate version", fstest.MapFS{"001_a.up.sql": file(""), "001_b.sql": file("")}, "same version 1"},
+		{"duplicate padded version", fstest.MapFS{"1_a.up.sql": file(""), "001_b.up.sql": file("")}, "same version 1"},
+		{"duplicate down", fstest.MapFS{"001_a.up.sql": file(""), "001_a.down.sql": file(""), "1_a.down.sql": file("")}, "duplicate down migration"},
+		{"down without up", fstest.MapFS{"001_a.up.sql": file(""), "002_b.down.sql": file("")}, "no matching up migration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadMigrations(tt.fsys)
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+			}
+		})
+	}
+}
+
+func TestNewMigratorWithoutMigrations(t *testing.T) {
+	if _, err := NewMigrator(nil, t.TempDir()); !errors.Is(err, ErrNoMigrations) {
+		t.Fatalf("empty directory: err = %v, want ErrNoMigrations", err)
+	}
+	if _, err := NewMigrator(nil, t.TempDir()+"/missing"); err == nil {
+		t.Fatal("missing directory accepted")
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	t.Setenv("MIGRATIONS_DIR", "")
+	m, err := NewMigrator(nil, "")
+	if err != nil {
+		t.Fatalf("NewMigrator: %v", err)
+	}
+	for i, mig := range m.migrations {
+		if !mig.HasDown {
+			t.Errorf("embedded migration %s has no down migration", mig.Name)
+		}
+		// 已发布的迁移不能删除，版本号必须连续
+		if mig.Version != int64(i+1) {
+			t.Errorf("embedded migration %s has version %d, want %d", mig.Name, mig.Version, i+1)
+		}
+	}
+}
+
+func TestMigrationSource(t *testing.T) {
+	flagDir, envDir := t.TempDir(), t.TempDir()
+	for dir, name := range map[string]string{flagDir: "001_flag.up.sql", envDir: "001_env.up.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notDir := filepath.Join(flagDir, "001_flag.up.sql")
+
+	tests := []struct {
+		name     string
+		dir      string
+		env      string
+		wantName string // 读取到的第一个迁移，为空时期望编译进二进制的迁移
+		errPart  string
+	}{
+		{"embedded by default", "", "", "", ""},
+		{"MIGRATIONS_DIR", "", envDir, "001_env", ""},
+		{"dir overrides MIGRATIONS_DIR", flagDir, envDir, "001_flag", ""},
+		{"missing directory", filepath.Join(flagDir, "missing"), "", "", "migrations directory"},
+		{"file instead of directory", notDir, "", "", "is not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MIGRATIONS_DIR", tt.env)
+			fsys, source, err := migrationSource(tt.dir)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("migrationSource: %v", err)
+			}
+			migrations, err := loadMigrations(fsys)
+			if err != nil || len(migrations) == 0 {
+				t.Fatalf("loadMigrations from %s: %d migrations, %v", source, len(migrations), err)
+			}
+			if tt.wantName == "" {
+				if source != "embedded migrations" || migrations[0].Name != "001_initial_schema" {
+					t.Errorf("source %q first migration %s, want the embedded migrations", source, migrations[0].Name)
+				}
+				return
+			}
+			if migrations[0].Name != tt.wantName || len(migrations) != 1 {
+				t.Errorf("source %q loaded %+v, want only %s", source, migrations, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestCreateMigrationUsesMigrationsDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MIGRATIONS_DIR", dir)
+	up, down, err := CreateMigration("", "First Table")
+	if err != nil {
+		t.Fatalf("CreateMigration: %v", err)
+	}
+	if up != filepath.Join(dir, "001_first_table.up.sql") || down != filepath.Join(dir, "001_first_table.down.sql") {
+		t.Errorf("created %s and %s, want them in MIGRATIONS_DIR", up, down)
+	}
+	// 新建的迁移可以直接被加载
+	if _, err := NewMigrator(nil, ""); err != nil {
+		t.Errorf("NewMigrator after create: %v", err)
+	}
+}
+
+// migrationsFixture 两个迁移：001 可回滚，002 不可回滚
+func migrationsFixture(t *testing.T) *Migrator {
+	t.Helper()
+	migrations, err := loadMigrations(fstest.MapFS{
+		"001_init.up.sql":   file("CREATE TABLE a ();"),
+		"001_init.down.sql": file("DROP TABLE a;"),
+		"002_seed.up.sql":   file("INSERT INTO a DEFAULT VALUES;"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Migrator{migrations: migrations}
+}
+
+func TestVerify(t *testing.T) {
+	m := migrationsFixture(t)
+	appliedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	applied := func(rows ...appliedMigration) *migrationState {
+		state := &migrationState{migrations: m.migrations, applied: make(map[int64]appliedMigration)}
+		for _, row := range rows {
+			state.applied[row.Version] = row
+		}
+		return state
+	}
+	init := appliedMigration{Version: 1, Name: "001_init", Checksum: m.migrations[0].Checksum, AppliedAt: appliedAt}
+
+	if err := applied().verify(); err != nil {
+		t.Errorf("nothing applied: %v", err)
+	}
+	if err := applied(init).verify(); err != nil {
+		t.Errorf("unchanged file: %v", err)
+	}
+	// 找不到文件的已执行迁移只在状态中报告，不阻止启动
+	if err := applied(init, appliedMigration{Version: 6, Name: "006_removed", Checksum: "x"}).verify(); err != nil {
+		t.Errorf("missing file: %v", err)
+	}
+
+	modified := init
+	modified.Checksum = strings.Repeat("0", 64)
+	err := applied(modified).verify()
+	if err == nil {
+		t.Fatal("modified migration accepted")
+	}
+	for _, part := range []string{"001_init", "2026-01-02T03:04:05Z", m.migrations[0].Checksum, modified.Checksum} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error %q does not mention %q", err, part)
+		}
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	m := migrationsFixture(t)
+	appliedAt := time.Now()
+	state := &migrationState{migrations: m.migrations, applied: map[int64]appliedMigration{
+		1: {Version: 1, Name: "001_init", Checksum: "edited", AppliedAt: appliedAt},
+		6: {Version: 6, Name: "006_removed", Checksum: "x", AppliedAt: appliedAt},
+	}}
+
+	statuses := m.statuses(state)
+	want := []MigrationStatus{
+		{Version: 1, Name: "001_init", Applied: true, Modified: true, Reversible: true},
+		{Version: 2, Name: "002_seed"},
+		{Version: 6, Name: "006_removed", Applied: true, Missing: true},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("got %d statuses, want %d: %+v", len(statuses), len(want), statuses)
+	}
+	for i, w := range want {
+		got := statuses[i]
+		if (got.AppliedAt != nil) != w.Applied {
+			t.Errorf("%s: applied_at = %v, applied = %v", got.Name, got.AppliedAt, w.Applied)
+		}
+		got.AppliedAt = nil
+		if got != w {
+			t.Errorf("status %d = %+v, want %+v", i, got, w)
+		}
+	}
+}
+
+// dryRunDB 返回只生成 SQL、不连接数据库的 gorm.DB，以及捕获到的语句
+func dryRunDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 sslmode=disable"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statements []string
+	capture := func(tx *gorm.DB) {
+		statements = append(statements, tx.Statement.SQL.String())
+	}
+	callbacks := db.Callback()
+	for name, register := range map[string]func(string, func(*gorm.DB)) error{
+		"query": callbacks.Query().Register,
+		"raw":   callbacks.Raw().Register,
+		"row":   callbacks.Row().Register,
+	} {
+		if err := register("test:capture_"+name, capture); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, &statements
+}
+
+func TestStatusIsReadOnly(t *testing.T) {
+	db, statements := dryRunDB(t)
+	m := migrationsFixture(t)
+	m.db = db
+
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("statuses without schema_migrations = %+v, want all pending", statuses)
+	}
+	if len(*statements) == 0 {
+		t.Fatal("no statements captured")
+	}
+	for _, stmt := range *statements {
+		if strings.Contains(stmt, "pg_advisory") || strings.Contains(strings.ToUpper(stmt), "CREATE TABLE") {
+			t.Errorf("Status executed %q", stmt)
+		}
+	}
+}
+
+func TestApplyLegacySeed(t *testing.T) {
+	// 引入 schema_migrations 之前的数据库：示例数据迁移只写入记录，不重新插入数据
+	db, statements := dryRunDB(t)
+	m := migrationsFixture(t)
+	seed := m.migrations[1]
+
+	if err := m.apply(db, seed, true); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(*statements) != 1 || !strings.HasPrefix((*statements)[0], "INSERT INTO schema_migrations") {
+		t.Fatalf("statements = %q, want only the schema_migrations record", *statements)
+	}
+	if !isSeedMigration(seed.Name) || isSeedMigration(m.migrations[0].Name) {
+		t.Error("isSeedMigration misclassified the fixture")
+	}
+}
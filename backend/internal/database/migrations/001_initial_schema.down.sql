@@ -0,0 +1,3 @@
+-- Reverts 001_initial_schema.up.sql
+DROP TABLE IF EXISTS template_variables;
+DROP TABLE IF EXISTS prompt_templates;
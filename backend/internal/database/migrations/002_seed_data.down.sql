@@ -0,0 +1,6 @@
+-- Removes the sample templates inserted by 002_seed_data.up.sql
+DELETE FROM prompt_templates WHERE id IN (
+    '6bb1d7b4-1978-4209-b223-a35e91ee56ba',
+    '738ec104-5cb5-4af4-be01-b4e25abe0a10',
+    '8f9e2c1a-3d5b-4f7e-9a8b-1c2d3e4f5a6b'
+);
@@ -0,0 +1,2 @@
+-- Reverts 003_users.up.sql
+DROP TABLE IF EXISTS users;
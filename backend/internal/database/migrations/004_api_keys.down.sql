@@ -0,0 +1,2 @@
+-- Reverts 004_api_keys.up.sql
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,3 @@
+-- Reverts 005_template_versions.up.sql; the version history is lost
+DROP TABLE IF EXISTS prompt_template_versions;
+ALTER TABLE prompt_templates DROP COLUMN IF EXISTS version;
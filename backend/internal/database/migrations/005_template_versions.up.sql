@@ -0,0 +1,25 @@
+-- Template version history
+ALTER TABLE prompt_templates ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS prompt_template_versions (
+    id UUID PRIMARY KEY,
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    name VARCHAR(200) NOT NULL,
+    description TEXT,
+    content TEXT NOT NULL,
+    variables JSONB DEFAULT '[]'::jsonb,
+    category VARCHAR(100),
+    created_by UUID,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_prompt_template_versions_template_version ON prompt_template_versions(template_id, version);
+
+-- Snapshot existing templates as their first version
+INSERT INTO prompt_template_versions (id, template_id, version, name, description, content, variables, category, created_by, created_at)
+SELECT gen_random_uuid(), t.id, t.version, t.name, t.description, t.content, t.variables, t.category, t.user_id, t.updated_at
+FROM prompt_templates t
+WHERE NOT EXISTS (
+    SELECT 1 FROM prompt_template_versions v WHERE v.template_id = t.id
+);
@@ -0,0 +1,8 @@
+-- Reverts 006_typed_variables.up.sql
+ALTER TABLE template_variables DROP COLUMN IF EXISTS type;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS min_length;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS max_length;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS pattern;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS options;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS min;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS max;
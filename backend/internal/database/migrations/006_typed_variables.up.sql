@@ -0,0 +1,10 @@
+-- Typed template variables with validation rules.
+-- Variable definitions are stored in prompt_templates.variables (JSONB); the
+-- template_variables table is kept in sync with the Go model.
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS type VARCHAR(20) DEFAULT 'string';
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS min_length INTEGER;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS max_length INTEGER;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS pattern TEXT;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS options JSONB;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS min DOUBLE PRECISION;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS max DOUBLE PRECISION;
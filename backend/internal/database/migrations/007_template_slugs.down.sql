@@ -0,0 +1,3 @@
+-- Reverts 007_template_slugs.up.sql
+DROP INDEX IF EXISTS idx_prompt_templates_slug;
+ALTER TABLE prompt_templates DROP COLUMN IF EXISTS slug;
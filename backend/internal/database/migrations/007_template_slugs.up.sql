@@ -0,0 +1,4 @@
+-- Optional unique slugs so templates can be included as partials by name,
+-- e.g. {{> template:json-output-format}}.
+ALTER TABLE prompt_templates ADD COLUMN IF NOT EXISTS slug VARCHAR(100);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_prompt_templates_slug ON prompt_templates(slug) WHERE slug IS NOT NULL;
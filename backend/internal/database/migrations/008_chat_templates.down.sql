@@ -0,0 +1,6 @@
+-- Reverts 008_chat_templates.up.sql; chat templates keep their flattened content
+ALTER TABLE prompt_template_versions DROP COLUMN IF EXISTS messages;
+ALTER TABLE prompt_template_versions DROP COLUMN IF EXISTS kind;
+
+ALTER TABLE prompt_templates DROP COLUMN IF EXISTS messages;
+ALTER TABLE prompt_templates DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,7 @@
+-- Chat (multi-role) templates. For kind = 'chat' the messages column holds an
+-- ordered list of {role, content} objects and content holds the flattened text.
+ALTER TABLE prompt_templates ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'text';
+ALTER TABLE prompt_templates ADD COLUMN IF NOT EXISTS messages JSONB;
+
+ALTER TABLE prompt_template_versions ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'text';
+ALTER TABLE prompt_template_versions ADD COLUMN IF NOT EXISTS messages JSONB;
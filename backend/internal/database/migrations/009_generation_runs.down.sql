@@ -0,0 +1,3 @@
+-- Reverts 009_generation_runs.up.sql; the generation history is lost
+DROP TABLE IF EXISTS generation_runs;
+ALTER TABLE prompt_templates DROP COLUMN IF EXISTS redact_runs;
@@ -0,0 +1,20 @@
+-- Generation history: one row per prompt generation. Templates with
+-- redact_runs = TRUE store placeholder variable values and no output.
+ALTER TABLE prompt_templates ADD COLUMN IF NOT EXISTS redact_runs BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS generation_runs (
+    id UUID PRIMARY KEY,
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    template_version INTEGER NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    variables JSONB NOT NULL DEFAULT '{}'::jsonb,
+    output TEXT,
+    redacted BOOLEAN NOT NULL DEFAULT FALSE,
+    status VARCHAR(20) NOT NULL,
+    error TEXT,
+    latency_ms INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_generation_runs_template_created ON generation_runs(template_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_generation_runs_created_at ON generation_runs(created_at);
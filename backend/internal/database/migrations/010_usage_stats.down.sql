@@ -0,0 +1,4 @@
+-- Reverts 010_usage_stats.up.sql; usage analytics are lost
+DROP TABLE IF EXISTS template_variable_values;
+DROP TABLE IF EXISTS template_usage_callers;
+DROP TABLE IF EXISTS template_usage_hourly;
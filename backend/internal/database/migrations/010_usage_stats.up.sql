@@ -0,0 +1,29 @@
+-- Usage analytics. Counters are upserted in hourly buckets (UTC) when a
+-- generation happens; daily figures are rolled up from the hourly rows.
+CREATE TABLE IF NOT EXISTS template_usage_hourly (
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    generations INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (template_id, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS idx_template_usage_hourly_bucket ON template_usage_hourly(bucket);
+
+-- Distinct authenticated callers per template and hour
+CREATE TABLE IF NOT EXISTS template_usage_callers (
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    user_id UUID NOT NULL,
+    PRIMARY KEY (template_id, bucket, user_id)
+);
+
+-- Variable value frequencies per template and day (short values only)
+CREATE TABLE IF NOT EXISTS template_variable_values (
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    bucket TIMESTAMPTZ NOT NULL,
+    variable VARCHAR(100) NOT NULL,
+    value VARCHAR(200) NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (template_id, bucket, variable, value)
+);
@@ -0,0 +1,4 @@
+-- Reverts 011_template_search.up.sql
+DROP INDEX IF EXISTS idx_prompt_templates_search;
+ALTER TABLE prompt_templates DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS template_search_text(TEXT);
@@ -0,0 +1,24 @@
+-- Full-text search over template name, description and content.
+--
+-- The 'simple' configuration does not segment CJK text: a run of Chinese
+-- characters would become a single lexeme and only match as a whole. The
+-- helper below puts spaces around every CJK character so each one is
+-- indexed as its own lexeme; queries are built with phraseto_tsquery, which
+-- requires those characters to be adjacent, so "翻译" matches the substring
+-- 翻译 but not 翻 and 译 appearing separately. Latin text is tokenized as
+-- usual (lower-cased, no stemming).
+CREATE OR REPLACE FUNCTION template_search_text(input TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE PARALLEL SAFE AS $$
+    SELECT regexp_replace(coalesce(input, ''),
+        '([\u3040-\u30ff\u3400-\u4dbf\u4e00-\u9fff\uf900-\ufaff\uac00-\ud7af])', ' \1 ', 'g')
+$$;
+
+-- Name matches rank above description matches, which rank above content
+ALTER TABLE prompt_templates ADD COLUMN IF NOT EXISTS search_vector TSVECTOR
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', template_search_text(name)), 'A') ||
+        setweight(to_tsvector('simple', template_search_text(description)), 'B') ||
+        setweight(to_tsvector('simple', template_search_text(content)), 'C')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_search ON prompt_templates USING GIN (search_vector);
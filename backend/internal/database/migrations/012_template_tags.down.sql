@@ -0,0 +1,3 @@
+-- Reverts 012_template_tags.up.sql; tag assignments are lost
+DROP TABLE IF EXISTS template_tags;
+DROP TABLE IF EXISTS tags;
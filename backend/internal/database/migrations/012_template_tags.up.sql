@@ -0,0 +1,15 @@
+-- Many-to-many template tags. Tag names are normalized (trimmed, lower-case)
+-- by the application before they are stored.
+CREATE TABLE IF NOT EXISTS tags (
+    id UUID PRIMARY KEY,
+    name VARCHAR(50) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS template_tags (
+    template_id UUID NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (template_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_template_tags_tag_id ON template_tags(tag_id);
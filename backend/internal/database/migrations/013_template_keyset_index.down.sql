@@ -0,0 +1,3 @@
+-- Reverts 013_template_keyset_index.up.sql
+DROP INDEX IF EXISTS idx_prompt_templates_public_created_id;
+DROP INDEX IF EXISTS idx_prompt_templates_created_id;
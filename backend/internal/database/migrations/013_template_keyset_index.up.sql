@@ -0,0 +1,4 @@
+-- Keyset (cursor) pagination of template listings orders by (created_at, id).
+-- The partial index serves the public catalog, the full one the other lists.
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_created_id ON prompt_templates(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_public_created_id ON prompt_templates(created_at DESC, id DESC) WHERE is_public;
@@ -0,0 +1,12 @@
+-- Reverts 014_template_sort_indexes.up.sql. Backfilled values are kept; the
+-- columns only become nullable again.
+DROP INDEX IF EXISTS idx_prompt_templates_public_usage_id;
+DROP INDEX IF EXISTS idx_prompt_templates_public_name_id;
+DROP INDEX IF EXISTS idx_prompt_templates_public_updated_id;
+DROP INDEX IF EXISTS idx_prompt_templates_usage_id;
+DROP INDEX IF EXISTS idx_prompt_templates_name_id;
+DROP INDEX IF EXISTS idx_prompt_templates_updated_id;
+
+ALTER TABLE prompt_templates ALTER COLUMN updated_at DROP NOT NULL;
+ALTER TABLE prompt_templates ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE prompt_templates ALTER COLUMN usage_count DROP NOT NULL;
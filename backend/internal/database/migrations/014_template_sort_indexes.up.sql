@@ -0,0 +1,20 @@
+-- Sorting of template listings by updated_at, name and usage_count. Each
+-- sort is keyed on (column, id) so cursor pagination can seek directly; the
+-- partial indexes serve the public catalog (e.g. "most used public templates").
+-- B-tree indexes are scanned backwards for the opposite direction.
+
+-- Row comparisons used by cursor pagination do not handle NULLs
+UPDATE prompt_templates SET usage_count = 0 WHERE usage_count IS NULL;
+UPDATE prompt_templates SET created_at = NOW() WHERE created_at IS NULL;
+UPDATE prompt_templates SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE prompt_templates ALTER COLUMN usage_count SET NOT NULL;
+ALTER TABLE prompt_templates ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE prompt_templates ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_updated_id ON prompt_templates(updated_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_name_id ON prompt_templates(name, id);
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_usage_id ON prompt_templates(usage_count DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_public_updated_id ON prompt_templates(updated_at DESC, id DESC) WHERE is_public;
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_public_name_id ON prompt_templates(name, id) WHERE is_public;
+CREATE INDEX IF NOT EXISTS idx_prompt_templates_public_usage_id ON prompt_templates(usage_count DESC, id DESC) WHERE is_public;
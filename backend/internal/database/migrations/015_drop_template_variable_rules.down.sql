@@ -0,0 +1,9 @@
+-- Reverts 015_drop_template_variable_rules.up.sql. The columns come back
+-- empty; they were never populated.
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS type VARCHAR(20) DEFAULT 'string';
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS min_length INTEGER;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS max_length INTEGER;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS pattern TEXT;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS options JSONB;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS min DOUBLE PRECISION;
+ALTER TABLE template_variables ADD COLUMN IF NOT EXISTS max DOUBLE PRECISION;
@@ -0,0 +1,10 @@
+-- Typed variable rules are stored with the rest of each variable definition
+-- in prompt_templates.variables (JSONB); nothing reads or writes the columns
+-- 006_typed_variables added to template_variables, so drop them again.
+ALTER TABLE template_variables DROP COLUMN IF EXISTS type;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS min_length;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS max_length;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS pattern;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS options;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS min;
+ALTER TABLE template_variables DROP COLUMN IF EXISTS max;
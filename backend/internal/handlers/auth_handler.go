@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AuthHandler 认证处理器
+type AuthHandler struct {
+	service *services.AuthService
+}
+
+// NewAuthHandler 创建认证处理器
+func NewAuthHandler(service *services.AuthService) *AuthHandler {
+	return &AuthHandler{service: service}
+}
+
+// Register 注册
+func (h *AuthHandler) Register(c *gin.Context) {
+	var req models.RegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.service.Register(req)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailTaken) {
+			respondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// Login 登录
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.service.Login(req)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			respondError(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// Me 获取当前登录用户
+func (h *AuthHandler) Me(c *gin.Context) {
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	user, err := h.service.GetUser(userID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "user not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateAPIKey 创建 API 密钥
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	resp, err := h.service.CreateAPIKey(userID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrTooManyAPIKeys) {
+			respondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, resp)
+}
+
+// ListAPIKeys 获取当前用户的 API 密钥
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	keys, err := h.service.ListAPIKeys(userID)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": keys})
+}
+
+// DeleteAPIKey 吊销 API 密钥
+func (h *AuthHandler) DeleteAPIKey(c *gin.Context) {
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "authentication required")
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid api key ID")
+		return
+	}
+
+	if err := h.service.DeleteAPIKey(userID, id); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			respondError(c, http.StatusNotFound, err.Error())
+			return
+		}
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key deleted successfully"})
+}
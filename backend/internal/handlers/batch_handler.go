@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BatchGenerate 使用同一模板批量生成提示词，单条失败不影响其他条目
+func (h *TemplateHandler) BatchGenerate(c *gin.Context) {
+	var req models.BatchGenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	resp, err := h.service.GenerateBatch(req, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
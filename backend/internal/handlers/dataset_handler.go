@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxDatasetFieldBytes 数据集表单中普通字段的最大长度
+const maxDatasetFieldBytes = 1024
+
+var datasetContentTypes = map[string]string{
+	models.DatasetFormatJSONL: "application/x-ndjson; charset=utf-8",
+	models.DatasetFormatCSV:   "text/csv; charset=utf-8",
+}
+
+// GenerateDataset 使用同一模板逐行渲染上传的 CSV/JSONL 文件，结果以流的形式逐行返回。
+// 表单字段（template_id、version、strict、format、input_format）需位于 file 之前，
+// 文件内容不会整体读入内存。
+func (h *TemplateHandler) GenerateDataset(c *gin.Context) {
+	// 边读上传文件边输出结果：HTTP/1.x 默认在第一次刷新响应时关闭未读完的请求体，需要开启全双工
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+		log.Printf("dataset: enable full duplex: %v", err)
+		respondError(c, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	req, file, err := readDatasetForm(c.Request)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondError(c, http.StatusRequestEntityTooLarge, "request too large")
+			return
+		}
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	out := &datasetResponseWriter{c: c, contentType: datasetContentTypes[req.OutputFormat]}
+	writer, err := services.NewDatasetWriter(req.OutputFormat, out)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	summary, err := h.service.RenderDataset(*req, file, writer, viewer)
+	if err != nil {
+		if !out.started {
+			respondTemplateError(c, err)
+			return
+		}
+		// 响应已开始输出，只能中断（通常是客户端断开）
+		log.Printf("dataset: stream aborted after %d rows: %v", summary.Rows, err)
+		return
+	}
+	if !out.started {
+		// 空文件
+		out.start()
+	}
+}
+
+// readDatasetForm 读取 file 之前的表单字段，返回解析后的参数和文件内容
+func readDatasetForm(r *http.Request) (*models.DatasetRequest, io.Reader, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, errors.New("expected multipart/form-data")
+	}
+
+	fields := make(map[string]string)
+	var file *multipart.Part
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, nil, errors.New("file is required")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if part.FormName() == "file" {
+			file = part
+			break
+		}
+		value, err := io.ReadAll(io.LimitReader(part, maxDatasetFieldBytes+1))
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(value) > maxDatasetFieldBytes {
+			return nil, nil, errors.New("form field " + part.FormName() + " too long")
+		}
+		fields[part.FormName()] = strings.TrimSpace(string(value))
+	}
+
+	req := &models.DatasetRequest{
+		InputFormat:  strings.ToLower(fields["input_format"]),
+		OutputFormat: strings.ToLower(fields["format"]),
+	}
+	if req.TemplateID, err = uuid.Parse(fields["template_id"]); err != nil {
+		return nil, nil, errors.New("invalid template_id")
+	}
+	if value := fields["version"]; value != "" {
+		version, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, nil, errors.New("version must be a positive integer")
+		}
+		req.Version = &version
+	}
+	if value := fields["strict"]; value != "" {
+		if req.Strict, err = strconv.ParseBool(value); err != nil {
+			return nil, nil, errors.New("strict must be true or false")
+		}
+	}
+	if req.InputFormat == "" {
+		switch strings.ToLower(filepath.Ext(file.FileName())) {
+		case ".csv":
+			req.InputFormat = models.DatasetFormatCSV
+		case ".jsonl", ".ndjson":
+			req.InputFormat = models.DatasetFormatJSONL
+		default:
+			return nil, nil, errors.New("input_format is required when the file is not .csv or .jsonl")
+		}
+	}
+	if req.OutputFormat == "" {
+		req.OutputFormat = models.DatasetFormatJSONL
+	}
+	if err := req.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return req, file, nil
+}
+
+// datasetResponseWriter 在第一次写入时才发送响应头，
+// 这样模板错误等仍可以普通的 JSON 错误响应返回
+type datasetResponseWriter struct {
+	c           *gin.Context
+	contentType string
+	started     bool
+}
+
+func (w *datasetResponseWriter) start() {
+	w.started = true
+	w.c.Header("Content-Type", w.contentType)
+	w.c.Status(http.StatusOK)
+	w.c.Writer.WriteHeaderNow()
+}
+
+func (w *datasetResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.start()
+	}
+	return w.c.Writer.Write(p)
+}
+
+func (w *datasetResponseWriter) Flush() {
+	if w.started {
+		w.c.Writer.Flush()
+	}
+}
@@ -0,0 +1,185 @@
+package handlers_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/handlers"
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+	"prompt-backend/internal/services/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// fakeTemplates 只实现数据集渲染用到的 GetByID，其余方法调用时 panic
+type fakeTemplates struct {
+	repository.TemplateRepository
+	byID map[uuid.UUID]*models.PromptTemplate
+}
+
+func (f *fakeTemplates) GetByID(id uuid.UUID) (*models.PromptTemplate, error) {
+	if tmpl, ok := f.byID[id]; ok {
+		copied := *tmpl
+		return &copied, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// newDatasetServer 启动一个真实的 HTTP 服务：请求体与响应交错读写的行为只有在真实连接上才会出现
+func newDatasetServer(t *testing.T) (*httptest.Server, uuid.UUID) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	tmpl := &models.PromptTemplate{ID: uuid.New(), Version: 1, IsPublic: true, Content: "Hello {{name}}"}
+	repo := &fakeTemplates{byID: map[uuid.UUID]*models.PromptTemplate{tmpl.ID: tmpl}}
+	handler := handlers.NewTemplateHandler(services.NewTemplateService(repo, nil, nil, nil))
+
+	router := gin.New()
+	router.POST("/dataset", middleware.DatasetSizeLimitFromEnv(), handler.GenerateDataset)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, tmpl.ID
+}
+
+// datasetBody 构造 template_id 在前、file 在后的 multipart 请求体
+func datasetBody(t *testing.T, templateID uuid.UUID, filename, content string) (*bytes.Buffer, string) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("template_id", templateID.String()); err != nil {
+		t.Fatal(err)
+	}
+	file, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(file, content)
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, form.FormDataContentType()
+}
+
+func csvRows(n int) string {
+	var b strings.Builder
+	b.WriteString("name\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "user%08d\n", i)
+	}
+	return b.String()
+}
+
+func readResults(t *testing.T, r io.Reader) []models.DatasetResult {
+	t.Helper()
+	var results []models.DatasetResult
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var result models.DatasetResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func TestGenerateDatasetStreamsLargeUpload(t *testing.T) {
+	server, templateID := newDatasetServer(t)
+	const rows = 2000
+	body, contentType := datasetBody(t, templateID, "rows.csv", csvRows(rows))
+	if body.Len() < 20<<10 {
+		t.Fatalf("upload is only %d bytes, want one that spans several flushes", body.Len())
+	}
+
+	resp, err := http.Post(server.URL+"/dataset", contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	results := readResults(t, resp.Body)
+	if len(results) != rows {
+		t.Fatalf("got %d rows, want %d", len(results), rows)
+	}
+	for i, result := range results {
+		want := fmt.Sprintf("Hello user%08d", i)
+		if result.GenerateResponse == nil || result.Prompt != want || result.Line != i+2 {
+			t.Fatalf("row %d: %+v, want %q on line %d", i, result, want, i+2)
+		}
+	}
+}
+
+func TestGenerateDatasetSizeLimit(t *testing.T) {
+	t.Setenv("MAX_DATASET_BYTES", "4096")
+	server, templateID := newDatasetServer(t)
+
+	t.Run("content length", func(t *testing.T) {
+		body, contentType := datasetBody(t, templateID, "rows.csv", csvRows(1000))
+		resp, err := http.Post(server.URL+"/dataset", contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Errorf("status %d, want 413", resp.StatusCode)
+		}
+	})
+
+	t.Run("chunked", func(t *testing.T) {
+		// 长度未知的请求体在读到上限时中断，已输出的行保留，最后一行说明原因
+		body, contentType := datasetBody(t, templateID, "rows.csv", csvRows(1000))
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/dataset", io.MultiReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+
+		results := readResults(t, resp.Body)
+		if len(results) < 2 || len(results) >= 1000 {
+			t.Fatalf("got %d rows, want the upload cut off at the limit", len(results))
+		}
+		last := results[len(results)-1]
+		if !strings.Contains(last.Error, "read input") || !strings.Contains(last.Error, "too large") {
+			t.Errorf("last row %+v, want the size limit error", last)
+		}
+	})
+}
+
+func TestGenerateDatasetTemplateNotFound(t *testing.T) {
+	server, _ := newDatasetServer(t)
+	body, contentType := datasetBody(t, uuid.New(), "rows.csv", csvRows(3))
+	resp, err := http.Post(server.URL+"/dataset", contentType, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DiffTemplates 比较两个模板或模板版本。
+// 参数 a、b 为模板ID，可以用 "<id>@<version>" 指定历史版本。
+func (h *TemplateHandler) DiffTemplates(c *gin.Context) {
+	a, ok := parseTemplateRef(c, "a")
+	if !ok {
+		return
+	}
+	b, ok := parseTemplateRef(c, "b")
+	if !ok {
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	diff, err := h.service.DiffTemplates(a, b, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// PreviewTemplateDiff 预览更新请求相对模板当前版本的差异，不保存修改。
+// 参数 a 为模板ID，请求体与 PUT /api/templates/:id 相同。
+func (h *TemplateHandler) PreviewTemplateDiff(c *gin.Context) {
+	a, ok := parseTemplateRef(c, "a")
+	if !ok {
+		return
+	}
+	if a.Version != nil {
+		respondError(c, http.StatusBadRequest, "update previews are always compared against the current version")
+		return
+	}
+
+	var req models.UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	diff, err := h.service.PreviewTemplateUpdate(a.ID, req, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// parseTemplateRef 解析 "<id>" 或 "<id>@<version>" 形式的查询参数，失败时已写入错误响应
+func parseTemplateRef(c *gin.Context, key string) (models.TemplateRef, bool) {
+	value := strings.TrimSpace(c.Query(key))
+	if value == "" {
+		respondError(c, http.StatusBadRequest, "query parameter "+key+" is required")
+		return models.TemplateRef{}, false
+	}
+
+	idStr, versionStr, hasVersion := strings.Cut(value, "@")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid template ID in "+key)
+		return models.TemplateRef{}, false
+	}
+
+	ref := models.TemplateRef{ID: id}
+	if hasVersion {
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version < 1 {
+			respondError(c, http.StatusBadRequest, "invalid version number in "+key)
+			return models.TemplateRef{}, false
+		}
+		ref.Version = &version
+	}
+	return ref, true
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"prompt-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetTemplateRuns 获取模板的生成记录
+func (h *TemplateHandler) GetTemplateRuns(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid template ID")
+		return
+	}
+	page, pageSize := parsePagination(c)
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	runs, err := h.service.GetTemplateRuns(id, page, pageSize, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      runs,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetRun 获取单条生成记录
+func (h *TemplateHandler) GetRun(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid run ID")
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	run, err := h.service.GetRun(id, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"prompt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler 内部组件运行指标处理器
+type MetricsHandler struct {
+	usage *services.UsageRecorder
+}
+
+// NewMetricsHandler 创建运行指标处理器
+func NewMetricsHandler(usage *services.UsageRecorder) *MetricsHandler {
+	return &MetricsHandler{usage: usage}
+}
+
+// UsageRecorder 使用次数记录器的运行指标（待写入、已写入的计数和刷新情况）
+func (h *MetricsHandler) UsageRecorder(c *gin.Context) {
+	c.JSON(http.StatusOK, h.usage.Metrics())
+}
@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,3 +25,32 @@ func respondInternalError(c *gin.Context, err error) {
 	log.Printf("internal error: %v", err)
 	respondError(c, http.StatusInternalServerError, "internal server error")
 }
+
+// respondVariableErrors 返回逐个变量的校验错误
+func respondVariableErrors(c *gin.Context, errs models.VariableErrors) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   http.StatusText(http.StatusBadRequest),
+		"message": errs.Error(),
+		"errors":  errs,
+	})
+}
+
+// respondTemplateError 将模板服务返回的错误映射为对应的 HTTP 状态码
+func respondTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		respondError(c, http.StatusNotFound, "template not found")
+	case errors.Is(err, services.ErrVersionNotFound):
+		respondError(c, http.StatusNotFound, "template version not found")
+	case errors.Is(err, services.ErrRunNotFound):
+		respondError(c, http.StatusNotFound, "generation run not found")
+	case errors.Is(err, services.ErrForbidden):
+		respondError(c, http.StatusForbidden, "you do not have permission to modify this template")
+	case errors.Is(err, services.ErrSlugTaken):
+		respondError(c, http.StatusConflict, "slug already in use")
+	case errors.Is(err, services.ErrInvalidTemplate):
+		respondError(c, http.StatusBadRequest, err.Error())
+	default:
+		respondInternalError(c, err)
+	}
+}
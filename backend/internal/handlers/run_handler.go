@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"prompt-backend/internal/llm"
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunHandler 模板运行处理器
+type RunHandler struct {
+	service *services.RunService
+}
+
+// NewRunHandler 创建模板运行处理器
+func NewRunHandler(service *services.RunService) *RunHandler {
+	return &RunHandler{service: service}
+}
+
+// Run 渲染模板并返回模型的输出
+func (h *RunHandler) Run(c *gin.Context) {
+	var req models.RunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		var variableErrs models.VariableErrors
+		if errors.As(err, &variableErrs) {
+			respondVariableErrors(c, variableErrs)
+			return
+		}
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	resp, err := h.service.Run(c.Request.Context(), req, viewer)
+	if err != nil {
+		respondRunError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// runHeartbeatInterval 流式输出时无新内容的情况下发送心跳的间隔，避免代理断开空闲连接
+const runHeartbeatInterval = 15 * time.Second
+
+// RunStream 渲染模板并以 SSE 流式返回模型输出。
+// 事件依次为 prompt（发送给模型的内容）、若干 delta、最后的 done（完整结果和用量）或 error，
+// 期间定期发送 ping。客户端断开时中止对模型的请求。
+func (h *RunHandler) RunStream(c *gin.Context) {
+	var req models.RunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, "invalid request payload")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		var variableErrs models.VariableErrors
+		if errors.As(err, &variableErrs) {
+			respondVariableErrors(c, variableErrs)
+			return
+		}
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	viewer, _ := middleware.CurrentIdentity(c)
+	stream, err := h.service.Stream(ctx, req, viewer)
+	if err != nil {
+		respondRunError(c, err)
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	send := func(event string, data interface{}) {
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+	send("prompt", stream.Rendered)
+
+	heartbeat := time.NewTicker(runHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case delta, ok := <-stream.Deltas:
+			if !ok {
+				resp, err := stream.Result()
+				if err != nil {
+					status, message := runErrorStatus(err)
+					log.Printf("run stream: %v", err)
+					send("error", gin.H{"error": http.StatusText(status), "message": message})
+					return
+				}
+				send("done", resp)
+				return
+			}
+			send("delta", gin.H{"content": delta})
+		case <-heartbeat.C:
+			send("ping", gin.H{})
+		case <-ctx.Done():
+			// 客户端已断开，后台请求随 ctx 取消
+			return
+		}
+	}
+}
+
+// respondRunError 在模板错误之外处理模型服务相关的错误
+func respondRunError(c *gin.Context, err error) {
+	var variableErrs models.VariableErrors
+	switch {
+	case errors.As(err, &variableErrs):
+		respondVariableErrors(c, variableErrs)
+	case errors.Is(err, llm.ErrNotConfigured):
+		respondError(c, http.StatusServiceUnavailable, "llm provider is not configured")
+	case errors.Is(err, services.ErrModelNotAllowed):
+		respondError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrProviderFailed):
+		log.Printf("run: %v", err)
+		status, message := runErrorStatus(err)
+		respondError(c, status, message)
+	default:
+		respondTemplateError(c, err)
+	}
+}
+
+// runErrorStatus 模型调用失败对应的状态码：超时为 504，其他为 502
+func runErrorStatus(err error) (int, string) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout, "llm request timed out"
+	}
+	return http.StatusBadGateway, "llm request failed"
+}
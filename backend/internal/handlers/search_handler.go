@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchTemplates 全文检索模板
+// 查询参数：q（必填）、category、public（为 true 时只检索公开模板）、page、page_size
+func (h *TemplateHandler) SearchTemplates(c *gin.Context) {
+	q := models.TemplateSearchQuery{Query: c.Query("q"), Category: c.Query("category")}
+	if value := c.Query("public"); value != "" {
+		publicOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "invalid public value")
+			return
+		}
+		q.PublicOnly = publicOnly
+	}
+	if err := q.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, pageSize := parsePagination(c)
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	results, total, err := h.service.SearchTemplates(q, page, pageSize, viewer)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      results,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
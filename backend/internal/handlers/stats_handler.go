@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// 未指定 from 时默认查询的时间范围
+var defaultStatsRange = map[string]time.Duration{
+	models.StatsIntervalHour: 48 * time.Hour,
+	models.StatsIntervalDay:  30 * 24 * time.Hour,
+}
+
+// GetTemplateStats 获取模板的使用统计
+// 查询参数：interval（hour|day，默认 day）、from、to（RFC 3339 或 YYYY-MM-DD，默认截至当前）
+func (h *TemplateHandler) GetTemplateStats(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid template ID")
+		return
+	}
+	q, err := parseStatsQuery(c, c.DefaultQuery("interval", models.StatsIntervalDay))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	stats, err := h.service.GetTemplateStats(id, q, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetTopTemplates 获取生成次数最多的模板
+// 查询参数：from、to（默认最近 7 天）、limit（默认 10，最大 50）
+func (h *TemplateHandler) GetTopTemplates(c *gin.Context) {
+	from, to, err := parseStatsRange(c, 7*24*time.Hour)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	q := models.StatsQuery{Interval: models.StatsIntervalDay, From: from, To: to}
+	if err := q.Validate(); err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+	if limit > models.MaxTopTemplates {
+		limit = models.MaxTopTemplates
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	usage, err := h.service.GetTopTemplates(q.From, q.To, limit, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": usage,
+		"from": q.From,
+		"to":   q.To,
+	})
+}
+
+func parseStatsQuery(c *gin.Context, interval string) (models.StatsQuery, error) {
+	defaultRange, ok := defaultStatsRange[interval]
+	if !ok {
+		return models.StatsQuery{}, fmt.Errorf("unsupported interval %q (expected hour or day)", interval)
+	}
+	from, to, err := parseStatsRange(c, defaultRange)
+	if err != nil {
+		return models.StatsQuery{}, err
+	}
+	q := models.StatsQuery{Interval: interval, From: from, To: to}
+	return q, q.Validate()
+}
+
+// parseStatsRange 解析 from/to 查询参数，未指定时 to 为当前时间，from 为 to 之前 defaultRange
+func parseStatsRange(c *gin.Context, defaultRange time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if value := c.Query("to"); value != "" {
+		parsed, err := parseStatsTime(value)
+		if err != nil {
+			return to, to, fmt.Errorf("invalid to: %q", value)
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultRange)
+	if value := c.Query("from"); value != "" {
+		parsed, err := parseStatsTime(value)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid from: %q", value)
+		}
+		from = parsed
+	}
+	return from, to, nil
+}
+
+func parseStatsTime(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
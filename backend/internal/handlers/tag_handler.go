@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTags 获取标签及其模板数，用于标签云
+// 查询参数：public（为 true 时只统计公开模板）、limit（默认 100，最大 500）
+func (h *TemplateHandler) GetTags(c *gin.Context) {
+	publicOnly := false
+	if value := c.Query("public"); value != "" {
+		var err error
+		if publicOnly, err = strconv.ParseBool(value); err != nil {
+			respondError(c, http.StatusBadRequest, "invalid public value")
+			return
+		}
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 {
+		limit = 100
+	}
+	if limit > models.MaxTagCounts {
+		limit = models.MaxTagCounts
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	tags, err := h.service.GetTagCounts(publicOnly, limit, viewer)
+	if err != nil {
+		respondInternalError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tags})
+}
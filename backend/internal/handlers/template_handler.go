@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"prompt-backend/internal/middleware"
 	"prompt-backend/internal/models"
 	"prompt-backend/internal/services"
 
@@ -30,29 +33,29 @@ func (h *TemplateHandler) Generate(c *gin.Context) {
 		return
 	}
 	if err := req.Validate(); err != nil {
+		var variableErrs models.VariableErrors
+		if errors.As(err, &variableErrs) {
+			respondVariableErrors(c, variableErrs)
+			return
+		}
 		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	result, err := h.service.GeneratePrompt(req.TemplateID, req.Variables)
+	viewer, _ := middleware.CurrentIdentity(c)
+	resp, err := h.service.GeneratePrompt(req, viewer)
 	if err != nil {
-		// 如果是模板内容或解析相关错误，返回 400 并显示错误信息
-		if strings.Contains(err.Error(), "template not found") {
-			respondError(c, http.StatusNotFound, "template not found")
-			return
-		}
-		if strings.Contains(err.Error(), "invalid template content") || strings.Contains(err.Error(), "unexpected") || strings.Contains(err.Error(), "parse") {
-			respondError(c, http.StatusBadRequest, err.Error())
+		// 变量校验错误逐项返回，模板语法错误等由 respondTemplateError 映射为 4xx
+		var variableErrs models.VariableErrors
+		if errors.As(err, &variableErrs) {
+			respondVariableErrors(c, variableErrs)
 			return
 		}
-		respondInternalError(c, err)
+		respondTemplateError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.GenerateResponse{
-		Result: result,
-		Prompt: result,
-	})
+	c.JSON(http.StatusOK, resp)
 }
 
 // CreateTemplate 创建模板
@@ -67,12 +70,16 @@ func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
 		return
 	}
 
-	// 从上下文中获取用户ID（需要认证中间件）
-	userID := uuid.New() // 临时使用，实际应该从认证上下文中获取
+	// 从认证中间件写入的上下文中获取调用方身份
+	creator, ok := middleware.CurrentIdentity(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "authentication required")
+		return
+	}
 
-	template, err := h.service.CreateTemplate(req, userID)
+	template, err := h.service.CreateTemplate(req, creator)
 	if err != nil {
-		respondInternalError(c, err)
+		respondTemplateError(c, err)
 		return
 	}
 
@@ -88,9 +95,10 @@ func (h *TemplateHandler) GetTemplate(c *gin.Context) {
 		return
 	}
 
-	template, err := h.service.GetTemplate(id)
+	viewer, _ := middleware.CurrentIdentity(c)
+	template, err := h.service.GetTemplate(id, viewer)
 	if err != nil {
-		respondError(c, http.StatusNotFound, "template not found")
+		respondTemplateError(c, err)
 		return
 	}
 
@@ -99,88 +107,91 @@ func (h *TemplateHandler) GetTemplate(c *gin.Context) {
 
 // GetTemplates 获取模板列表
 func (h *TemplateHandler) GetTemplates(c *gin.Context) {
-	category := c.Query("category")
-	if err := models.ValidateCategoryValue(category); err != nil {
+	filter, err := parseTemplateFilter(c)
+	if err != nil {
 		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	pageStr := c.DefaultQuery("page", "1")
-	pageSizeStr := c.DefaultQuery("page_size", "20")
-
-	page, err := strconv.Atoi(pageStr)
+	sort, cursor, err := parseTemplateOrder(c)
 	if err != nil {
-		page = 1
-	}
-	if page < 1 {
-		page = 1
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
 	}
+	page, pageSize := parsePagination(c)
 
-	pageSize, err := strconv.Atoi(pageSizeStr)
+	viewer, _ := middleware.CurrentIdentity(c)
+	result, err := h.service.GetTemplates(filter, page, pageSize, sort, cursor, viewer)
 	if err != nil {
-		pageSize = 20
+		respondInternalError(c, err)
+		return
 	}
-	if pageSize < 1 {
-		pageSize = 20
+
+	respondTemplatePage(c, result, page, pageSize)
+}
+
+// GetMyTemplates 获取当前用户的模板
+func (h *TemplateHandler) GetMyTemplates(c *gin.Context) {
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		respondError(c, http.StatusUnauthorized, "authentication required")
+		return
 	}
-	if pageSize > 100 {
-		pageSize = 100
+	filter, err := parseTemplateFilter(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	sort, cursor, err := parseTemplateOrder(c)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
 	}
+	page, pageSize := parsePagination(c)
 
-	templates, err := h.service.GetTemplates(category, page, pageSize)
+	result, err := h.service.GetUserTemplates(userID, filter, page, pageSize, sort, cursor)
 	if err != nil {
 		respondInternalError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":      templates,
-		"page":      page,
-		"page_size": pageSize,
-		"total":     len(templates),
-	})
+	respondTemplatePage(c, result, page, pageSize)
 }
 
 // GetPublicTemplates 获取公开模板
 func (h *TemplateHandler) GetPublicTemplates(c *gin.Context) {
-	category := c.Query("category")
-	if err := models.ValidateCategoryValue(category); err != nil {
+	filter, err := parseTemplateFilter(c)
+	if err != nil {
 		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
-	pageStr := c.DefaultQuery("page", "1")
-	pageSizeStr := c.DefaultQuery("page_size", "20")
-
-	page, err := strconv.Atoi(pageStr)
-	if err != nil {
-		page = 1
-	}
-	if page < 1 {
-		page = 1
-	}
-
-	pageSize, err := strconv.Atoi(pageSizeStr)
+	sort, cursor, err := parseTemplateOrder(c)
 	if err != nil {
-		pageSize = 20
-	}
-	if pageSize < 1 {
-		pageSize = 20
-	}
-	if pageSize > 100 {
-		pageSize = 100
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
 	}
+	page, pageSize := parsePagination(c)
 
-	templates, err := h.service.GetPublicTemplates(category, page, pageSize)
+	result, err := h.service.GetPublicTemplates(filter, page, pageSize, sort, cursor)
 	if err != nil {
 		respondInternalError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"data":      templates,
+	respondTemplatePage(c, result, page, pageSize)
+}
+
+// respondTemplatePage 返回一页模板，total 为满足筛选条件的总数，还有下一页时附带 next_cursor
+func respondTemplatePage(c *gin.Context, result *models.TemplatePage, page, pageSize int) {
+	resp := gin.H{
+		"data":      result.Templates,
 		"page":      page,
 		"page_size": pageSize,
-		"total":     len(templates),
-	})
+		"total":     result.Total,
+	}
+	if result.NextCursor != "" {
+		resp["next_cursor"] = result.NextCursor
+	}
+	c.JSON(http.StatusOK, resp)
 }
 
 // UpdateTemplate 更新模板
@@ -202,9 +213,10 @@ func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
 		return
 	}
 
-	template, err := h.service.UpdateTemplate(id, req)
+	caller, _ := middleware.CurrentIdentity(c)
+	template, err := h.service.UpdateTemplate(id, req, caller)
 	if err != nil {
-		respondInternalError(c, err)
+		respondTemplateError(c, err)
 		return
 	}
 
@@ -220,8 +232,9 @@ func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteTemplate(id); err != nil {
-		respondInternalError(c, err)
+	caller, _ := middleware.CurrentIdentity(c)
+	if err := h.service.DeleteTemplate(id, caller); err != nil {
+		respondTemplateError(c, err)
 		return
 	}
 
@@ -230,19 +243,97 @@ func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
 
 // ExtractVariables 提取模板中的变量
 func (h *TemplateHandler) ExtractVariables(c *gin.Context) {
+	// 对话模板传 kind=chat 和 messages
 	var body struct {
-		Content string `json:"content" binding:"required"`
+		Content  string              `json:"content"`
+		Kind     string              `json:"kind"`
+		Messages models.ChatMessages `json:"messages"`
 	}
 
 	if err := c.ShouldBindJSON(&body); err != nil {
 		respondError(c, http.StatusBadRequest, "invalid request payload")
 		return
 	}
-	if err := models.ValidateTemplateContent(body.Content); err != nil {
+	if err := models.ValidateTemplateBody(body.Kind, body.Content, body.Messages); err != nil {
 		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	variables := services.ExtractVariables(body.Content)
+	viewer, _ := middleware.CurrentIdentity(c)
+	variables, err := h.service.ExtractVariables(body.Kind, body.Content, body.Messages, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"variables": variables})
 }
+
+// parseTemplateFilter 解析模板列表的筛选参数：category、tags（逗号分隔，可重复）、tag_match（any|all，默认 any）
+func parseTemplateFilter(c *gin.Context) (models.TemplateFilter, error) {
+	filter := models.TemplateFilter{Category: c.Query("category"), TagMatch: c.Query("tag_match")}
+	for _, value := range c.QueryArray("tags") {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				filter.Tags = append(filter.Tags, tag)
+			}
+		}
+	}
+	return filter, filter.Validate()
+}
+
+// templateSortFields 模板列表允许的排序字段及未指定方向时是否倒序
+var templateSortFields = map[string]bool{
+	models.SortCreatedAt:  true,
+	models.SortUpdatedAt:  true,
+	models.SortName:       false,
+	models.SortUsageCount: true,
+}
+
+// parseTemplateOrder 解析排序和游标参数：
+// sort 为 字段 或 字段:asc|desc（默认 created_at:desc），cursor 为上一页返回的 next_cursor，需使用相同的 sort
+func parseTemplateOrder(c *gin.Context) (models.TemplateSort, *models.TemplateCursor, error) {
+	sort := models.DefaultTemplateSort
+	if value := c.Query("sort"); value != "" {
+		field, direction, hasDirection := strings.Cut(value, ":")
+		desc, ok := templateSortFields[field]
+		if !ok {
+			return sort, nil, fmt.Errorf("unsupported sort field %q (expected created_at, updated_at, name or usage_count)", field)
+		}
+		if hasDirection {
+			switch direction {
+			case "asc":
+				desc = false
+			case "desc":
+				desc = true
+			default:
+				return sort, nil, fmt.Errorf("unsupported sort direction %q (expected asc or desc)", direction)
+			}
+		}
+		sort = models.TemplateSort{Field: field, Desc: desc}
+	}
+
+	value := c.Query("cursor")
+	if value == "" {
+		return sort, nil, nil
+	}
+	cursor, err := models.DecodeTemplateCursor(value, sort)
+	return sort, cursor, err
+}
+
+// parsePagination 解析分页参数，非法值回退为默认值
+func parsePagination(c *gin.Context) (int, int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 {
+		pageSize = 20
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	return page, pageSize
+}
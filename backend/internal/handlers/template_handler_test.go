@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/handlers"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// listingTemplates 记录公开模板列表收到的分页请求
+type listingTemplates struct {
+	fakeTemplates
+	pages []models.PageRequest
+}
+
+func (f *listingTemplates) GetPublicTemplates(_ models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error) {
+	f.pages = append(f.pages, page)
+	return &models.TemplatePage{Templates: []models.PromptTemplate{}}, nil
+}
+
+func TestTemplateListSort(t *testing.T) {
+	nameCursor := models.NewTemplateCursor(models.TemplateSort{Field: models.SortName}, &models.PromptTemplate{ID: uuid.New(), Name: "a"}).Encode()
+
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    models.TemplateSort
+		errPart string // 不为空时期望 400
+	}{
+		{"default", nil, models.DefaultTemplateSort, ""},
+		{"created_at defaults to descending", url.Values{"sort": {"created_at"}}, models.TemplateSort{Field: models.SortCreatedAt, Desc: true}, ""},
+		{"updated_at defaults to descending", url.Values{"sort": {"updated_at"}}, models.TemplateSort{Field: models.SortUpdatedAt, Desc: true}, ""},
+		{"usage_count defaults to descending", url.Values{"sort": {"usage_count"}}, models.TemplateSort{Field: models.SortUsageCount, Desc: true}, ""},
+		{"name defaults to ascending", url.Values{"sort": {"name"}}, models.TemplateSort{Field: models.SortName}, ""},
+		{"explicit ascending", url.Values{"sort": {"usage_count:asc"}}, models.TemplateSort{Field: models.SortUsageCount}, ""},
+		{"explicit descending", url.Values{"sort": {"name:desc"}}, models.TemplateSort{Field: models.SortName, Desc: true}, ""},
+		{"cursor with matching sort", url.Values{"sort": {"name"}, "cursor": {nameCursor}}, models.TemplateSort{Field: models.SortName}, ""},
+
+		{"column outside the allowlist", url.Values{"sort": {"password_hash"}}, models.TemplateSort{}, "password_hash"},
+		{"sql injection", url.Values{"sort": {"name; DROP TABLE users"}}, models.TemplateSort{}, "unsupported sort field"},
+		{"field is case sensitive", url.Values{"sort": {"Name"}}, models.TemplateSort{}, "unsupported sort field"},
+		{"empty field", url.Values{"sort": {":asc"}}, models.TemplateSort{}, "unsupported sort field"},
+		{"unknown direction", url.Values{"sort": {"name:up"}}, models.TemplateSort{}, "unsupported sort direction"},
+		{"empty direction", url.Values{"sort": {"name:"}}, models.TemplateSort{}, "unsupported sort direction"},
+		{"cursor from another sort", url.Values{"sort": {"name:desc"}, "cursor": {nameCursor}}, models.TemplateSort{}, "cursor was created for sort"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			repo := &listingTemplates{}
+			handler := handlers.NewTemplateHandler(services.NewTemplateService(repo, nil, nil, nil))
+			router := gin.New()
+			router.GET("/templates", handler.GetPublicTemplates)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/templates?"+tt.query.Encode(), nil))
+
+			if tt.errPart != "" {
+				if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.errPart) {
+					t.Fatalf("status %d body %s, want 400 mentioning %q", w.Code, w.Body, tt.errPart)
+				}
+				if len(repo.pages) != 0 {
+					t.Error("rejected request reached the repository")
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d body %s", w.Code, w.Body)
+			}
+			if len(repo.pages) != 1 || repo.pages[0].Sort != tt.want {
+				t.Fatalf("repository got %+v, want sort %s", repo.pages, tt.want)
+			}
+			if (tt.query.Get("cursor") != "") != (repo.pages[0].Cursor != nil) {
+				t.Errorf("cursor = %+v", repo.pages[0].Cursor)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"prompt-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetTemplateVersions 获取模板的版本历史
+func (h *TemplateHandler) GetTemplateVersions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid template ID")
+		return
+	}
+	page, pageSize := parsePagination(c)
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	versions, err := h.service.GetTemplateVersions(id, page, pageSize, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      versions,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// GetTemplateVersion 获取模板的指定版本
+func (h *TemplateHandler) GetTemplateVersion(c *gin.Context) {
+	id, version, ok := parseVersionParams(c)
+	if !ok {
+		return
+	}
+
+	viewer, _ := middleware.CurrentIdentity(c)
+	snapshot, err := h.service.GetTemplateVersion(id, version, viewer)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// RestoreTemplateVersion 回滚模板到指定版本
+func (h *TemplateHandler) RestoreTemplateVersion(c *gin.Context) {
+	id, version, ok := parseVersionParams(c)
+	if !ok {
+		return
+	}
+
+	caller, _ := middleware.CurrentIdentity(c)
+	template, err := h.service.RestoreTemplateVersion(id, version, caller)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// parseVersionParams 解析路径中的模板ID和版本号，失败时已写入错误响应
+func parseVersionParams(c *gin.Context) (uuid.UUID, int, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "invalid template ID")
+		return uuid.Nil, 0, false
+	}
+	version, err := strconv.Atoi(c.Param("n"))
+	if err != nil || version < 1 {
+		respondError(c, http.StatusBadRequest, "invalid version number")
+		return uuid.Nil, 0, false
+	}
+	return id, version, true
+}
@@ -0,0 +1,269 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"prompt-backend/internal/models"
+)
+
+const (
+	defaultBaseURL = "https://api.openai.com/v1"
+	defaultModel   = "gpt-4o-mini"
+	defaultTimeout = 60 * time.Second
+	// maxResponseBytes 非流式响应体的最大长度
+	maxResponseBytes = 10 << 20
+	// maxStreamLineBytes 流式响应中单个事件的最大长度
+	maxStreamLineBytes = 1 << 20
+)
+
+// OpenAIProvider 调用 OpenAI 兼容的 /chat/completions 接口，
+// 通过 BaseURL 可以接入其他兼容服务或本地的模拟服务
+type OpenAIProvider struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+	// streamClient 不限制整体耗时（输出可能持续较长时间），只限制等待响应头的时间
+	streamClient *http.Client
+}
+
+// NewOpenAIProvider 创建 OpenAI 兼容的模型服务，baseURL/model 为空时使用默认值
+func NewOpenAIProvider(baseURL, apiKey, model string, timeout time.Duration) *OpenAIProvider {
+	if baseURL == "" {
+		baseURL = defaultBaseURL
+	}
+	if model == "" {
+		model = defaultModel
+	}
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = timeout
+	return &OpenAIProvider{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		apiKey:       apiKey,
+		model:        model,
+		client:       &http.Client{Timeout: timeout},
+		streamClient: &http.Client{Transport: transport},
+	}
+}
+
+// NewProviderFromEnv 从环境变量创建模型服务（LLM_BASE_URL、LLM_API_KEY、LLM_MODEL、LLM_TIMEOUT）。
+// LLM_BASE_URL 和 LLM_API_KEY 都未设置时返回 nil，表示未启用模型调用。
+func NewProviderFromEnv() (Provider, error) {
+	baseURL := strings.TrimSpace(os.Getenv("LLM_BASE_URL"))
+	apiKey := strings.TrimSpace(os.Getenv("LLM_API_KEY"))
+	if baseURL == "" && apiKey == "" {
+		return nil, nil
+	}
+
+	timeout := defaultTimeout
+	if value := strings.TrimSpace(os.Getenv("LLM_TIMEOUT")); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LLM_TIMEOUT: %w", err)
+		}
+		timeout = parsed
+	}
+	return NewOpenAIProvider(baseURL, apiKey, strings.TrimSpace(os.Getenv("LLM_MODEL")), timeout), nil
+}
+
+// AllowedModelsFromEnv 从 LLM_ALLOWED_MODELS（逗号分隔）读取调用方可以指定的模型。
+// 未设置时只允许默认模型（LLM_MODEL，未设置时为 gpt-4o-mini），避免调用方选用更昂贵的模型。
+func AllowedModelsFromEnv() []string {
+	var allowed []string
+	for _, model := range strings.Split(os.Getenv("LLM_ALLOWED_MODELS"), ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			allowed = append(allowed, model)
+		}
+	}
+	if len(allowed) > 0 {
+		return allowed
+	}
+	if model := strings.TrimSpace(os.Getenv("LLM_MODEL")); model != "" {
+		return []string{model}
+	}
+	return []string{defaultModel}
+}
+
+type chatCompletionRequest struct {
+	Model         string               `json:"model"`
+	Messages      []models.ChatMessage `json:"messages"`
+	MaxTokens     *int                 `json:"max_tokens,omitempty"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *streamOptions       `json:"stream_options,omitempty"`
+}
+
+type streamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type chatCompletionResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message      models.ChatMessage `json:"message"`
+		FinishReason string             `json:"finish_reason"`
+	} `json:"choices"`
+	Usage models.TokenUsage `json:"usage"`
+}
+
+// chatCompletionChunk 流式响应中的一个事件，最后一个事件只包含 usage
+type chatCompletionChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *models.TokenUsage `json:"usage"`
+}
+
+type errorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Complete 发送对话补全请求
+func (p *OpenAIProvider) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := p.post(ctx, p.client, req, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body chatCompletionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid llm response: %w", err)
+	}
+	if len(body.Choices) == 0 {
+		return nil, errors.New("invalid llm response: no choices")
+	}
+	return &Response{
+		Content:      body.Choices[0].Message.Content,
+		Model:        body.Model,
+		FinishReason: body.Choices[0].FinishReason,
+		Usage:        body.Usage,
+	}, nil
+}
+
+// Stream 以 SSE 方式请求补全，并要求服务端在最后返回用量。
+// 连接在收到 data: [DONE] 或 finish_reason 之前结束时返回 ErrStreamTruncated，不把部分输出当作成功结果。
+func (p *OpenAIProvider) Stream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error) {
+	resp, err := p.post(ctx, p.streamClient, req, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &Response{}
+	var content strings.Builder
+	// completed 为是否收到了 [DONE] 或 finish_reason
+	completed := false
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineBytes)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			// 空行、注释和 event/id 字段
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			completed = true
+			break
+		}
+
+		var chunk chatCompletionChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("invalid llm stream event: %w", err)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.Usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				result.FinishReason = *choice.FinishReason
+				completed = true
+			}
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !completed {
+		return nil, fmt.Errorf("%w after %d bytes of output", ErrStreamTruncated, content.Len())
+	}
+
+	result.Content = content.String()
+	return result, nil
+}
+
+// post 发送请求，非 2xx 响应转换为 *APIError
+func (p *OpenAIProvider) post(ctx context.Context, client *http.Client, req Request, stream bool) (*http.Response, error) {
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+	body := chatCompletionRequest{
+		Model:       model,
+		Messages:    req.Messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      stream,
+	}
+	if stream {
+		body.StreamOptions = &streamOptions{IncludeUsage: true}
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		var errBody errorResponse
+		if json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&errBody) == nil {
+			apiErr.Message = errBody.Error.Message
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"prompt-backend/internal/models"
+)
+
+func TestOpenAIStream(t *testing.T) {
+	const (
+		hello  = `data: {"model":"m","choices":[{"delta":{"content":"Hel"},"finish_reason":null}]}`
+		world  = `data: {"model":"m","choices":[{"delta":{"content":"lo"},"finish_reason":null}]}`
+		finish = `data: {"model":"m","choices":[{"delta":{},"finish_reason":"stop"}]}`
+		usage  = `data: {"model":"m","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`
+		done   = `data: [DONE]`
+	)
+
+	tests := []struct {
+		name       string
+		events     []string
+		wantErr    error
+		wantFinish string
+	}{
+		{"complete", []string{hello, world, finish, usage, done}, nil, "stop"},
+		{"done without finish_reason", []string{hello, world, done}, nil, ""},
+		{"finish_reason without done", []string{hello, world, finish}, nil, "stop"},
+		{"truncated mid-stream", []string{hello, world}, ErrStreamTruncated, ""},
+		{"empty stream", nil, ErrStreamTruncated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, event := range tt.events {
+					fmt.Fprintf(w, "%s\n\n", event)
+				}
+			}))
+			defer server.Close()
+
+			provider := NewOpenAIProvider(server.URL, "key", "", time.Second)
+			var deltas []string
+			resp, err := provider.Stream(context.Background(), Request{Messages: []models.ChatMessage{{Role: "user", Content: "hi"}}}, func(delta string) error {
+				deltas = append(deltas, delta)
+				return nil
+			})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			if resp.Content != "Hello" || strings.Join(deltas, "|") != "Hel|lo" {
+				t.Errorf("content = %q, deltas = %v", resp.Content, deltas)
+			}
+			if resp.FinishReason != tt.wantFinish {
+				t.Errorf("finish reason = %q, want %q", resp.FinishReason, tt.wantFinish)
+			}
+		})
+	}
+}
+
+func TestAllowedModelsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed string
+		model   string
+		want    []string
+	}{
+		{"default model", "", "", []string{defaultModel}},
+		{"configured model", "", "gpt-4o", []string{"gpt-4o"}},
+		{"list", " gpt-4o-mini , gpt-4o,,", "gpt-4o-mini", []string{"gpt-4o-mini", "gpt-4o"}},
+		{"blank list", " , ", "gpt-4o", []string{"gpt-4o"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("LLM_ALLOWED_MODELS", tt.allowed)
+			t.Setenv("LLM_MODEL", tt.model)
+			if got := AllowedModelsFromEnv(); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("AllowedModelsFromEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
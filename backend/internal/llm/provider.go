@@ -0,0 +1,53 @@
+// Package llm 封装对大模型接口的调用
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"prompt-backend/internal/models"
+)
+
+// ErrNotConfigured 未配置模型服务
+var ErrNotConfigured = errors.New("llm provider is not configured")
+
+// ErrStreamTruncated 流式响应在结束标记（data: [DONE] 或 finish_reason）之前断开，输出不完整
+var ErrStreamTruncated = errors.New("llm stream ended before completion")
+
+// Request 一次对话补全请求，Model 为空时使用提供方的默认模型
+type Request struct {
+	Model       string
+	Messages    []models.ChatMessage
+	MaxTokens   *int
+	Temperature *float64
+}
+
+// Response 对话补全结果
+type Response struct {
+	Content      string
+	Model        string
+	FinishReason string
+	Usage        models.TokenUsage
+}
+
+// Provider 模型服务
+type Provider interface {
+	Complete(ctx context.Context, req Request) (*Response, error)
+	// Stream 以流式方式请求补全，每收到一段输出调用一次 onDelta；
+	// onDelta 返回错误时中止请求。返回的 Response 包含完整输出和用量。
+	Stream(ctx context.Context, req Request, onDelta func(delta string) error) (*Response, error)
+}
+
+// APIError 模型服务返回的错误响应
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("llm provider returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("llm provider returned status %d: %s", e.StatusCode, e.Message)
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"prompt-backend/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const identityContextKey = "auth.identity"
+
+const apiKeyHeader = "X-API-Key"
+
+// Authenticator 校验凭证并返回调用方身份
+type Authenticator interface {
+	Authenticate(token string) (*auth.Identity, error)
+	AuthenticateAPIKey(key string) (*auth.Identity, error)
+}
+
+// Auth 要求请求携带有效的 Bearer 令牌或 API 密钥，并将调用方身份写入 gin.Context。
+// API 密钥可通过 X-API-Key 头或 "Authorization: Bearer pk_..." 传递。
+func Auth(authenticator Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if credential(c) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if !authenticate(c, authenticator) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// OptionalAuth 在请求携带凭证时校验并写入调用方身份，未携带凭证时以匿名身份继续。
+// 携带了无效凭证的请求仍会被拒绝，避免客户端误以为自己已登录。
+func OptionalAuth(authenticator Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if credential(c) != "" && !authenticate(c, authenticator) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin 要求调用方为管理员，需放在 Auth 之后
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		identity, ok := CurrentIdentity(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+			return
+		}
+		if !identity.IsAdmin() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticate 校验凭证并写入身份，失败时中止请求并返回 false
+func authenticate(c *gin.Context, authenticator Authenticator) bool {
+	cred := credential(c)
+
+	var identity *auth.Identity
+	var err error
+	if auth.IsAPIKey(cred) {
+		identity, err = authenticator.AuthenticateAPIKey(cred)
+	} else {
+		identity, err = authenticator.Authenticate(cred)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired credentials"})
+			return false
+		}
+		log.Printf("authentication error: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": http.StatusText(http.StatusInternalServerError)})
+		return false
+	}
+
+	c.Set(identityContextKey, identity)
+	return true
+}
+
+// CurrentIdentity 获取当前请求的调用方身份
+func CurrentIdentity(c *gin.Context) (*auth.Identity, bool) {
+	value, ok := c.Get(identityContextKey)
+	if !ok {
+		return nil, false
+	}
+	identity, ok := value.(*auth.Identity)
+	return identity, ok && identity != nil
+}
+
+// CurrentUserID 获取当前请求的用户ID
+func CurrentUserID(c *gin.Context) (uuid.UUID, bool) {
+	identity, ok := CurrentIdentity(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+	return identity.UserID, true
+}
+
+// credential 获取请求携带的凭证，X-API-Key 优先于 Authorization 头
+func credential(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader(apiKeyHeader)); key != "" {
+		return key
+	}
+	return bearerToken(c)
+}
+
+func bearerToken(c *gin.Context) string {
+	header := strings.TrimSpace(c.GetHeader("Authorization"))
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,217 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/middleware"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+type fakeUsers struct {
+	byID map[uuid.UUID]*models.User
+}
+
+func (f *fakeUsers) Create(user *models.User) error {
+	f.byID[user.ID] = user
+	return nil
+}
+
+func (f *fakeUsers) GetByID(id uuid.UUID) (*models.User, error) {
+	if user, ok := f.byID[id]; ok {
+		return user, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeUsers) GetByEmail(email string) (*models.User, error) {
+	for _, user := range f.byID {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+type fakeAPIKeys struct {
+	byHash  map[string]*models.APIKey
+	lookups []string
+}
+
+func (f *fakeAPIKeys) Create(key *models.APIKey) error {
+	f.byHash[key.KeyHash] = key
+	return nil
+}
+
+func (f *fakeAPIKeys) GetByHash(hash string) (*models.APIKey, error) {
+	f.lookups = append(f.lookups, hash)
+	if key, ok := f.byHash[hash]; ok {
+		return key, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeAPIKeys) ListByUserID(userID uuid.UUID) ([]models.APIKey, error) { return nil, nil }
+
+func (f *fakeAPIKeys) CountByUserID(userID uuid.UUID) (int64, error) { return 0, nil }
+
+func (f *fakeAPIKeys) DeleteByOwner(id, userID uuid.UUID) error { return nil }
+
+func (f *fakeAPIKeys) TouchLastUsed(id uuid.UUID, at time.Time) error { return nil }
+
+type authFixture struct {
+	router  *gin.Engine
+	tokens  *auth.TokenManager
+	apiKeys *fakeAPIKeys
+	user    *models.User
+	member  *models.User
+	apiKey  string
+}
+
+func newAuthFixture(t *testing.T) *authFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	user := &models.User{ID: uuid.New(), Email: "admin@example.com", Role: models.RoleAdmin}
+	member := &models.User{ID: uuid.New(), Email: "member@example.com", Role: models.RoleUser}
+	users := &fakeUsers{byID: map[uuid.UUID]*models.User{user.ID: user, member.ID: member}}
+	apiKeys := &fakeAPIKeys{byHash: map[string]*models.APIKey{}}
+	tokens := auth.NewTokenManager([]byte(testSecret), time.Hour)
+	service := services.NewAuthService(users, apiKeys, tokens)
+
+	created, err := service.CreateAPIKey(user.ID, models.CreateAPIKeyRequest{Name: "ci"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	router := gin.New()
+	whoami := func(c *gin.Context) {
+		identity, ok := middleware.CurrentIdentity(c)
+		if !ok {
+			c.String(http.StatusOK, "anonymous")
+			return
+		}
+		c.String(http.StatusOK, identity.UserID.String()+" "+identity.Role)
+	}
+	router.GET("/required", middleware.Auth(service), whoami)
+	router.GET("/optional", middleware.OptionalAuth(service), whoami)
+	router.GET("/admin", middleware.Auth(service), middleware.RequireAdmin(), whoami)
+
+	return &authFixture{router: router, tokens: tokens, apiKeys: apiKeys, user: user, member: member, apiKey: created.Key}
+}
+
+func (f *authFixture) do(path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthCredentials(t *testing.T) {
+	f := newAuthFixture(t)
+	token, _, err := f.tokens.Issue(auth.Identity{UserID: f.member.ID, Role: models.RoleUser})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	// 签发时为管理员、之后被降级的用户，以及已删除的用户
+	demoted, _, err := f.tokens.Issue(auth.Identity{UserID: f.member.ID, Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	deleted, _, err := f.tokens.Issue(auth.Identity{UserID: uuid.New(), Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	expired, err := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   f.user.ID.String(),
+			Issuer:    "prompt-template-api",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		},
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret, _, _ := auth.NewTokenManager([]byte("ffffffffffffffffffffffffffffffff"), time.Hour).Issue(auth.Identity{UserID: f.user.ID})
+	// JWT 与 API 密钥的角色都以用户表为准，不信任令牌中签发时的角色
+	tokenIdentity := f.member.ID.String() + " " + models.RoleUser
+	keyIdentity := f.user.ID.String() + " " + models.RoleAdmin
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"no credentials", "/required", nil, http.StatusUnauthorized, ""},
+		{"bearer token", "/required", map[string]string{"Authorization": "Bearer " + token}, http.StatusOK, tokenIdentity},
+		{"lower-case scheme", "/required", map[string]string{"Authorization": "bearer " + token}, http.StatusOK, tokenIdentity},
+		{"non-bearer scheme", "/required", map[string]string{"Authorization": "Basic " + token}, http.StatusUnauthorized, ""},
+		{"expired token", "/required", map[string]string{"Authorization": "Bearer " + expired}, http.StatusUnauthorized, ""},
+		{"token signed with another secret", "/required", map[string]string{"Authorization": "Bearer " + otherSecret}, http.StatusUnauthorized, ""},
+		{"api key header", "/required", map[string]string{"X-API-Key": f.apiKey}, http.StatusOK, keyIdentity},
+		{"api key as bearer", "/required", map[string]string{"Authorization": "Bearer " + f.apiKey}, http.StatusOK, keyIdentity},
+		{"api key header wins", "/required", map[string]string{"X-API-Key": f.apiKey, "Authorization": "Bearer " + token}, http.StatusOK, keyIdentity},
+		{"unknown api key", "/required", map[string]string{"X-API-Key": auth.APIKeyPrefix + "0000"}, http.StatusUnauthorized, ""},
+		{"api key without prefix", "/required", map[string]string{"X-API-Key": f.apiKey[len(auth.APIKeyPrefix):]}, http.StatusUnauthorized, ""},
+		{"optional anonymous", "/optional", nil, http.StatusOK, "anonymous"},
+		{"optional with token", "/optional", map[string]string{"Authorization": "Bearer " + token}, http.StatusOK, tokenIdentity},
+		{"optional rejects invalid credentials", "/optional", map[string]string{"Authorization": "Bearer garbage"}, http.StatusUnauthorized, ""},
+		{"admin without credentials", "/admin", nil, http.StatusUnauthorized, ""},
+		{"admin route with user token", "/admin", map[string]string{"Authorization": "Bearer " + token}, http.StatusForbidden, ""},
+		{"admin route with admin api key", "/admin", map[string]string{"X-API-Key": f.apiKey}, http.StatusOK, keyIdentity},
+		{"demoted admin token", "/required", map[string]string{"Authorization": "Bearer " + demoted}, http.StatusOK, tokenIdentity},
+		{"admin route with demoted admin token", "/admin", map[string]string{"Authorization": "Bearer " + demoted}, http.StatusForbidden, ""},
+		{"deleted user token", "/required", map[string]string{"Authorization": "Bearer " + deleted}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.do(tt.path, tt.headers)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.status, w.Body.String())
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestAPIKeyLookupUsesHash(t *testing.T) {
+	f := newAuthFixture(t)
+	f.apiKeys.lookups = nil
+
+	if w := f.do("/required", map[string]string{"X-API-Key": f.apiKey}); w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if len(f.apiKeys.lookups) != 1 || f.apiKeys.lookups[0] != auth.HashAPIKey(f.apiKey) {
+		t.Fatalf("lookups = %v, want the SHA-256 of the key", f.apiKeys.lookups)
+	}
+	for hash := range f.apiKeys.byHash {
+		if hash == f.apiKey {
+			t.Fatal("plaintext api key stored")
+		}
+	}
+
+	// 不带 pk_ 前缀的凭证按 JWT 校验，不查询密钥表
+	f.apiKeys.lookups = nil
+	f.do("/required", map[string]string{"X-API-Key": f.apiKey[len(auth.APIKeyPrefix):]})
+	if len(f.apiKeys.lookups) != 0 {
+		t.Fatalf("lookups = %v, want none for a credential without the prefix", f.apiKeys.lookups)
+	}
+}
@@ -27,7 +27,7 @@ func CORSFromEnv() gin.HandlerFunc {
 	allowedOrigins := parseListEnv("ALLOWED_ORIGINS", defaultAllowedOrigins)
 	allowCredentials := strings.EqualFold(os.Getenv("ALLOW_CREDENTIALS"), "true")
 	allowedMethods := "GET, POST, PUT, DELETE, OPTIONS"
-	allowedHeaders := "Content-Type, Authorization, Accept, Origin, Cache-Control, X-Requested-With"
+	allowedHeaders := "Content-Type, Authorization, X-API-Key, Accept, Origin, Cache-Control, X-Requested-With"
 
 	return func(c *gin.Context) {
 		origin := c.GetHeader("Origin")
@@ -54,8 +54,25 @@ func CORSFromEnv() gin.HandlerFunc {
 	}
 }
 
-func RequestSizeLimitFromEnv() gin.HandlerFunc {
+// RequestSizeLimitFromEnv 全局请求体大小限制（MAX_BODY_BYTES），
+// exempt 中的路径不受此限制，由对应路由自行设置上限
+func RequestSizeLimitFromEnv(exempt ...string) gin.HandlerFunc {
 	maxBytes := parseInt64Env("MAX_BODY_BYTES", 1<<20)
+	limit := RequestSizeLimit(maxBytes)
+	return func(c *gin.Context) {
+		for _, path := range exempt {
+			if c.Request.URL.Path == path {
+				c.Next()
+				return
+			}
+		}
+		limit(c)
+	}
+}
+
+// DatasetSizeLimitFromEnv 数据集上传的请求体大小限制（MAX_DATASET_BYTES，默认 50MB）
+func DatasetSizeLimitFromEnv() gin.HandlerFunc {
+	maxBytes := parseInt64Env("MAX_DATASET_BYTES", 50<<20)
 	return RequestSizeLimit(maxBytes)
 }
 
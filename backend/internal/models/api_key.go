@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxAPIKeyNameLen  = 100
+	MaxAPIKeysPerUser = 20
+)
+
+// APIKey API 密钥（仅保存哈希，明文只在创建时返回一次）
+type APIKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	KeyHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// CreateAPIKeyRequest 创建 API 密钥请求
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+func (r *CreateAPIKeyRequest) Validate() error {
+	name := strings.TrimSpace(r.Name)
+	if name == "" {
+		return errors.New("name is required")
+	}
+	if len(name) > MaxAPIKeyNameLen {
+		return fmt.Errorf("name too long (max %d)", MaxAPIKeyNameLen)
+	}
+	return nil
+}
+
+// CreateAPIKeyResponse 创建 API 密钥响应
+type CreateAPIKeyResponse struct {
+	*APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// MaxBatchSize 单次批量生成的最大条数
+const MaxBatchSize = 100
+
+// BatchGenerateRequest 批量生成请求，使用同一模板渲染多组变量
+type BatchGenerateRequest struct {
+	TemplateID uuid.UUID           `json:"template_id" binding:"required"`
+	Items      []map[string]string `json:"items" binding:"required"`
+	Version    *int                `json:"version"`
+	Strict     bool                `json:"strict"`
+}
+
+func (r *BatchGenerateRequest) Validate() error {
+	if r.TemplateID == uuid.Nil {
+		return errors.New("template_id is required")
+	}
+	if r.Version != nil && *r.Version < 1 {
+		return errors.New("version must be a positive integer")
+	}
+	if len(r.Items) == 0 {
+		return errors.New("items is required")
+	}
+	if len(r.Items) > MaxBatchSize {
+		return fmt.Errorf("too many items (max %d)", MaxBatchSize)
+	}
+	return nil
+}
+
+// Item 返回第 i 组变量对应的单条生成请求
+func (r *BatchGenerateRequest) Item(i int) GenerateRequest {
+	return GenerateRequest{
+		TemplateID: r.TemplateID,
+		Variables:  r.Items[i],
+		Version:    r.Version,
+		Strict:     r.Strict,
+	}
+}
+
+// BatchGenerateResult 批量生成中单条的结果，成功时包含生成结果，失败时包含错误信息
+type BatchGenerateResult struct {
+	Index int `json:"index"`
+	*GenerateResponse
+	Error string `json:"error,omitempty"`
+	// Errors 为变量校验失败时逐个变量的错误
+	Errors VariableErrors `json:"errors,omitempty"`
+}
+
+// BatchGenerateResponse 批量生成响应，Results 与请求中的 items 一一对应
+type BatchGenerateResponse struct {
+	Results   []BatchGenerateResult `json:"results"`
+	Succeeded int                   `json:"succeeded"`
+	Failed    int                   `json:"failed"`
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// 数据集文件格式
+const (
+	DatasetFormatCSV   = "csv"
+	DatasetFormatJSONL = "jsonl"
+)
+
+// MaxDatasetRows 单个数据集最多渲染的行数
+const MaxDatasetRows = 10000
+
+// DatasetRequest 数据集渲染参数：输入文件的每一行（CSV 的列或 JSONL 的键）对应一组模板变量
+type DatasetRequest struct {
+	TemplateID   uuid.UUID
+	Version      *int
+	Strict       bool
+	InputFormat  string
+	OutputFormat string
+}
+
+func (r *DatasetRequest) Validate() error {
+	if r.TemplateID == uuid.Nil {
+		return errors.New("template_id is required")
+	}
+	if r.Version != nil && *r.Version < 1 {
+		return errors.New("version must be a positive integer")
+	}
+	if !isDatasetFormat(r.InputFormat) {
+		return fmt.Errorf("unsupported input format %q (expected csv or jsonl)", r.InputFormat)
+	}
+	if !isDatasetFormat(r.OutputFormat) {
+		return fmt.Errorf("unsupported output format %q (expected csv or jsonl)", r.OutputFormat)
+	}
+	return nil
+}
+
+func isDatasetFormat(format string) bool {
+	return format == DatasetFormatCSV || format == DatasetFormatJSONL
+}
+
+// DatasetResult 数据集中一行的渲染结果，Line 为该行在输入文件中的行号
+type DatasetResult struct {
+	Line int `json:"line"`
+	*GenerateResponse
+	Error  string         `json:"error,omitempty"`
+	Errors VariableErrors `json:"errors,omitempty"`
+}
+
+// DatasetSummary 数据集渲染统计
+type DatasetSummary struct {
+	Rows      int
+	Succeeded int
+	Failed    int
+}
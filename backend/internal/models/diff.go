@@ -0,0 +1,51 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// TemplateRef 指向模板的某个版本，Version 为空时表示当前版本
+type TemplateRef struct {
+	ID      uuid.UUID
+	Version *int
+}
+
+// TemplateDiff 两个模板（或版本）之间的差异
+type TemplateDiff struct {
+	From      DiffSide      `json:"from"`
+	To        DiffSide      `json:"to"`
+	Identical bool          `json:"identical"`
+	Fields    []FieldChange `json:"fields"`
+	// Content 为 Content 字段的行级统一 diff，内容相同时为空字符串
+	Content   string        `json:"content"`
+	Variables VariablesDiff `json:"variables"`
+}
+
+// DiffSide diff 的一侧
+type DiffSide struct {
+	TemplateID uuid.UUID `json:"template_id"`
+	Version    int       `json:"version"`
+	Name       string    `json:"name"`
+	// Proposed 表示这一侧是尚未保存的更新请求
+	Proposed bool `json:"proposed,omitempty"`
+}
+
+// FieldChange 单个字段的变化
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// VariablesDiff 变量列表的结构化差异，按变量名匹配
+type VariablesDiff struct {
+	Added   []TemplateVariable `json:"added"`
+	Removed []TemplateVariable `json:"removed"`
+	Changed []VariableChange   `json:"changed"`
+}
+
+// VariableChange 同名变量的字段变化
+type VariableChange struct {
+	Name    string        `json:"name"`
+	Changes []FieldChange `json:"changes"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 生成记录状态
+const (
+	RunStatusSuccess = "success"
+	RunStatusError   = "error"
+)
+
+// RedactedValue 模板开启 redact_runs 时，生成记录中代替变量值的占位符
+const RedactedValue = "[REDACTED]"
+
+// GenerationRun 一次提示词生成的记录
+type GenerationRun struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	TemplateID      uuid.UUID  `gorm:"type:uuid;index" json:"template_id"`
+	TemplateVersion int        `json:"template_version"`
+	UserID          *uuid.UUID `gorm:"type:uuid" json:"user_id"` // 调用方，匿名调用为空
+	Variables       JSONB      `gorm:"type:jsonb" json:"variables"`
+	Output          string     `gorm:"type:text" json:"output"`
+	Redacted        bool       `json:"redacted"`
+	Status          string     `gorm:"size:20" json:"status"`
+	Error           string     `gorm:"type:text" json:"error,omitempty"`
+	LatencyMs       int64      `json:"latency_ms"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (GenerationRun) TableName() string {
+	return "generation_runs"
+}
@@ -0,0 +1,136 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 模板列表的排序字段
+const (
+	SortCreatedAt  = "created_at"
+	SortUpdatedAt  = "updated_at"
+	SortName       = "name"
+	SortUsageCount = "usage_count"
+)
+
+// TemplateSort 模板列表的排序方式，排序字段相同的模板再按 id 排序，保证翻页时顺序稳定
+type TemplateSort struct {
+	Field string
+	Desc  bool
+}
+
+// DefaultTemplateSort 默认按创建时间倒序
+var DefaultTemplateSort = TemplateSort{Field: SortCreatedAt, Desc: true}
+
+// String 返回 "字段:asc" 或 "字段:desc"
+func (s TemplateSort) String() string {
+	if s.Desc {
+		return s.Field + ":desc"
+	}
+	return s.Field + ":asc"
+}
+
+// value 返回模板在排序字段上的值
+func (s TemplateSort) value(t *PromptTemplate) interface{} {
+	switch s.Field {
+	case SortUpdatedAt:
+		return t.UpdatedAt
+	case SortName:
+		return t.Name
+	case SortUsageCount:
+		return t.UsageCount
+	default:
+		return t.CreatedAt
+	}
+}
+
+// TemplateCursor 模板列表的游标，指向上一页的最后一条，下一页从其后开始
+type TemplateCursor struct {
+	// Sort 为生成游标时的排序方式，只能用于相同排序的列表
+	Sort TemplateSort
+	// Value 为上一页最后一条在排序字段上的值（time.Time、string 或 int）
+	Value interface{}
+	ID    uuid.UUID
+}
+
+// NewTemplateCursor 生成指向模板 t 的游标
+func NewTemplateCursor(sort TemplateSort, t *PromptTemplate) TemplateCursor {
+	return TemplateCursor{Sort: sort, Value: sort.value(t), ID: t.ID}
+}
+
+// cursorPayload 游标编码前的 JSON 结构
+type cursorPayload struct {
+	Sort  string    `json:"s"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// Encode 将游标编码为不透明的字符串
+func (c TemplateCursor) Encode() string {
+	var value string
+	switch v := c.Value.(type) {
+	case time.Time:
+		value = v.UTC().Format(time.RFC3339Nano)
+	case int:
+		value = strconv.Itoa(v)
+	default:
+		value = fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(cursorPayload{Sort: c.Sort.String(), Value: value, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeTemplateCursor 解析 Encode 生成的游标，游标的排序方式需与 sort 一致。
+// 游标不签名：被改写但格式合法的游标只会改变翻页起点，筛选和可见性条件照常生效。
+func DecodeTemplateCursor(s string, sort TemplateSort) (*TemplateCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if payload.Sort != sort.String() {
+		return nil, fmt.Errorf("%w: cursor was created for sort %s", ErrInvalidCursor, payload.Sort)
+	}
+
+	c := &TemplateCursor{Sort: sort, ID: payload.ID}
+	switch sort.Field {
+	case SortCreatedAt, SortUpdatedAt:
+		c.Value, err = time.Parse(time.RFC3339Nano, payload.Value)
+	case SortUsageCount:
+		c.Value, err = strconv.Atoi(payload.Value)
+	default:
+		c.Value = payload.Value
+	}
+	if err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// PageRequest 分页和排序参数，Cursor 不为空时按游标翻页并忽略 Offset
+type PageRequest struct {
+	Limit  int
+	Offset int
+	Sort   TemplateSort
+	Cursor *TemplateCursor
+}
+
+// TemplatePage 一页模板
+type TemplatePage struct {
+	Templates []PromptTemplate
+	// Total 为满足筛选条件的模板总数（与分页无关）
+	Total int64
+	// NextCursor 为下一页的游标，没有更多数据时为空
+	NextCursor string
+}
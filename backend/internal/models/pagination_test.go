@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func testTemplate() *PromptTemplate {
+	return &PromptTemplate{
+		ID:         uuid.New(),
+		Name:       "Ünïcode, with \"quotes\"",
+		UsageCount: 42,
+		CreatedAt:  time.Date(2026, 1, 2, 3, 4, 5, 123456789, time.FixedZone("UTC+8", 8*3600)),
+		UpdatedAt:  time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC),
+	}
+}
+
+func TestTemplateCursorRoundTrip(t *testing.T) {
+	tmpl := testTemplate()
+	for _, sort := range []TemplateSort{
+		{Field: SortCreatedAt, Desc: true},
+		{Field: SortUpdatedAt},
+		{Field: SortName},
+		{Field: SortUsageCount, Desc: true},
+	} {
+		t.Run(sort.String(), func(t *testing.T) {
+			encoded := NewTemplateCursor(sort, tmpl).Encode()
+			decoded, err := DecodeTemplateCursor(encoded, sort)
+			if err != nil {
+				t.Fatalf("DecodeTemplateCursor: %v", err)
+			}
+			if decoded.ID != tmpl.ID || decoded.Sort != sort {
+				t.Errorf("decoded %+v, want id %s and sort %s", decoded, tmpl.ID, sort)
+			}
+			want := sort.value(tmpl)
+			if ts, ok := want.(time.Time); ok {
+				got, ok := decoded.Value.(time.Time)
+				if !ok || !got.Equal(ts) {
+					t.Errorf("value = %v, want %v", decoded.Value, ts)
+				}
+			} else if decoded.Value != want {
+				t.Errorf("value = %#v, want %#v", decoded.Value, want)
+			}
+		})
+	}
+}
+
+func TestTemplateCursorTies(t *testing.T) {
+	// 排序字段相同的模板只靠 id 区分，游标必须完整保留值（包括纳秒）和 id
+	a, b := testTemplate(), testTemplate()
+	sort := TemplateSort{Field: SortCreatedAt, Desc: true}
+
+	ca, cb := NewTemplateCursor(sort, a).Encode(), NewTemplateCursor(sort, b).Encode()
+	if ca == cb {
+		t.Fatal("cursors for tied templates are identical")
+	}
+	da, err := DecodeTemplateCursor(ca, sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := DecodeTemplateCursor(cb, sort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !da.Value.(time.Time).Equal(db.Value.(time.Time)) || da.Value.(time.Time).Nanosecond() != 123456789 {
+		t.Errorf("tied values decoded as %v and %v", da.Value, db.Value)
+	}
+	if da.ID != a.ID || db.ID != b.ID {
+		t.Errorf("ids decoded as %s and %s, want %s and %s", da.ID, db.ID, a.ID, b.ID)
+	}
+}
+
+func TestDecodeTemplateCursorRejects(t *testing.T) {
+	tmpl := testTemplate()
+	byName := TemplateSort{Field: SortName}
+	valid := NewTemplateCursor(byName, tmpl).Encode()
+	raw := func(payload string) string { return base64.RawURLEncoding.EncodeToString([]byte(payload)) }
+	id := tmpl.ID.String()
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   TemplateSort
+	}{
+		{"empty", "", byName},
+		{"not base64", "%%%not-a-cursor%%%", byName},
+		{"padded base64", valid + "==", byName},
+		{"truncated", valid[:len(valid)/2], byName},
+		{"tampered byte", valid[:5] + "A" + valid[6:], byName},
+		{"not json", raw("hello"), byName},
+		{"json array", raw(`["name:asc","x"]`), byName},
+		{"missing id", raw(`{"s":"name:asc","v":"x"}`), byName},
+		{"nil id", raw(`{"s":"name:asc","v":"x","id":"00000000-0000-0000-0000-000000000000"}`), byName},
+		{"garbled id", raw(`{"s":"name:asc","v":"x","id":"not-a-uuid"}`), byName},
+		{"non-numeric usage count", raw(`{"s":"usage_count:asc","v":"lots","id":"` + id + `"}`), TemplateSort{Field: SortUsageCount}},
+		{"bad timestamp", raw(`{"s":"created_at:desc","v":"yesterday","id":"` + id + `"}`), DefaultTemplateSort},
+		{"other field", valid, TemplateSort{Field: SortCreatedAt}},
+		{"other direction", valid, TemplateSort{Field: SortName, Desc: true}},
+		{"sort rewritten to match", raw(`{"s":"name:desc","v":"x","id":"` + id + `"}`), byName},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := DecodeTemplateCursor(tt.cursor, tt.sort)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("DecodeTemplateCursor = %+v, %v; want ErrInvalidCursor", c, err)
+			}
+		})
+	}
+}
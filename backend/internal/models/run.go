@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	MaxRunModelLen  = 100
+	MaxRunMaxTokens = 32000
+)
+
+// RunRequest 渲染模板并将结果发送给模型，Model 为空时使用服务端配置的默认模型
+type RunRequest struct {
+	GenerateRequest
+	Model       string   `json:"model"`
+	MaxTokens   *int     `json:"max_tokens"`
+	Temperature *float64 `json:"temperature"`
+}
+
+func (r *RunRequest) Validate() error {
+	if err := r.GenerateRequest.Validate(); err != nil {
+		return err
+	}
+	if len(r.Model) > MaxRunModelLen {
+		return fmt.Errorf("model too long (max %d)", MaxRunModelLen)
+	}
+	if r.MaxTokens != nil && (*r.MaxTokens < 1 || *r.MaxTokens > MaxRunMaxTokens) {
+		return fmt.Errorf("max_tokens must be between 1 and %d", MaxRunMaxTokens)
+	}
+	if r.Temperature != nil && (*r.Temperature < 0 || *r.Temperature > 2) {
+		return errors.New("temperature must be between 0 and 2")
+	}
+	return nil
+}
+
+// TokenUsage 模型调用的 token 用量
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// RunResponse 运行结果：Result 为模型输出，Prompt/Messages 为发送给模型的内容
+type RunResponse struct {
+	GenerateResponse
+	Model        string     `json:"model"`
+	FinishReason string     `json:"finish_reason,omitempty"`
+	Usage        TokenUsage `json:"usage"`
+	LatencyMs    int64      `json:"latency_ms"`
+}
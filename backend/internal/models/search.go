@@ -0,0 +1,56 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxSearchQueryLen = 200
+	MaxSearchTerms    = 10
+)
+
+// 全文检索摘要中命中词的起止标记（Unicode 私用区字符，不会出现在正常文本中），
+// 由服务层转义摘要后替换为 <mark> 和 </mark>
+const (
+	SearchHighlightStart = "\uE000"
+	SearchHighlightStop  = "\uE001"
+)
+
+// TemplateSearchQuery 模板全文检索条件
+type TemplateSearchQuery struct {
+	// Query 为检索词，多个词以空白分隔时需全部命中，每个词内的中日韩文字需连续出现
+	Query      string
+	Category   string
+	PublicOnly bool
+}
+
+func (q *TemplateSearchQuery) Validate() error {
+	q.Query = strings.TrimSpace(q.Query)
+	if q.Query == "" {
+		return errors.New("search query is required")
+	}
+	if utf8.RuneCountInString(q.Query) > MaxSearchQueryLen {
+		return fmt.Errorf("search query too long (max %d characters)", MaxSearchQueryLen)
+	}
+	if len(q.Terms()) > MaxSearchTerms {
+		return fmt.Errorf("too many search terms (max %d)", MaxSearchTerms)
+	}
+	return ValidateCategoryValue(q.Category)
+}
+
+// Terms 返回以空白分隔的检索词
+func (q TemplateSearchQuery) Terms() []string {
+	return strings.Fields(q.Query)
+}
+
+// TemplateSearchResult 模板检索结果
+type TemplateSearchResult struct {
+	PromptTemplate
+	// Rank 为相关度，名称命中的权重高于描述，描述高于内容
+	Rank float64 `json:"rank"`
+	// Snippet 为描述和内容中命中部分的摘要，已做 HTML 转义，命中词以 <mark> 标出
+	Snippet string `json:"snippet"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxTagLen          = 50
+	MaxTagsPerTemplate = 20
+	// MaxTagCounts 标签统计最多返回的标签数
+	MaxTagCounts = 500
+)
+
+// 标签筛选方式
+const (
+	// TagMatchAny 包含任意一个标签即可（默认）
+	TagMatchAny = "any"
+	// TagMatchAll 需包含全部标签
+	TagMatchAll = "all"
+)
+
+// TagCount 标签及使用该标签的模板数
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// NormalizeTags 去掉标签首尾的空白并转为小写，去重后按原顺序返回。
+// tags 为 nil 时返回 nil（更新请求中表示不修改标签）。
+func NormalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			return nil, errors.New("tags cannot be empty")
+		}
+		if utf8.RuneCountInString(tag) > MaxTagLen {
+			return nil, fmt.Errorf("tag too long (max %d characters)", MaxTagLen)
+		}
+		if strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("tag %q cannot contain commas", tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	if len(result) > MaxTagsPerTemplate {
+		return nil, fmt.Errorf("too many tags (max %d)", MaxTagsPerTemplate)
+	}
+	return result, nil
+}
+
+// TemplateFilter 模板列表的筛选条件
+type TemplateFilter struct {
+	Category string
+	// Tags 不为空时只返回带有这些标签的模板，TagMatch 为 all 时需包含全部标签，否则包含任意一个即可
+	Tags     []string
+	TagMatch string
+}
+
+// Validate 校验筛选条件并规范化标签
+func (f *TemplateFilter) Validate() error {
+	if err := ValidateCategoryValue(f.Category); err != nil {
+		return err
+	}
+	tags, err := NormalizeTags(f.Tags)
+	if err != nil {
+		return err
+	}
+	f.Tags = tags
+	switch f.TagMatch {
+	case "":
+		f.TagMatch = TagMatchAny
+	case TagMatchAny, TagMatchAll:
+	default:
+		return fmt.Errorf("unsupported tag_match %q (expected any or all)", f.TagMatch)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tooMany := make([]string, MaxTagsPerTemplate+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag%d", i)
+	}
+
+	tests := []struct {
+		name    string
+		tags    []string
+		want    []string
+		errPart string
+	}{
+		{"nil keeps tags unchanged", nil, nil, ""},
+		{"empty list clears tags", []string{}, []string{}, ""},
+		{"trimmed and lowercased", []string{"  Go ", "SQL"}, []string{"go", "sql"}, ""},
+		{"duplicates removed in order", []string{"b", "A", "a", " B "}, []string{"b", "a"}, ""},
+		{"unicode", []string{"中文", "Ünïcode"}, []string{"中文", "ünïcode"}, ""},
+		{"length counts runes", []string{strings.Repeat("标", MaxTagLen)}, []string{strings.Repeat("标", MaxTagLen)}, ""},
+		{"duplicates do not count towards the limit", append(tooMany[:MaxTagsPerTemplate:MaxTagsPerTemplate], "TAG0"), tooMany[:MaxTagsPerTemplate], ""},
+		{"blank", []string{"a", "  "}, nil, "tags cannot be empty"},
+		{"too long", []string{strings.Repeat("a", MaxTagLen+1)}, nil, "tag too long"},
+		{"comma", []string{"a,b"}, nil, `tag "a,b" cannot contain commas`},
+		{"too many", tooMany, nil, "too many tags"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeTags(tt.tags)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeTags: %v", err)
+			}
+			if (got == nil) != (tt.want == nil) || fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("NormalizeTags(%q) = %#v, want %#v", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFilterValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    TemplateFilter
+		wantTags  []string
+		wantMatch string
+		errPart   string
+	}{
+		{"defaults to any", TemplateFilter{Tags: []string{"Go"}}, []string{"go"}, TagMatchAny, ""},
+		{"any", TemplateFilter{Tags: []string{"a", "b"}, TagMatch: TagMatchAny}, []string{"a", "b"}, TagMatchAny, ""},
+		{"all", TemplateFilter{Tags: []string{"a", "A"}, TagMatch: TagMatchAll}, []string{"a"}, TagMatchAll, ""},
+		{"no tags", TemplateFilter{}, nil, TagMatchAny, ""},
+		{"match is case sensitive", TemplateFilter{TagMatch: "ALL"}, nil, "", `unsupported tag_match "ALL"`},
+		{"unknown match", TemplateFilter{TagMatch: "none"}, nil, "", "expected any or all"},
+		{"invalid tag", TemplateFilter{Tags: []string{""}}, nil, "", "tags cannot be empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.filter
+			err := f.Validate()
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if fmt.Sprintf("%q", f.Tags) != fmt.Sprintf("%q", tt.wantTags) || f.TagMatch != tt.wantMatch {
+				t.Errorf("got tags %q match %q, want %q %q", f.Tags, f.TagMatch, tt.wantTags, tt.wantMatch)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -22,10 +23,30 @@ const (
 	MaxVariableDisplayNameLen = 100
 	MaxVariableDescriptionLen = 2000
 	MaxVariableValueLen       = 1000
+	MaxSlugLen                = 100
+	MaxChatMessages           = 50
+)
+
+// 模板类型
+const (
+	// TemplateKindText 普通模板，内容为一段文本
+	TemplateKindText = "text"
+	// TemplateKindChat 对话模板，内容为按顺序排列的多条角色消息
+	TemplateKindChat = "chat"
+)
+
+// 对话消息角色
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
 )
 
 var variableNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
 
+// slugPattern 模板别名：小写字母、数字，以连字符分隔
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
 // JSONB 类型用于处理 PostgreSQL 的 JSONB 类型
 type JSONB json.RawMessage
 
@@ -79,19 +100,70 @@ func (j *JSONB) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// ChatMessage 对话消息，结构与 OpenAI 兼容的 chat 接口一致
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatMessages 对话消息列表，以 JSONB 存储
+type ChatMessages []ChatMessage
+
+func (m ChatMessages) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return json.Marshal(m)
+}
+
+func (m *ChatMessages) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported type %T for chat messages", value)
+	}
+	return json.Unmarshal(data, m)
+}
+
+// Flatten 将消息拼接为一段文本，用于对话模板的 Content 以及不支持对话格式的场景
+func (m ChatMessages) Flatten() string {
+	blocks := make([]string, 0, len(m))
+	for _, message := range m {
+		role := message.Role
+		if role != "" {
+			role = strings.ToUpper(role[:1]) + role[1:]
+		}
+		blocks = append(blocks, role+": "+message.Content)
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
 // PromptTemplate 提示词模板
 type PromptTemplate struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
-	UserID      uuid.UUID `gorm:"type:uuid;index" json:"user_id"`
-	Name        string    `gorm:"size:200;not null" json:"name"`
-	Description string    `gorm:"type:text" json:"description"`
-	Content     string    `gorm:"type:text;not null" json:"content"`
-	Variables   JSONB     `gorm:"type:jsonb;default:'[]'" json:"variables"`
-	Category    string    `gorm:"size:100;index" json:"category"`
-	IsPublic    bool      `gorm:"default:false" json:"is_public"`
-	UsageCount  int       `gorm:"default:0" json:"usage_count"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key" json:"id"`
+	UserID      uuid.UUID    `gorm:"type:uuid;index" json:"user_id"`
+	Name        string       `gorm:"size:200;not null" json:"name"`
+	Description string       `gorm:"type:text" json:"description"`
+	Content     string       `gorm:"type:text;not null" json:"content"`
+	Variables   JSONB        `gorm:"type:jsonb;default:'[]'" json:"variables"`
+	Kind        string       `gorm:"size:20;default:'text'" json:"kind"`
+	Messages    ChatMessages `gorm:"type:jsonb" json:"messages,omitempty"` // 对话模板的消息，此时 Content 为消息拼接后的文本
+	Category    string       `gorm:"size:100;index" json:"category"`
+	IsPublic    bool         `gorm:"default:false" json:"is_public"`
+	Slug        *string      `gorm:"size:100;uniqueIndex" json:"slug,omitempty"` // 可选的唯一别名，可在 {{> template:<slug>}} 中引用
+	RedactRuns  bool         `gorm:"default:false" json:"redact_runs"`           // 为 true 时生成记录不保存变量值和输出
+	UsageCount  int          `gorm:"default:0" json:"usage_count"`
+	Version     int          `gorm:"default:1" json:"version"`
+	Tags        []string     `gorm:"-" json:"tags"` // 保存在 template_tags 中，不随版本变化
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
 }
 
 // TableName 指定表名
@@ -99,6 +171,35 @@ func (PromptTemplate) TableName() string {
 	return "prompt_templates"
 }
 
+// EffectiveKind 返回模板类型，未设置时为 text
+func (t PromptTemplate) EffectiveKind() string {
+	if t.Kind == "" {
+		return TemplateKindText
+	}
+	return t.Kind
+}
+
+// PromptTemplateVersion 模板版本快照，每次创建或更新模板时写入，写入后不再修改
+type PromptTemplateVersion struct {
+	ID          uuid.UUID    `gorm:"type:uuid;primary_key" json:"id"`
+	TemplateID  uuid.UUID    `gorm:"type:uuid;index" json:"template_id"`
+	Version     int          `gorm:"not null" json:"version"`
+	Name        string       `gorm:"size:200;not null" json:"name"`
+	Description string       `gorm:"type:text" json:"description"`
+	Content     string       `gorm:"type:text;not null" json:"content"`
+	Variables   JSONB        `gorm:"type:jsonb;default:'[]'" json:"variables"`
+	Kind        string       `gorm:"size:20;default:'text'" json:"kind"`
+	Messages    ChatMessages `gorm:"type:jsonb" json:"messages,omitempty"`
+	Category    string       `gorm:"size:100" json:"category"`
+	CreatedBy   uuid.UUID    `gorm:"type:uuid" json:"created_by"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// TableName 指定表名
+func (PromptTemplateVersion) TableName() string {
+	return "prompt_template_versions"
+}
+
 // TemplateVariable 模板变量
 type TemplateVariable struct {
 	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
@@ -109,7 +210,17 @@ type TemplateVariable struct {
 	DefaultValue string    `gorm:"type:text" json:"default_value"`
 	Required     bool      `gorm:"default:true" json:"required"`
 	SortOrder    int       `gorm:"default:0" json:"sort_order"`
-	CreatedAt    time.Time `json:"created_at"`
+	// Type 变量类型，为空时按 string 处理，取值见 VariableType* 常量
+	Type string `gorm:"-" json:"type,omitempty"`
+	// 以下为可选的校验规则。变量定义保存在 prompt_templates.variables（JSONB）中，
+	// template_variables 表没有这些列
+	MinLength *int      `gorm:"-" json:"min_length,omitempty"`
+	MaxLength *int      `gorm:"-" json:"max_length,omitempty"`
+	Pattern   string    `gorm:"-" json:"pattern,omitempty"`
+	Options   []string  `gorm:"-" json:"options,omitempty"`
+	Min       *float64  `gorm:"-" json:"min,omitempty"`
+	Max       *float64  `gorm:"-" json:"max,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // TableName 指定表名
@@ -121,40 +232,93 @@ func (TemplateVariable) TableName() string {
 type GenerateRequest struct {
 	TemplateID uuid.UUID         `json:"template_id" binding:"required"`
 	Variables  map[string]string `json:"variables" binding:"required"`
+	// Version 可选，指定后使用该历史版本的内容生成，而不是模板的当前版本
+	Version *int `json:"version"`
+	// Strict 为 true 时拒绝模板中未声明的变量
+	Strict bool `json:"strict"`
 }
 
 func (r *GenerateRequest) Validate() error {
 	if r.TemplateID == uuid.Nil {
 		return errors.New("template_id is required")
 	}
+	if r.Version != nil && *r.Version < 1 {
+		return errors.New("version must be a positive integer")
+	}
 	if len(r.Variables) > MaxVariables {
 		return fmt.Errorf("too many variables (max %d)", MaxVariables)
 	}
+	var errs VariableErrors
 	for name, value := range r.Variables {
 		if err := validateVariableKey(name); err != nil {
-			return err
+			errs = append(errs, VariableError{Variable: name, Code: VariableErrorInvalidName, Message: err.Error()})
+			continue
 		}
 		if len(value) > MaxVariableValueLen {
-			return fmt.Errorf("variable value too long (max %d)", MaxVariableValueLen)
+			errs = append(errs, VariableError{
+				Variable: name,
+				Code:     VariableErrorMaxLength,
+				Message:  fmt.Sprintf("variable %s value too long (max %d)", name, MaxVariableValueLen),
+			})
+		} else if ContainsControlChar(value) {
+			// 取值会写入生成记录和使用统计，数据库不接受的字符会使整批写入失败
+			errs = append(errs, VariableError{
+				Variable: name,
+				Code:     VariableErrorInvalidValue,
+				Message:  fmt.Sprintf("variable %s value contains control characters", name),
+			})
 		}
 	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Variable < errs[j].Variable })
+		return errs
+	}
 	return nil
 }
 
+// VariableError 单个变量的校验错误
+type VariableError struct {
+	Variable string `json:"variable"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+}
+
+// VariableErrors 变量校验错误列表，作为一个整体返回给调用方
+type VariableErrors []VariableError
+
+func (e VariableErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, item := range e {
+		messages = append(messages, item.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
 // GenerateResponse 生成提示词响应
 type GenerateResponse struct {
 	Result string `json:"result"`
+	// Prompt 为生成的提示词，对话模板为各条消息拼接后的文本
 	Prompt string `json:"prompt"`
+	// Messages 仅对话模板返回，可直接作为 OpenAI 兼容 chat 接口的 messages 参数
+	Messages ChatMessages `json:"messages,omitempty"`
+	// RunID 本次生成的记录 ID，可通过 GET /api/runs/:id 查看
+	RunID *uuid.UUID `json:"run_id,omitempty"`
 }
 
 // CreateTemplateRequest 创建模板请求
 type CreateTemplateRequest struct {
 	Name        string             `json:"name" binding:"required"`
 	Description string             `json:"description"`
-	Content     string             `json:"content" binding:"required"`
+	Content     string             `json:"content"`
 	Variables   []TemplateVariable `json:"variables"`
 	Category    string             `json:"category"`
 	IsPublic    bool               `json:"is_public"`
+	Slug        string             `json:"slug"`
+	RedactRuns  bool               `json:"redact_runs"`
+	Tags        []string           `json:"tags"`
+	// Kind 为 chat 时使用 Messages，Content 由消息自动生成
+	Kind     string       `json:"kind"`
+	Messages ChatMessages `json:"messages"`
 }
 
 func (r *CreateTemplateRequest) Validate() error {
@@ -168,12 +332,20 @@ func (r *CreateTemplateRequest) Validate() error {
 	if len(r.Description) > MaxTemplateDescriptionLen {
 		return fmt.Errorf("description too long (max %d)", MaxTemplateDescriptionLen)
 	}
-	if err := ValidateTemplateContent(r.Content); err != nil {
+	if err := ValidateTemplateBody(r.Kind, r.Content, r.Messages); err != nil {
 		return err
 	}
 	if err := ValidateCategoryValue(r.Category); err != nil {
 		return err
 	}
+	if err := ValidateSlug(r.Slug); err != nil {
+		return err
+	}
+	tags, err := NormalizeTags(r.Tags)
+	if err != nil {
+		return err
+	}
+	r.Tags = tags
 	if len(r.Variables) > MaxVariables {
 		return fmt.Errorf("too many variables (max %d)", MaxVariables)
 	}
@@ -193,6 +365,13 @@ type UpdateTemplateRequest struct {
 	Variables   []TemplateVariable `json:"variables"`
 	Category    *string            `json:"category"`
 	IsPublic    *bool              `json:"is_public"`
+	RedactRuns  *bool              `json:"redact_runs"`
+	// Tags 为 nil 时不修改标签，为空列表时清除全部标签
+	Tags []string `json:"tags"`
+	// Slug 为空字符串时清除别名
+	Slug     *string      `json:"slug"`
+	Kind     *string      `json:"kind"`
+	Messages ChatMessages `json:"messages"`
 }
 
 func (r *UpdateTemplateRequest) Validate() error {
@@ -213,11 +392,29 @@ func (r *UpdateTemplateRequest) Validate() error {
 			return err
 		}
 	}
+	if r.Kind != nil && *r.Kind != TemplateKindText && *r.Kind != TemplateKindChat {
+		return fmt.Errorf("unsupported kind %q", *r.Kind)
+	}
+	if r.Messages != nil {
+		if err := ValidateChatMessages(r.Messages); err != nil {
+			return err
+		}
+	}
 	if r.Category != nil {
 		if err := ValidateCategoryValue(*r.Category); err != nil {
 			return err
 		}
 	}
+	if r.Slug != nil {
+		if err := ValidateSlug(*r.Slug); err != nil {
+			return err
+		}
+	}
+	tags, err := NormalizeTags(r.Tags)
+	if err != nil {
+		return err
+	}
+	r.Tags = tags
 	if r.Variables != nil {
 		if len(r.Variables) > MaxVariables {
 			return fmt.Errorf("too many variables (max %d)", MaxVariables)
@@ -242,6 +439,45 @@ func ValidateTemplateContent(content string) error {
 	return nil
 }
 
+// ValidateTemplateBody 按模板类型校验内容：普通模板校验 content，对话模板校验 messages
+func ValidateTemplateBody(kind, content string, messages ChatMessages) error {
+	switch kind {
+	case "", TemplateKindText:
+		if len(messages) > 0 {
+			return errors.New("messages are only allowed for chat templates")
+		}
+		return ValidateTemplateContent(content)
+	case TemplateKindChat:
+		return ValidateChatMessages(messages)
+	default:
+		return fmt.Errorf("unsupported kind %q", kind)
+	}
+}
+
+// ValidateChatMessages 校验对话消息
+func ValidateChatMessages(messages ChatMessages) error {
+	if len(messages) == 0 {
+		return errors.New("chat templates require at least one message")
+	}
+	if len(messages) > MaxChatMessages {
+		return fmt.Errorf("too many messages (max %d)", MaxChatMessages)
+	}
+	for i, message := range messages {
+		switch message.Role {
+		case ChatRoleSystem, ChatRoleUser, ChatRoleAssistant:
+		default:
+			return fmt.Errorf("message %d: role must be one of system, user, assistant", i+1)
+		}
+		if strings.TrimSpace(message.Content) == "" {
+			return fmt.Errorf("message %d: content is required", i+1)
+		}
+	}
+	if len(messages.Flatten()) > MaxTemplateContentLen {
+		return fmt.Errorf("messages too long (max %d)", MaxTemplateContentLen)
+	}
+	return nil
+}
+
 func ValidateCategoryValue(category string) error {
 	if category == "" {
 		return nil
@@ -252,6 +488,23 @@ func ValidateCategoryValue(category string) error {
 	return nil
 }
 
+// ValidateSlug 校验模板别名，空字符串表示不设置
+func ValidateSlug(slug string) error {
+	if slug == "" {
+		return nil
+	}
+	if len(slug) > MaxSlugLen {
+		return fmt.Errorf("slug too long (max %d)", MaxSlugLen)
+	}
+	if !slugPattern.MatchString(slug) {
+		return errors.New("slug may only contain lowercase letters, digits and hyphens")
+	}
+	if _, err := uuid.Parse(slug); err == nil {
+		return errors.New("slug cannot be a UUID")
+	}
+	return nil
+}
+
 func validateTemplateVariable(variable TemplateVariable) error {
 	name := strings.TrimSpace(variable.Name)
 	if name == "" {
@@ -272,6 +525,9 @@ func validateTemplateVariable(variable TemplateVariable) error {
 	if len(variable.DefaultValue) > MaxVariableValueLen {
 		return fmt.Errorf("variable default_value too long (max %d)", MaxVariableValueLen)
 	}
+	if err := validateVariableRules(variable); err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
 	return nil
 }
 
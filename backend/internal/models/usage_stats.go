@@ -0,0 +1,190 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 统计的时间粒度
+const (
+	StatsIntervalHour = "hour"
+	StatsIntervalDay  = "day"
+)
+
+const (
+	// MaxTrackedValueLen 参与取值统计的变量值最大长度（字符），更长的值不做统计
+	MaxTrackedValueLen = 200
+	// TopValuesPerVariable 每个变量返回的最常用取值个数
+	TopValuesPerVariable = 5
+	MaxTopTemplates      = 50
+)
+
+// 各粒度允许查询的最大时间范围
+var maxStatsRange = map[string]time.Duration{
+	StatsIntervalHour: 31 * 24 * time.Hour,
+	StatsIntervalDay:  366 * 24 * time.Hour,
+}
+
+// UsageEvent 一次（或一批）生成的统计数据
+type UsageEvent struct {
+	TemplateID  uuid.UUID
+	At          time.Time
+	UserID      *uuid.UUID // 匿名调用为空，不计入独立调用方
+	Generations int
+	Errors      int
+	// Variables 参与取值统计的变量，为空时不统计
+	Variables map[string]string
+}
+
+// UsageHourKey 小时计数的主键
+type UsageHourKey struct {
+	TemplateID uuid.UUID
+	Bucket     time.Time
+}
+
+// UsageCallerKey 小时内调用方的主键
+type UsageCallerKey struct {
+	TemplateID uuid.UUID
+	Bucket     time.Time
+	UserID     uuid.UUID
+}
+
+// VariableValueKey 每天变量取值计数的主键
+type VariableValueKey struct {
+	TemplateID uuid.UUID
+	Bucket     time.Time
+	Variable   string
+	Value      string
+}
+
+// UsageStatsBatch 合并后的使用统计，每个主键只出现一次，可以直接批量 upsert
+type UsageStatsBatch struct {
+	Hourly  map[UsageHourKey]UsageCounts
+	Callers map[UsageCallerKey]struct{}
+	Values  map[VariableValueKey]int64
+}
+
+// NewUsageStatsBatch 创建空的统计批次
+func NewUsageStatsBatch() *UsageStatsBatch {
+	return &UsageStatsBatch{
+		Hourly:  make(map[UsageHourKey]UsageCounts),
+		Callers: make(map[UsageCallerKey]struct{}),
+		Values:  make(map[VariableValueKey]int64),
+	}
+}
+
+// Add 合并一次生成的统计。maxValues 大于 0 时，取值的主键数达到上限后不再加入新的取值，返回丢弃的取值个数。
+func (b *UsageStatsBatch) Add(event UsageEvent, maxValues int) int {
+	hour := UsageHourKey{TemplateID: event.TemplateID, Bucket: event.At.UTC().Truncate(time.Hour)}
+	counts := b.Hourly[hour]
+	counts.Generations += int64(event.Generations)
+	counts.Errors += int64(event.Errors)
+	b.Hourly[hour] = counts
+
+	if event.UserID != nil {
+		b.Callers[UsageCallerKey{TemplateID: hour.TemplateID, Bucket: hour.Bucket, UserID: *event.UserID}] = struct{}{}
+	}
+
+	dropped := 0
+	day := event.At.UTC().Truncate(24 * time.Hour)
+	for name, value := range event.Variables {
+		key := VariableValueKey{TemplateID: event.TemplateID, Bucket: day, Variable: name, Value: value}
+		if _, ok := b.Values[key]; !ok && maxValues > 0 && len(b.Values) >= maxValues {
+			dropped++
+			continue
+		}
+		b.Values[key]++
+	}
+	return dropped
+}
+
+// Merge 将 other 中的统计累加到 b
+func (b *UsageStatsBatch) Merge(other *UsageStatsBatch) {
+	for key, c := range other.Hourly {
+		counts := b.Hourly[key]
+		counts.Generations += c.Generations
+		counts.Errors += c.Errors
+		b.Hourly[key] = counts
+	}
+	for key := range other.Callers {
+		b.Callers[key] = struct{}{}
+	}
+	for key, uses := range other.Values {
+		b.Values[key] += uses
+	}
+}
+
+// Empty 批次中是否没有任何统计
+func (b *UsageStatsBatch) Empty() bool {
+	return len(b.Hourly) == 0 && len(b.Callers) == 0 && len(b.Values) == 0
+}
+
+// StatsQuery 统计查询的时间范围 [From, To)
+type StatsQuery struct {
+	Interval string
+	From     time.Time
+	To       time.Time
+}
+
+func (q *StatsQuery) Validate() error {
+	maxRange, ok := maxStatsRange[q.Interval]
+	if !ok {
+		return fmt.Errorf("unsupported interval %q (expected hour or day)", q.Interval)
+	}
+	if !q.From.Before(q.To) {
+		return errors.New("from must be before to")
+	}
+	if q.To.Sub(q.From) > maxRange {
+		return fmt.Errorf("time range too large for interval %s (max %d days)", q.Interval, int(maxRange.Hours()/24))
+	}
+	return nil
+}
+
+// UsageCounts 一段时间内的使用统计
+type UsageCounts struct {
+	Generations   int64   `json:"generations"`
+	Errors        int64   `json:"errors"`
+	ErrorRate     float64 `json:"error_rate"`
+	UniqueCallers int64   `json:"unique_callers"`
+}
+
+// SetErrorRate 根据生成次数和失败次数计算失败率
+func (c *UsageCounts) SetErrorRate() {
+	if c.Generations > 0 {
+		c.ErrorRate = float64(c.Errors) / float64(c.Generations)
+	}
+}
+
+// UsageBucket 一个时间段（小时或天）的统计
+type UsageBucket struct {
+	Start time.Time `json:"start"`
+	UsageCounts
+}
+
+// VariableValueUsage 变量取值的使用次数
+type VariableValueUsage struct {
+	Variable string `json:"variable"`
+	Value    string `json:"value"`
+	Uses     int64  `json:"uses"`
+}
+
+// TemplateStats 模板的使用统计
+type TemplateStats struct {
+	TemplateID uuid.UUID            `json:"template_id"`
+	Interval   string               `json:"interval"`
+	From       time.Time            `json:"from"`
+	To         time.Time            `json:"to"`
+	Total      UsageCounts          `json:"total"`
+	Buckets    []UsageBucket        `json:"buckets"`
+	TopValues  []VariableValueUsage `json:"top_values"`
+}
+
+// TemplateUsage 模板在一段时间内的使用统计，用于排行
+type TemplateUsage struct {
+	TemplateID uuid.UUID `json:"template_id"`
+	Name       string    `json:"name"`
+	UsageCounts
+}
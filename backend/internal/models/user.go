@@ -0,0 +1,109 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxEmailLen       = 255
+	MaxDisplayNameLen = 100
+	MinPasswordLen    = 8
+	// bcrypt 只使用密码的前 72 个字节，超出部分会被静默忽略
+	MaxPasswordLen = 72
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// User 用户
+type User struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	Email        string    `gorm:"size:255;uniqueIndex;not null" json:"email"`
+	PasswordHash string    `gorm:"size:100;not null" json:"-"`
+	DisplayName  string    `gorm:"size:100" json:"display_name"`
+	Role         string    `gorm:"size:20;default:'user'" json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (User) TableName() string {
+	return "users"
+}
+
+// RegisterRequest 注册请求
+type RegisterRequest struct {
+	Email       string `json:"email" binding:"required"`
+	Password    string `json:"password" binding:"required"`
+	DisplayName string `json:"display_name"`
+}
+
+func (r *RegisterRequest) Validate() error {
+	if err := validateEmail(r.Email); err != nil {
+		return err
+	}
+	if len(r.Password) < MinPasswordLen {
+		return fmt.Errorf("password too short (min %d)", MinPasswordLen)
+	}
+	if len(r.Password) > MaxPasswordLen {
+		return fmt.Errorf("password too long (max %d)", MaxPasswordLen)
+	}
+	if len(strings.TrimSpace(r.DisplayName)) > MaxDisplayNameLen {
+		return fmt.Errorf("display_name too long (max %d)", MaxDisplayNameLen)
+	}
+	return nil
+}
+
+// LoginRequest 登录请求
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (r *LoginRequest) Validate() error {
+	if err := validateEmail(r.Email); err != nil {
+		return err
+	}
+	if r.Password == "" {
+		return errors.New("password is required")
+	}
+	if len(r.Password) > MaxPasswordLen {
+		return fmt.Errorf("password too long (max %d)", MaxPasswordLen)
+	}
+	return nil
+}
+
+// AuthResponse 登录/注册响应
+type AuthResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      *User     `json:"user"`
+}
+
+// NormalizeEmail 统一邮箱格式（去除空白并转为小写）
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func validateEmail(email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+	if len(email) > MaxEmailLen {
+		return fmt.Errorf("email too long (max %d)", MaxEmailLen)
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return errors.New("invalid email format")
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 变量类型
+const (
+	VariableTypeString  = "string"
+	VariableTypeText    = "text"
+	VariableTypeNumber  = "number"
+	VariableTypeInteger = "integer"
+	VariableTypeBoolean = "boolean"
+	VariableTypeEnum    = "enum"
+	VariableTypeDate    = "date"
+	VariableTypeJSON    = "json"
+	// VariableTypeArray 列表，取值为 JSON 字符串数组或每行一项的文本，可用于 {{#each}}
+	VariableTypeArray = "array"
+)
+
+// 变量校验错误码
+const (
+	VariableErrorRequired    = "required"
+	VariableErrorUnknown     = "unknown"
+	VariableErrorInvalidName = "invalid_name"
+	VariableErrorType        = "type"
+	VariableErrorMinLength   = "min_length"
+	VariableErrorMaxLength   = "max_length"
+	VariableErrorPattern     = "pattern"
+	VariableErrorEnum        = "enum"
+	VariableErrorMin         = "min"
+	VariableErrorMax         = "max"
+	// VariableErrorInvalidValue 取值包含控制字符等无法保存的内容
+	VariableErrorInvalidValue = "invalid_value"
+)
+
+const (
+	MaxVariablePatternLen = 500
+	MaxVariableOptions    = 100
+)
+
+var variableTypes = map[string]bool{
+	VariableTypeString:  true,
+	VariableTypeText:    true,
+	VariableTypeNumber:  true,
+	VariableTypeInteger: true,
+	VariableTypeBoolean: true,
+	VariableTypeEnum:    true,
+	VariableTypeDate:    true,
+	VariableTypeJSON:    true,
+	VariableTypeArray:   true,
+}
+
+// EffectiveType 返回变量类型，未设置时为 string
+func (v TemplateVariable) EffectiveType() string {
+	if v.Type == "" {
+		return VariableTypeString
+	}
+	return v.Type
+}
+
+// ValidateValue 按变量的类型和规则校验取值，通过时返回 nil
+func (v TemplateVariable) ValidateValue(value string) *VariableError {
+	code, reason := v.checkValue(value)
+	if code == "" {
+		return nil
+	}
+	return &VariableError{
+		Variable: v.Name,
+		Code:     code,
+		Message:  fmt.Sprintf("variable %s %s", v.Name, reason),
+	}
+}
+
+// checkValue 返回校验失败的错误码和原因，通过时错误码为空
+func (v TemplateVariable) checkValue(value string) (string, string) {
+	fail := func(code, format string, args ...interface{}) (string, string) {
+		return code, fmt.Sprintf(format, args...)
+	}
+
+	length := utf8.RuneCountInString(value)
+	if v.MinLength != nil && length < *v.MinLength {
+		return fail(VariableErrorMinLength, "must be at least %d characters", *v.MinLength)
+	}
+	if v.MaxLength != nil && length > *v.MaxLength {
+		return fail(VariableErrorMaxLength, "must be at most %d characters", *v.MaxLength)
+	}
+
+	switch v.EffectiveType() {
+	case VariableTypeNumber, VariableTypeInteger:
+		var number float64
+		if v.EffectiveType() == VariableTypeInteger {
+			parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return fail(VariableErrorType, "must be an integer")
+			}
+			number = float64(parsed)
+		} else {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+				return fail(VariableErrorType, "must be a number")
+			}
+			number = parsed
+		}
+		if v.Min != nil && number < *v.Min {
+			return fail(VariableErrorMin, "must be >= %s", formatNumber(*v.Min))
+		}
+		if v.Max != nil && number > *v.Max {
+			return fail(VariableErrorMax, "must be <= %s", formatNumber(*v.Max))
+		}
+	case VariableTypeBoolean:
+		if _, err := strconv.ParseBool(strings.TrimSpace(value)); err != nil {
+			return fail(VariableErrorType, "must be true or false")
+		}
+	case VariableTypeEnum:
+		if !containsString(v.Options, value) {
+			return fail(VariableErrorEnum, "must be one of: %s", strings.Join(v.Options, ", "))
+		}
+	case VariableTypeDate:
+		if _, err := parseDate(value); err != nil {
+			return fail(VariableErrorType, "must be a date (YYYY-MM-DD or RFC 3339)")
+		}
+	case VariableTypeJSON:
+		if !json.Valid([]byte(value)) {
+			return fail(VariableErrorType, "must be valid JSON")
+		}
+	case VariableTypeArray:
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			var items []interface{}
+			if err := json.Unmarshal([]byte(value), &items); err != nil {
+				return fail(VariableErrorType, "must be a JSON array or one item per line")
+			}
+		}
+	}
+
+	if v.Pattern != "" {
+		re, err := regexp.Compile(v.Pattern)
+		if err != nil || !re.MatchString(value) {
+			return fail(VariableErrorPattern, "does not match pattern %s", v.Pattern)
+		}
+	}
+
+	return "", ""
+}
+
+// validateVariableRules 校验变量定义中的类型和规则本身是否合法
+func validateVariableRules(v TemplateVariable) error {
+	variableType := v.EffectiveType()
+	if !variableTypes[variableType] {
+		return fmt.Errorf("unsupported type %q", v.Type)
+	}
+
+	if v.MinLength != nil && *v.MinLength < 0 {
+		return errors.New("min_length cannot be negative")
+	}
+	if v.MaxLength != nil && (*v.MaxLength < 1 || *v.MaxLength > MaxVariableValueLen) {
+		return fmt.Errorf("max_length must be between 1 and %d", MaxVariableValueLen)
+	}
+	if v.MinLength != nil && v.MaxLength != nil && *v.MinLength > *v.MaxLength {
+		return errors.New("min_length cannot be greater than max_length")
+	}
+
+	if v.Pattern != "" {
+		if len(v.Pattern) > MaxVariablePatternLen {
+			return fmt.Errorf("pattern too long (max %d)", MaxVariablePatternLen)
+		}
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+
+	isNumeric := variableType == VariableTypeNumber || variableType == VariableTypeInteger
+	if (v.Min != nil || v.Max != nil) && !isNumeric {
+		return errors.New("min/max are only allowed for number and integer variables")
+	}
+	if v.Min != nil && v.Max != nil && *v.Min > *v.Max {
+		return errors.New("min cannot be greater than max")
+	}
+
+	if variableType == VariableTypeEnum {
+		if len(v.Options) == 0 {
+			return errors.New("enum variables require options")
+		}
+		if len(v.Options) > MaxVariableOptions {
+			return fmt.Errorf("too many options (max %d)", MaxVariableOptions)
+		}
+		seen := make(map[string]bool, len(v.Options))
+		for _, option := range v.Options {
+			if option == "" {
+				return errors.New("options cannot be empty")
+			}
+			if len(option) > MaxVariableValueLen {
+				return fmt.Errorf("option too long (max %d)", MaxVariableValueLen)
+			}
+			if seen[option] {
+				return fmt.Errorf("duplicate option %q", option)
+			}
+			seen[option] = true
+		}
+	} else if len(v.Options) > 0 {
+		return errors.New("options are only allowed for enum variables")
+	}
+
+	// 默认值本身也必须满足规则
+	if v.DefaultValue != "" {
+		if code, reason := v.checkValue(v.DefaultValue); code != "" {
+			return fmt.Errorf("default_value %s", reason)
+		}
+	}
+	return nil
+}
+
+// ParseListValue 解析列表变量的取值：以 "[" 开头时按 JSON 数组解析（非字符串元素按 JSON 输出），
+// 否则按行拆分并忽略空行。
+func ParseListValue(value string) []string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" {
+		return []string{}
+	}
+	if strings.HasPrefix(trimmed, "[") {
+		var items []json.RawMessage
+		if err := json.Unmarshal([]byte(trimmed), &items); err == nil {
+			result := make([]string, 0, len(items))
+			for _, item := range items {
+				var s string
+				if err := json.Unmarshal(item, &s); err == nil {
+					result = append(result, s)
+				} else {
+					result = append(result, string(item))
+				}
+			}
+			return result
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(trimmed, "\r\n", "\n"), "\n")
+	result := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// ContainsControlChar 是否包含制表符、换行和回车以外的 C0 控制字符（包括 NUL，Postgres 的 text 和 jsonb 都不接受）
+func ContainsControlChar(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 && c != '\t' && c != '\n' && c != '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
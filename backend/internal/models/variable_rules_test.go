@@ -0,0 +1,176 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func intPtr(n int) *int           { return &n }
+func floatPtr(f float64) *float64 { return &f }
+
+func TestValidateVariableRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable TemplateVariable
+		errPart  string // 为空表示定义合法
+	}{
+		{"plain string", TemplateVariable{Name: "v"}, ""},
+		{"every type", TemplateVariable{Name: "v", Type: VariableTypeArray}, ""},
+		{"unsupported type", TemplateVariable{Name: "v", Type: "uuid"}, `unsupported type "uuid"`},
+		{"negative min_length", TemplateVariable{Name: "v", MinLength: intPtr(-1)}, "min_length cannot be negative"},
+		{"zero max_length", TemplateVariable{Name: "v", MaxLength: intPtr(0)}, "max_length must be between"},
+		{"max_length over limit", TemplateVariable{Name: "v", MaxLength: intPtr(MaxVariableValueLen + 1)}, "max_length must be between"},
+		{"min_length above max_length", TemplateVariable{Name: "v", MinLength: intPtr(5), MaxLength: intPtr(4)}, "greater than max_length"},
+		{"pattern too long", TemplateVariable{Name: "v", Pattern: strings.Repeat("a", MaxVariablePatternLen+1)}, "pattern too long"},
+		{"invalid pattern", TemplateVariable{Name: "v", Pattern: "("}, "invalid pattern"},
+		{"min on string", TemplateVariable{Name: "v", Min: floatPtr(1)}, "only allowed for number and integer"},
+		{"min above max", TemplateVariable{Name: "v", Type: VariableTypeNumber, Min: floatPtr(2), Max: floatPtr(1)}, "min cannot be greater than max"},
+		{"integer range", TemplateVariable{Name: "v", Type: VariableTypeInteger, Min: floatPtr(1), Max: floatPtr(1)}, ""},
+		{"enum without options", TemplateVariable{Name: "v", Type: VariableTypeEnum}, "require options"},
+		{"too many options", TemplateVariable{Name: "v", Type: VariableTypeEnum, Options: manyOptions(MaxVariableOptions + 1)}, "too many options"},
+		{"empty option", TemplateVariable{Name: "v", Type: VariableTypeEnum, Options: []string{"a", ""}}, "options cannot be empty"},
+		{"option too long", TemplateVariable{Name: "v", Type: VariableTypeEnum, Options: []string{strings.Repeat("a", MaxVariableValueLen+1)}}, "option too long"},
+		{"duplicate option", TemplateVariable{Name: "v", Type: VariableTypeEnum, Options: []string{"a", "a"}}, `duplicate option "a"`},
+		{"options on string", TemplateVariable{Name: "v", Options: []string{"a"}}, "only allowed for enum"},
+		{"default outside enum", TemplateVariable{Name: "v", Type: VariableTypeEnum, Options: []string{"a"}, DefaultValue: "b"}, "default_value must be one of: a"},
+		{"default below min", TemplateVariable{Name: "v", Type: VariableTypeInteger, Min: floatPtr(3), DefaultValue: "2"}, "default_value must be >= 3"},
+		{"valid default", TemplateVariable{Name: "v", Type: VariableTypeDate, DefaultValue: "2026-01-02"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTemplateVariable(tt.variable)
+			if tt.errPart == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.errPart)
+			}
+			if !strings.HasPrefix(err.Error(), "variable v: ") {
+				t.Errorf("err = %q, want it prefixed with the variable name", err)
+			}
+		})
+	}
+}
+
+func manyOptions(n int) []string {
+	options := make([]string, n)
+	for i := range options {
+		options[i] = fmt.Sprintf("option%d", i)
+	}
+	return options
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		variable TemplateVariable
+		value    string
+		wantCode string // 为空表示取值合法
+	}{
+		{"string", TemplateVariable{}, "anything", ""},
+		{"min_length counts runes", TemplateVariable{MinLength: intPtr(2)}, "中文", ""},
+		{"too short", TemplateVariable{MinLength: intPtr(3)}, "中文", VariableErrorMinLength},
+		{"too long", TemplateVariable{MaxLength: intPtr(2)}, "abc", VariableErrorMaxLength},
+		{"number", TemplateVariable{Type: VariableTypeNumber}, " 1.5 ", ""},
+		{"number NaN", TemplateVariable{Type: VariableTypeNumber}, "NaN", VariableErrorType},
+		{"number Inf", TemplateVariable{Type: VariableTypeNumber}, "+Inf", VariableErrorType},
+		{"integer", TemplateVariable{Type: VariableTypeInteger}, "42", ""},
+		{"integer with fraction", TemplateVariable{Type: VariableTypeInteger}, "4.2", VariableErrorType},
+		{"below min", TemplateVariable{Type: VariableTypeNumber, Min: floatPtr(0.5)}, "0.25", VariableErrorMin},
+		{"above max", TemplateVariable{Type: VariableTypeInteger, Max: floatPtr(10)}, "11", VariableErrorMax},
+		{"boolean", TemplateVariable{Type: VariableTypeBoolean}, "true", ""},
+		{"not a boolean", TemplateVariable{Type: VariableTypeBoolean}, "yes", VariableErrorType},
+		{"enum", TemplateVariable{Type: VariableTypeEnum, Options: []string{"a", "b"}}, "b", ""},
+		{"enum is case sensitive", TemplateVariable{Type: VariableTypeEnum, Options: []string{"a", "b"}}, "B", VariableErrorEnum},
+		{"date", TemplateVariable{Type: VariableTypeDate}, "2026-01-02", ""},
+		{"rfc3339", TemplateVariable{Type: VariableTypeDate}, "2026-01-02T03:04:05Z", ""},
+		{"not a date", TemplateVariable{Type: VariableTypeDate}, "02/01/2026", VariableErrorType},
+		{"json", TemplateVariable{Type: VariableTypeJSON}, `{"a":1}`, ""},
+		{"invalid json", TemplateVariable{Type: VariableTypeJSON}, `{"a":}`, VariableErrorType},
+		{"array lines", TemplateVariable{Type: VariableTypeArray}, "a\nb", ""},
+		{"array json", TemplateVariable{Type: VariableTypeArray}, `["a", 1]`, ""},
+		{"array invalid json", TemplateVariable{Type: VariableTypeArray}, `[a`, VariableErrorType},
+		{"pattern", TemplateVariable{Pattern: `^\d+$`}, "123", ""},
+		{"pattern mismatch", TemplateVariable{Pattern: `^\d+$`}, "12a", VariableErrorPattern},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.variable.Name = "v"
+			got := tt.variable.ValidateValue(tt.value)
+			if tt.wantCode == "" {
+				if got != nil {
+					t.Fatalf("unexpected error: %+v", got)
+				}
+				return
+			}
+			if got == nil || got.Code != tt.wantCode || got.Variable != "v" {
+				t.Fatalf("got %+v, want code %q", got, tt.wantCode)
+			}
+			if !strings.HasPrefix(got.Message, "variable v ") {
+				t.Errorf("message %q does not name the variable", got.Message)
+			}
+		})
+	}
+}
+
+func TestParseListValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"empty", "  ", []string{}},
+		{"lines", "a\r\n\n  b  \nc", []string{"a", "b", "c"}},
+		{"json strings", ` ["a", "b c"] `, []string{"a", "b c"}},
+		// null 按空字符串输出
+		{"json mixed", `["a", 1, {"k":true}, null]`, []string{"a", "1", `{"k":true}`, ""}},
+		{"invalid json falls back to lines", "[a\nb", []string{"[a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseListValue(tt.value)
+			if got == nil || fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("ParseListValue(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateRequestRejectsControlChars(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"plain", "hello", false},
+		{"tab newline carriage return", "a\tb\r\nc", false},
+		{"unicode", "中文 ünïcode", false},
+		{"nul", "a\x00b", true},
+		{"escape", "\x1b[31m", true},
+		{"bell", "\a", true},
+		{"unit separator", "\x1f", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := GenerateRequest{TemplateID: uuid.New(), Variables: map[string]string{"v": tt.value}}
+			err := req.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var errs VariableErrors
+			if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Code != VariableErrorInvalidValue || errs[0].Variable != "v" {
+				t.Fatalf("err = %v, want an invalid_value error for v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services/repository"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrTooManyAPIKeys     = fmt.Errorf("too many api keys (max %d)", models.MaxAPIKeysPerUser)
+)
+
+// apiKeyTouchInterval 限制 last_used_at 的写入频率，避免每个请求都写库
+const apiKeyTouchInterval = time.Minute
+
+// dummyPasswordHash 邮箱不存在时用于比对的 bcrypt 哈希（DefaultCost），
+// 使未注册邮箱与密码错误的响应时间一致，无法据此探测已注册的邮箱
+const dummyPasswordHash = "$2a$10$Ip5D8EI/O6ms5kP3GDtNoei1wMy2jB4bQKA5ZfESogWm9BxP314r6"
+
+// AuthService 认证服务
+type AuthService struct {
+	users   repository.UserRepository
+	apiKeys repository.APIKeyRepository
+	tokens  *auth.TokenManager
+}
+
+// NewAuthService 创建认证服务
+func NewAuthService(users repository.UserRepository, apiKeys repository.APIKeyRepository, tokens *auth.TokenManager) *AuthService {
+	return &AuthService{users: users, apiKeys: apiKeys, tokens: tokens}
+}
+
+// Register 注册新用户并签发令牌
+func (s *AuthService) Register(req models.RegisterRequest) (*models.AuthResponse, error) {
+	email := models.NormalizeEmail(req.Email)
+	if _, err := s.users.GetByEmail(email); err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		ID:           uuid.New(),
+		Email:        email,
+		PasswordHash: string(hash),
+		DisplayName:  strings.TrimSpace(req.DisplayName),
+		Role:         models.RoleUser,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	if err := s.users.Create(user); err != nil {
+		// 并发注册同一邮箱时由唯一索引兜底
+		if isDuplicateKey(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+
+	return s.issue(user)
+}
+
+// Login 校验邮箱和密码并签发令牌
+func (s *AuthService) Login(req models.LoginRequest) (*models.AuthResponse, error) {
+	user, err := s.users.GetByEmail(models.NormalizeEmail(req.Email))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(req.Password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return s.issue(user)
+}
+
+// GetUser 获取用户
+func (s *AuthService) GetUser(id uuid.UUID) (*models.User, error) {
+	return s.users.GetByID(id)
+}
+
+// Authenticate 校验 Bearer 令牌并返回调用方身份。
+// 与 API 密钥相同，角色以用户表为准：令牌有效期内降级或删除的用户立即失去相应权限。
+func (s *AuthService) Authenticate(token string) (*auth.Identity, error) {
+	claims, err := s.tokens.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetByID(claims.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, err
+	}
+	return &auth.Identity{UserID: user.ID, Role: user.Role}, nil
+}
+
+// AuthenticateAPIKey 校验 API 密钥并返回其所属用户的身份
+func (s *AuthService) AuthenticateAPIKey(key string) (*auth.Identity, error) {
+	if !auth.IsAPIKey(key) {
+		return nil, auth.ErrInvalidToken
+	}
+	apiKey, err := s.apiKeys.GetByHash(auth.HashAPIKey(key))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, err
+	}
+	// 角色以用户表为准，管理员权限变化立即对已有密钥生效
+	user, err := s.users.GetByID(apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.apiKeys.TouchLastUsed(apiKey.ID, now); err != nil {
+			log.Printf("failed to update api key last_used_at: %v", err)
+		}
+	}
+
+	return &auth.Identity{UserID: user.ID, Role: user.Role}, nil
+}
+
+// CreateAPIKey 为用户创建 API 密钥，明文只在此时返回
+func (s *AuthService) CreateAPIKey(userID uuid.UUID, req models.CreateAPIKeyRequest) (*models.CreateAPIKeyResponse, error) {
+	count, err := s.apiKeys.CountByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if count >= models.MaxAPIKeysPerUser {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	key, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	apiKey := &models.APIKey{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    key[:len(auth.APIKeyPrefix)+8],
+		KeyHash:   auth.HashAPIKey(key),
+		CreatedAt: time.Now(),
+	}
+	if err := s.apiKeys.Create(apiKey); err != nil {
+		return nil, err
+	}
+
+	return &models.CreateAPIKeyResponse{APIKey: apiKey, Key: key}, nil
+}
+
+// ListAPIKeys 获取用户的 API 密钥
+func (s *AuthService) ListAPIKeys(userID uuid.UUID) ([]models.APIKey, error) {
+	return s.apiKeys.ListByUserID(userID)
+}
+
+// DeleteAPIKey 吊销用户的 API 密钥
+func (s *AuthService) DeleteAPIKey(userID, id uuid.UUID) error {
+	if err := s.apiKeys.DeleteByOwner(id, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *AuthService) issue(user *models.User) (*models.AuthResponse, error) {
+	token, expiresAt, err := s.tokens.Issue(auth.Identity{UserID: user.ID, Role: user.Role})
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      user,
+	}, nil
+}
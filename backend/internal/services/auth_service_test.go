@@ -0,0 +1,88 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type fakeUserRepo struct {
+	users []*models.User
+}
+
+func (f *fakeUserRepo) Create(user *models.User) error {
+	f.users = append(f.users, user)
+	return nil
+}
+
+func (f *fakeUserRepo) GetByID(id uuid.UUID) (*models.User, error) {
+	for _, user := range f.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeUserRepo) GetByEmail(email string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func TestDummyPasswordHashCost(t *testing.T) {
+	cost, err := bcrypt.Cost([]byte(dummyPasswordHash))
+	if err != nil {
+		t.Fatalf("dummyPasswordHash is not a bcrypt hash: %v", err)
+	}
+	if cost != bcrypt.DefaultCost {
+		t.Fatalf("dummyPasswordHash cost = %d, want %d (same as stored passwords)", cost, bcrypt.DefaultCost)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := &fakeUserRepo{users: []*models.User{{ID: uuid.New(), Email: "user@example.com", PasswordHash: string(hash), Role: models.RoleUser}}}
+	service := NewAuthService(users, nil, auth.NewTokenManager([]byte("0123456789abcdef0123456789abcdef"), time.Hour))
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantErr  error
+	}{
+		{"valid", "User@Example.com ", "correct horse", nil},
+		{"wrong password", "user@example.com", "wrong", ErrInvalidCredentials},
+		{"unknown email", "nobody@example.com", "correct horse", ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			resp, err := service.Login(models.LoginRequest{Email: tt.email, Password: tt.password})
+			elapsed := time.Since(start)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && resp.User.ID != users.users[0].ID {
+				t.Fatalf("logged in as %v", resp.User.ID)
+			}
+			// 每个分支都执行一次 bcrypt 比对（DefaultCost 下远超 1ms）
+			if elapsed < time.Millisecond {
+				t.Errorf("login returned in %v, expected a bcrypt comparison", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+)
+
+// batchWorkers 批量生成时并发渲染的 worker 数
+const batchWorkers = 8
+
+// GenerateBatch 使用同一模板渲染多组变量，结果按请求顺序返回。
+// 模板不存在、无权访问或模板本身无效时整体返回错误；单组变量校验或渲染失败只记录在对应的结果中。
+// 使用次数（按成功的条数）和使用统计在批次结束后一次性交给 UsageRecorder，写库失败时记录日志并在下次刷新重试。
+func (s *TemplateService) GenerateBatch(req models.BatchGenerateRequest, viewer *auth.Identity) (*models.BatchGenerateResponse, error) {
+	prepared, err := s.prepareTemplate(req.TemplateID, req.Version, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]models.BatchGenerateResult, len(req.Items))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := batchWorkers
+	if len(req.Items) < workers {
+		workers = len(req.Items)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = prepared.renderItem(i, req.Item(i))
+			}
+		}()
+	}
+	for i := range req.Items {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	resp := &models.BatchGenerateResponse{Results: results}
+	for _, result := range results {
+		if result.GenerateResponse != nil {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	s.recordUsage(models.UsageEvent{
+		TemplateID:  req.TemplateID,
+		At:          time.Now(),
+		UserID:      callerID(viewer),
+		Generations: len(results),
+		Errors:      resp.Failed,
+	})
+
+	s.usage.Add(req.TemplateID, resp.Succeeded)
+
+	return resp, nil
+}
+
+// renderItem 渲染批量生成中的一条，错误记录在结果中
+func (p *preparedTemplate) renderItem(index int, req models.GenerateRequest) models.BatchGenerateResult {
+	result := models.BatchGenerateResult{Index: index}
+
+	err := req.Validate()
+	if err == nil {
+		result.GenerateResponse, err = p.render(req.Variables, req.Strict)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		var variableErrs models.VariableErrors
+		if errors.As(err, &variableErrs) {
+			result.Errors = variableErrs
+		}
+	}
+	return result
+}
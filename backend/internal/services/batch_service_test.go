@@ -0,0 +1,59 @@
+package services
+
+import (
+	"testing"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerateBatchRecordsUsage(t *testing.T) {
+	caller := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+	repo := &fakeTemplateRepo{}
+	tmpl := repo.add(&models.PromptTemplate{UserID: caller.UserID, Content: "Hello {{name}}"})
+
+	// 第一次写库失败：批量生成的计数与单次生成走同一个记录器，失败后重试而不是丢弃
+	counts := &fakeUsageCounts{failures: failures{failOn: map[int]bool{1: true}}}
+	stats := &fakeStatsStore{}
+	usage := NewUsageRecorder(counts, testFlushInterval)
+	s := NewTemplateService(repo, nil, stats, usage)
+
+	resp, err := s.GenerateBatch(models.BatchGenerateRequest{
+		TemplateID: tmpl.ID,
+		Items:      []map[string]string{{"name": "a"}, {"name": "b"}, {}},
+	}, caller)
+	if err != nil {
+		t.Fatalf("GenerateBatch: %v", err)
+	}
+	if resp.Succeeded != 2 || resp.Failed != 1 {
+		t.Fatalf("succeeded=%d failed=%d, want 2/1", resp.Succeeded, resp.Failed)
+	}
+
+	if err := usage.Flush(); err == nil {
+		t.Fatal("first flush succeeded, want the injected error")
+	}
+	if err := usage.Flush(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if counts.counts[tmpl.ID] != 2 {
+		t.Errorf("usage_count incremented by %d, want the 2 successful items", counts.counts[tmpl.ID])
+	}
+	var generations, errs int64
+	for key, c := range stats.total.Hourly {
+		if key.TemplateID == tmpl.ID {
+			generations += c.Generations
+			errs += c.Errors
+		}
+	}
+	if generations != 3 || errs != 1 || len(stats.total.Callers) != 1 {
+		t.Errorf("stats: generations=%d errors=%d callers=%d, want 3/1/1", generations, errs, len(stats.total.Callers))
+	}
+	if len(stats.total.Values) != 0 {
+		t.Errorf("batch items recorded variable values: %v", stats.total.Values)
+	}
+	if m := usage.Metrics(); m.PendingIncrements != 0 || m.FailedFlushes != 1 {
+		t.Errorf("metrics after retry: %+v", m)
+	}
+}
@@ -0,0 +1,288 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+)
+
+const (
+	// datasetFlushEvery 每渲染多少行刷新一次输出
+	datasetFlushEvery = 50
+	// maxDatasetLineBytes JSONL 单行的最大长度
+	maxDatasetLineBytes = 1 << 20
+)
+
+// datasetRow 输入文件中的一行
+type datasetRow struct {
+	line      int
+	variables map[string]string
+}
+
+// datasetReader 逐行读取数据集。
+// 返回的 error 为行级错误时（*datasetRowError）可以继续读取，其他错误表示无法继续。
+type datasetReader interface {
+	Next() (*datasetRow, error)
+}
+
+// datasetRowError 单行格式错误，不影响后续行
+type datasetRowError struct {
+	line int
+	err  error
+}
+
+func (e *datasetRowError) Error() string {
+	return e.err.Error()
+}
+
+// DatasetWriter 逐行输出渲染结果
+type DatasetWriter interface {
+	Write(result models.DatasetResult) error
+	// Flush 将已写入的内容发送给调用方
+	Flush() error
+}
+
+// NewDatasetWriter 创建指定格式的结果输出。
+// w 实现 Flush() 时（如 HTTP 响应），Flush 会一并调用以实现流式输出。
+func NewDatasetWriter(format string, w io.Writer) (DatasetWriter, error) {
+	switch format {
+	case models.DatasetFormatJSONL:
+		return &jsonlDatasetWriter{w: w, enc: json.NewEncoder(w)}, nil
+	case models.DatasetFormatCSV:
+		return &csvDatasetWriter{w: w, csv: csv.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unsupported output format %q", format)
+}
+
+// RenderDataset 使用同一模板逐行渲染数据集，结果按输入顺序写入 output。
+// 模板不存在、无权访问或模板本身无效时在写入任何内容之前返回错误；
+// 单行的格式、变量或渲染错误作为该行的结果输出，不影响其他行。
+// 输入无法继续读取（如超出大小限制）或超出行数上限时输出一行错误后结束。
+// 使用次数（按成功的行数）和使用统计在结束后一次性交给 UsageRecorder，与批量生成相同。
+func (s *TemplateService) RenderDataset(req models.DatasetRequest, input io.Reader, output DatasetWriter, viewer *auth.Identity) (*models.DatasetSummary, error) {
+	prepared, err := s.prepareTemplate(req.TemplateID, req.Version, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.DatasetSummary{}
+	defer func() {
+		s.recordUsage(models.UsageEvent{
+			TemplateID:  req.TemplateID,
+			At:          time.Now(),
+			UserID:      callerID(viewer),
+			Generations: summary.Rows,
+			Errors:      summary.Failed,
+		})
+		s.usage.Add(req.TemplateID, summary.Succeeded)
+	}()
+
+	reader := newDatasetReader(req.InputFormat, input)
+	for {
+		row, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		var result models.DatasetResult
+		stop := false
+		var rowErr *datasetRowError
+		switch {
+		case errors.As(err, &rowErr):
+			result = models.DatasetResult{Line: rowErr.line, Error: rowErr.Error()}
+		case err != nil:
+			result = models.DatasetResult{Error: fmt.Sprintf("read input: %v", err)}
+			stop = true
+		case summary.Rows >= models.MaxDatasetRows:
+			result = models.DatasetResult{Line: row.line, Error: fmt.Sprintf("too many rows (max %d)", models.MaxDatasetRows)}
+			stop = true
+		default:
+			item := prepared.renderItem(summary.Rows, models.GenerateRequest{
+				TemplateID: req.TemplateID,
+				Variables:  row.variables,
+				Version:    req.Version,
+				Strict:     req.Strict,
+			})
+			result = models.DatasetResult{Line: row.line, GenerateResponse: item.GenerateResponse, Error: item.Error, Errors: item.Errors}
+		}
+
+		summary.Rows++
+		if result.GenerateResponse != nil {
+			summary.Succeeded++
+		} else {
+			summary.Failed++
+		}
+		if err := output.Write(result); err != nil {
+			return summary, err
+		}
+		if stop {
+			break
+		}
+		if summary.Rows%datasetFlushEvery == 0 {
+			if err := output.Flush(); err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	return summary, output.Flush()
+}
+
+func newDatasetReader(format string, r io.Reader) datasetReader {
+	if format == models.DatasetFormatCSV {
+		reader := csv.NewReader(r)
+		reader.ReuseRecord = true
+		return &csvDatasetReader{reader: reader}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDatasetLineBytes)
+	return &jsonlDatasetReader{scanner: scanner}
+}
+
+// csvDatasetReader 第一行为表头，列名即变量名，空单元格视为未传入
+type csvDatasetReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func (r *csvDatasetReader) Next() (*datasetRow, error) {
+	if r.header == nil {
+		header, err := r.reader.Read()
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV header: %w", err)
+		}
+		r.header = make([]string, len(header))
+		for i, name := range header {
+			if i == 0 {
+				// 去掉 Excel 导出的 UTF-8 BOM
+				name = strings.TrimPrefix(name, "\uFEFF")
+			}
+			r.header[i] = strings.TrimSpace(name)
+		}
+	}
+
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, &datasetRowError{line: parseErr.StartLine, err: err}
+		}
+		return nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+
+	variables := make(map[string]string, len(record))
+	for i, value := range record {
+		if r.header[i] != "" && value != "" {
+			variables[r.header[i]] = value
+		}
+	}
+	return &datasetRow{line: line, variables: variables}, nil
+}
+
+// jsonlDatasetReader 每行一个 JSON 对象，非字符串的值按其 JSON 文本传入（如数组变量）
+type jsonlDatasetReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (r *jsonlDatasetReader) Next() (*datasetRow, error) {
+	for r.scanner.Scan() {
+		r.line++
+		data := bytes.TrimSpace(r.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			// 读取出错时 Scanner 仍会返回已读到的半行，此时应报告读取错误
+			if readErr := r.scanner.Err(); readErr != nil {
+				return nil, readErr
+			}
+			return nil, &datasetRowError{line: r.line, err: errors.New("each line must be a JSON object")}
+		}
+		variables := make(map[string]string, len(fields))
+		for name, raw := range fields {
+			var s string
+			switch {
+			case string(raw) == "null":
+				continue
+			case json.Unmarshal(raw, &s) == nil:
+				variables[name] = s
+			default:
+				variables[name] = string(raw)
+			}
+		}
+		return &datasetRow{line: r.line, variables: variables}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+type jsonlDatasetWriter struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+func (w *jsonlDatasetWriter) Write(result models.DatasetResult) error {
+	return w.enc.Encode(result)
+}
+
+func (w *jsonlDatasetWriter) Flush() error {
+	flushWriter(w.w)
+	return nil
+}
+
+// csvDatasetWriter 输出 line,prompt,error 三列，对话模板的 prompt 为拼接后的文本
+type csvDatasetWriter struct {
+	w           io.Writer
+	csv         *csv.Writer
+	wroteHeader bool
+}
+
+func (w *csvDatasetWriter) Write(result models.DatasetResult) error {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if err := w.csv.Write([]string{"line", "prompt", "error"}); err != nil {
+			return err
+		}
+	}
+	prompt := ""
+	if result.GenerateResponse != nil {
+		prompt = result.Prompt
+	}
+	return w.csv.Write([]string{fmt.Sprint(result.Line), prompt, result.Error})
+}
+
+func (w *csvDatasetWriter) Flush() error {
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	flushWriter(w.w)
+	return nil
+}
+
+func flushWriter(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
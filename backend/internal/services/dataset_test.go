@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// recordingDatasetWriter 记录写入的结果，以及每次 Flush 时已写入的行数
+type recordingDatasetWriter struct {
+	results []models.DatasetResult
+	flushes []int
+}
+
+func (w *recordingDatasetWriter) Write(result models.DatasetResult) error {
+	w.results = append(w.results, result)
+	return nil
+}
+
+func (w *recordingDatasetWriter) Flush() error {
+	w.flushes = append(w.flushes, len(w.results))
+	return nil
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+func newDatasetFixture(t *testing.T) (*TemplateService, *models.PromptTemplate, *auth.Identity) {
+	t.Helper()
+	caller := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+	repo := &fakeTemplateRepo{}
+	tmpl := repo.add(&models.PromptTemplate{UserID: caller.UserID, Content: "Hello {{name}}"})
+	return NewTemplateService(repo, nil, nil, nil), tmpl, caller
+}
+
+func TestRenderDatasetParsesInput(t *testing.T) {
+	type row struct {
+		line   int
+		prompt string // 为空表示该行应失败
+	}
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   []row
+	}{
+		{
+			name:   "csv",
+			format: models.DatasetFormatCSV,
+			// BOM 和表头两侧的空格被去掉，空单元格视为未传入，格式错误的行单独报错
+			input: "\uFEFF name ,extra\nAlice,1\n,2\nB\"ob,3\nCarol,\n",
+			want:  []row{{2, "Hello Alice"}, {3, ""}, {4, ""}, {5, "Hello Carol"}},
+		},
+		{
+			name:   "csv field count",
+			format: models.DatasetFormatCSV,
+			input:  "name\nAlice\nBob,extra\nCarol\n",
+			want:   []row{{2, "Hello Alice"}, {3, ""}, {4, "Hello Carol"}},
+		},
+		{
+			name:   "csv header only",
+			format: models.DatasetFormatCSV,
+			input:  "name\n",
+		},
+		{
+			name:   "jsonl",
+			format: models.DatasetFormatJSONL,
+			// 空行跳过但计入行号，null 视为未传入，非字符串的值按 JSON 文本传入
+			input: "{\"name\":\"Alice\"}\n\n{\"name\":null}\nnot json\n{\"name\":[\"a\",\"b\"]}\n{\"name\":42}",
+			want:  []row{{1, "Hello Alice"}, {3, ""}, {4, ""}, {5, `Hello ["a","b"]`}, {6, "Hello 42"}},
+		},
+		{
+			name:   "control characters",
+			format: models.DatasetFormatJSONL,
+			// NUL 无法写入生成记录和使用统计，与单条生成一样按变量错误拒绝
+			input: "{\"name\":\"a\\u0000b\"}\n{\"name\":\"Bob\"}\n",
+			want:  []row{{1, ""}, {2, "Hello Bob"}},
+		},
+		{
+			name:   "empty",
+			format: models.DatasetFormatJSONL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, tmpl, caller := newDatasetFixture(t)
+			out := &recordingDatasetWriter{}
+			summary, err := s.RenderDataset(models.DatasetRequest{TemplateID: tmpl.ID, InputFormat: tt.format}, strings.NewReader(tt.input), out, caller)
+			if err != nil {
+				t.Fatalf("RenderDataset: %v", err)
+			}
+			if len(out.results) != len(tt.want) {
+				t.Fatalf("got %d results %+v, want %d", len(out.results), out.results, len(tt.want))
+			}
+			succeeded := 0
+			for i, want := range tt.want {
+				got := out.results[i]
+				if got.Line != want.line {
+					t.Errorf("result %d: line %d, want %d", i, got.Line, want.line)
+				}
+				switch {
+				case want.prompt == "" && (got.GenerateResponse != nil || (got.Error == "" && len(got.Errors) == 0)):
+					t.Errorf("line %d: want an error, got %+v", want.line, got)
+				case want.prompt != "" && (got.GenerateResponse == nil || got.Prompt != want.prompt):
+					t.Errorf("line %d: got %+v, want prompt %q", want.line, got, want.prompt)
+				}
+				if want.prompt != "" {
+					succeeded++
+				}
+			}
+			if summary.Rows != len(tt.want) || summary.Succeeded != succeeded || summary.Failed != len(tt.want)-succeeded {
+				t.Errorf("summary %+v, want rows=%d succeeded=%d", summary, len(tt.want), succeeded)
+			}
+		})
+	}
+}
+
+func TestRenderDatasetRowLimit(t *testing.T) {
+	s, tmpl, caller := newDatasetFixture(t)
+	var input strings.Builder
+	for i := 0; i < models.MaxDatasetRows+5; i++ {
+		fmt.Fprintf(&input, "{\"name\":\"user%d\"}\n", i)
+	}
+
+	out := &recordingDatasetWriter{}
+	summary, err := s.RenderDataset(models.DatasetRequest{TemplateID: tmpl.ID, InputFormat: models.DatasetFormatJSONL}, strings.NewReader(input.String()), out, caller)
+	if err != nil {
+		t.Fatalf("RenderDataset: %v", err)
+	}
+	// 超出上限的第一行输出错误后结束，其余行不再读取
+	if len(out.results) != models.MaxDatasetRows+1 {
+		t.Fatalf("got %d results, want %d", len(out.results), models.MaxDatasetRows+1)
+	}
+	last := out.results[len(out.results)-1]
+	if last.Line != models.MaxDatasetRows+1 || !strings.Contains(last.Error, "too many rows") {
+		t.Errorf("last result %+v, want a too many rows error on line %d", last, models.MaxDatasetRows+1)
+	}
+	if summary.Succeeded != models.MaxDatasetRows || summary.Failed != 1 {
+		t.Errorf("summary %+v", summary)
+	}
+}
+
+func TestRenderDatasetFlushCadence(t *testing.T) {
+	s, tmpl, caller := newDatasetFixture(t)
+	var input strings.Builder
+	for i := 0; i < 2*datasetFlushEvery+20; i++ {
+		fmt.Fprintf(&input, "{\"name\":\"user%d\"}\n", i)
+	}
+
+	out := &recordingDatasetWriter{}
+	if _, err := s.RenderDataset(models.DatasetRequest{TemplateID: tmpl.ID, InputFormat: models.DatasetFormatJSONL}, strings.NewReader(input.String()), out, caller); err != nil {
+		t.Fatalf("RenderDataset: %v", err)
+	}
+	want := []int{datasetFlushEvery, 2 * datasetFlushEvery, 2*datasetFlushEvery + 20}
+	if fmt.Sprint(out.flushes) != fmt.Sprint(want) {
+		t.Errorf("flushed after %v rows, want %v", out.flushes, want)
+	}
+}
+
+func TestRenderDatasetReadError(t *testing.T) {
+	s, tmpl, caller := newDatasetFixture(t)
+	input := io.MultiReader(strings.NewReader("{\"name\":\"Alice\"}\n"), failingReader{errors.New("connection reset")})
+
+	out := &recordingDatasetWriter{}
+	summary, err := s.RenderDataset(models.DatasetRequest{TemplateID: tmpl.ID, InputFormat: models.DatasetFormatJSONL}, input, out, caller)
+	if err != nil {
+		t.Fatalf("RenderDataset: %v", err)
+	}
+	if len(out.results) != 2 || out.results[0].GenerateResponse == nil {
+		t.Fatalf("results %+v, want the first row followed by a read error", out.results)
+	}
+	if got := out.results[1].Error; !strings.Contains(got, "read input") || !strings.Contains(got, "connection reset") {
+		t.Errorf("error row %q, want the read error", got)
+	}
+	if summary.Rows != 2 || summary.Failed != 1 {
+		t.Errorf("summary %+v", summary)
+	}
+}
+
+func TestRenderDatasetTemplateErrorBeforeOutput(t *testing.T) {
+	s, _, caller := newDatasetFixture(t)
+	out := &recordingDatasetWriter{}
+	_, err := s.RenderDataset(models.DatasetRequest{TemplateID: uuid.New(), InputFormat: models.DatasetFormatJSONL}, strings.NewReader("{}\n"), out, caller)
+	if !errors.Is(err, ErrTemplateNotFound) {
+		t.Fatalf("err = %v, want ErrTemplateNotFound", err)
+	}
+	if len(out.results) != 0 || len(out.flushes) != 0 {
+		t.Errorf("wrote %d results and %d flushes before failing", len(out.results), len(out.flushes))
+	}
+}
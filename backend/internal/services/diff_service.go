@@ -0,0 +1,217 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// diffContextLines 统一 diff 中每个变更块前后保留的上下文行数
+const diffContextLines = 3
+
+// variableDiffIgnoredFields 比较变量时忽略的字段（存储相关，不属于变量定义）
+var variableDiffIgnoredFields = map[string]bool{
+	"id":          true,
+	"template_id": true,
+	"created_at":  true,
+	"name":        true,
+}
+
+// DiffTemplates 比较两个模板（或模板的两个版本）
+func (s *TemplateService) DiffTemplates(a, b models.TemplateRef, viewer *auth.Identity) (*models.TemplateDiff, error) {
+	from, err := s.resolveSnapshot(a, viewer)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.resolveSnapshot(b, viewer)
+	if err != nil {
+		return nil, err
+	}
+	return buildTemplateDiff(from, to, false)
+}
+
+// PreviewTemplateUpdate 将更新请求应用到模板当前版本的副本上并与当前版本比较，不落库
+func (s *TemplateService) PreviewTemplateUpdate(id uuid.UUID, req models.UpdateTemplateRequest, viewer *auth.Identity) (*models.TemplateDiff, error) {
+	tmpl, err := s.GetTemplate(id, viewer)
+	if err != nil {
+		return nil, err
+	}
+	from := snapshotOf(tmpl)
+
+	proposed := *tmpl
+	if err := s.applyUpdate(&proposed, req, viewer); err != nil {
+		return nil, err
+	}
+	return buildTemplateDiff(from, snapshotOf(&proposed), true)
+}
+
+// resolveSnapshot 获取模板引用对应的内容快照
+func (s *TemplateService) resolveSnapshot(ref models.TemplateRef, viewer *auth.Identity) (*models.PromptTemplateVersion, error) {
+	tmpl, err := s.GetTemplate(ref.ID, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Version == nil || *ref.Version == tmpl.Version {
+		return snapshotOf(tmpl), nil
+	}
+	return s.getVersion(ref.ID, *ref.Version)
+}
+
+func snapshotOf(tmpl *models.PromptTemplate) *models.PromptTemplateVersion {
+	return &models.PromptTemplateVersion{
+		TemplateID:  tmpl.ID,
+		Version:     tmpl.Version,
+		Name:        tmpl.Name,
+		Description: tmpl.Description,
+		Content:     tmpl.Content,
+		Variables:   tmpl.Variables,
+		Kind:        tmpl.EffectiveKind(),
+		Messages:    tmpl.Messages,
+		Category:    tmpl.Category,
+	}
+}
+
+func snapshotKind(v *models.PromptTemplateVersion) string {
+	if v.Kind == "" {
+		return models.TemplateKindText
+	}
+	return v.Kind
+}
+
+func buildTemplateDiff(from, to *models.PromptTemplateVersion, proposed bool) (*models.TemplateDiff, error) {
+	fromLabel := fmt.Sprintf("a/%s@%d", from.TemplateID, from.Version)
+	toLabel := fmt.Sprintf("b/%s@%d", to.TemplateID, to.Version)
+	if proposed {
+		toLabel = fmt.Sprintf("b/%s (proposed)", to.TemplateID)
+	}
+
+	diff := &models.TemplateDiff{
+		From:    models.DiffSide{TemplateID: from.TemplateID, Version: from.Version, Name: from.Name},
+		To:      models.DiffSide{TemplateID: to.TemplateID, Version: to.Version, Name: to.Name, Proposed: proposed},
+		Fields:  make([]models.FieldChange, 0),
+		Content: unifiedDiff(fromLabel, toLabel, from.Content, to.Content, diffContextLines),
+	}
+
+	for _, f := range []struct {
+		name     string
+		old, new string
+	}{
+		{"name", from.Name, to.Name},
+		{"description", from.Description, to.Description},
+		{"category", from.Category, to.Category},
+		{"kind", snapshotKind(from), snapshotKind(to)},
+	} {
+		if f.old != f.new {
+			diff.Fields = append(diff.Fields, models.FieldChange{Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+
+	variables, err := diffVariables(from.Variables, to.Variables)
+	if err != nil {
+		return nil, err
+	}
+	diff.Variables = *variables
+
+	diff.Identical = len(diff.Fields) == 0 && diff.Content == "" &&
+		len(variables.Added) == 0 && len(variables.Removed) == 0 && len(variables.Changed) == 0
+	return diff, nil
+}
+
+// diffVariables 按变量名比较两组变量定义
+func diffVariables(fromData, toData models.JSONB) (*models.VariablesDiff, error) {
+	fromVars, err := parseVariables(fromData)
+	if err != nil {
+		return nil, err
+	}
+	toVars, err := parseVariables(toData)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.VariablesDiff{
+		Added:   make([]models.TemplateVariable, 0),
+		Removed: make([]models.TemplateVariable, 0),
+		Changed: make([]models.VariableChange, 0),
+	}
+
+	fromByName := make(map[string]models.TemplateVariable, len(fromVars))
+	for _, v := range fromVars {
+		fromByName[v.Name] = v
+	}
+	toByName := make(map[string]models.TemplateVariable, len(toVars))
+	for _, v := range toVars {
+		toByName[v.Name] = v
+	}
+
+	for _, v := range fromVars {
+		if _, ok := toByName[v.Name]; !ok {
+			result.Removed = append(result.Removed, v)
+		}
+	}
+	for _, v := range toVars {
+		old, ok := fromByName[v.Name]
+		if !ok {
+			result.Added = append(result.Added, v)
+			continue
+		}
+		changes, err := diffVariableFields(old, v)
+		if err != nil {
+			return nil, err
+		}
+		if len(changes) > 0 {
+			result.Changed = append(result.Changed, models.VariableChange{Name: v.Name, Changes: changes})
+		}
+	}
+
+	return result, nil
+}
+
+// diffVariableFields 按 JSON 字段比较同名变量，新增的变量属性无需在此处单独处理
+func diffVariableFields(a, b models.TemplateVariable) ([]models.FieldChange, error) {
+	aFields, err := variableFields(a)
+	if err != nil {
+		return nil, err
+	}
+	bFields, err := variableFields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(aFields)+len(bFields))
+	seen := make(map[string]bool)
+	for _, fields := range []map[string]interface{}{aFields, bFields} {
+		for key := range fields {
+			if !seen[key] && !variableDiffIgnoredFields[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	changes := make([]models.FieldChange, 0)
+	for _, key := range keys {
+		if !reflect.DeepEqual(aFields[key], bFields[key]) {
+			changes = append(changes, models.FieldChange{Field: key, Old: aFields[key], New: bFields[key]})
+		}
+	}
+	return changes, nil
+}
+
+func variableFields(v models.TemplateVariable) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"errors"
+	"sync"
+
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// fakeTemplateRepo 内存中的模板仓库，只实现测试用到的方法，其余方法调用时 panic
+type fakeTemplateRepo struct {
+	repository.TemplateRepository
+	templates []*models.PromptTemplate
+	versions  []*models.PromptTemplateVersion
+}
+
+func (f *fakeTemplateRepo) add(tmpl *models.PromptTemplate) *models.PromptTemplate {
+	if tmpl.ID == uuid.Nil {
+		tmpl.ID = uuid.New()
+	}
+	if tmpl.Version == 0 {
+		tmpl.Version = 1
+	}
+	f.templates = append(f.templates, tmpl)
+	return tmpl
+}
+
+func (f *fakeTemplateRepo) GetByID(id uuid.UUID) (*models.PromptTemplate, error) {
+	for _, tmpl := range f.templates {
+		if tmpl.ID == id {
+			copied := *tmpl
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeTemplateRepo) GetBySlug(slug string) (*models.PromptTemplate, error) {
+	for _, tmpl := range f.templates {
+		if tmpl.Slug != nil && *tmpl.Slug == slug {
+			copied := *tmpl
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeTemplateRepo) GetVersion(templateID uuid.UUID, version int) (*models.PromptTemplateVersion, error) {
+	for _, v := range f.versions {
+		if v.TemplateID == templateID && v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (f *fakeTemplateRepo) UpdateByOwner(tmpl *models.PromptTemplate, ownerID uuid.UUID) error {
+	for i, existing := range f.templates {
+		if existing.ID == tmpl.ID && existing.UserID == ownerID {
+			tmpl.Version = existing.Version + 1
+			copied := *tmpl
+			f.templates[i] = &copied
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// failures 按调用序号（从 1 开始）注入错误，用于模拟写库失败后重试
+type failures struct {
+	calls  int
+	failOn map[int]bool
+}
+
+func (f *failures) next() error {
+	f.calls++
+	if f.failOn[f.calls] {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+// fakeUsageCounts 记录 IncrementUsage 写入的使用次数
+type fakeUsageCounts struct {
+	repository.TemplateRepository
+	failures
+	mu     sync.Mutex
+	counts map[uuid.UUID]int
+}
+
+func (f *fakeUsageCounts) IncrementUsage(counts map[uuid.UUID]int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.next(); err != nil {
+		return err
+	}
+	if f.counts == nil {
+		f.counts = make(map[uuid.UUID]int)
+	}
+	for id, n := range counts {
+		f.counts[id] += n
+	}
+	return nil
+}
+
+// errUntranslatable Postgres 拒绝写入 NUL 时返回的数据错误
+var errUntranslatable = &pgconn.PgError{Severity: "ERROR", Code: "22P05", Message: "unsupported Unicode escape sequence"}
+
+// fakeRunStore 记录 CreateBatch 写入的生成记录。包含 reject 中的 ID 的整批写入返回数据错误
+type fakeRunStore struct {
+	repository.GenerationRunRepository
+	failures
+	reject map[uuid.UUID]bool
+	mu     sync.Mutex
+	runs   []*models.GenerationRun
+}
+
+func (f *fakeRunStore) CreateBatch(runs []*models.GenerationRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.next(); err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if f.reject[run.ID] {
+			return errUntranslatable
+		}
+	}
+	f.runs = append(f.runs, runs...)
+	return nil
+}
+
+// fakeStatsStore 累加 RecordBatch 写入的使用统计。包含 reject 中的取值的整批写入返回数据错误
+type fakeStatsStore struct {
+	repository.UsageStatsRepository
+	failures
+	reject map[string]bool
+	mu     sync.Mutex
+	total  *models.UsageStatsBatch
+}
+
+func (f *fakeStatsStore) RecordBatch(batch *models.UsageStatsBatch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.next(); err != nil {
+		return err
+	}
+	for key := range batch.Values {
+		if f.reject[key.Value] {
+			return errUntranslatable
+		}
+	}
+	if f.total == nil {
+		f.total = models.NewUsageStatsBatch()
+	}
+	f.total.Merge(batch)
+	return nil
+}
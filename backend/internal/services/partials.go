@@ -0,0 +1,116 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrPrivatePartial 公开模板包含了私有模板
+var ErrPrivatePartial = errors.New("public templates can only include public partials")
+
+// partialScope 返回以调用方身份展开 partial 的上下文。
+//   - 被包含的模板需对调用方可见（与直接查看该模板的权限相同），
+//     因此渲染他人的模板时，其中的私有 partial 不会泄露给调用方；
+//   - public 为 true（外层模板公开或将要公开）时，被包含的模板也必须公开，
+//     保证公开模板对所有调用方渲染出相同的内容。
+//
+// {{> template:ref}} 总是使用被包含模板的当前版本，外层模板指定历史版本生成时也是如此；
+// 需要固定内容时使用 {{> template:ref@N}} 引用第 N 版。
+func (s *TemplateService) partialScope(viewer *auth.Identity, templateID uuid.UUID, public bool) *partialScope {
+	cache := make(map[string]*models.PromptTemplate)
+	resolve := func(ref string) (*models.PromptTemplate, error) {
+		ref, versionStr, pinned := strings.Cut(ref, "@")
+		tmpl, ok := cache[ref]
+		if !ok {
+			var err error
+			if id, parseErr := uuid.Parse(ref); parseErr == nil {
+				tmpl, err = s.repo.GetByID(id)
+			} else {
+				tmpl, err = s.repo.GetBySlug(ref)
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrTemplateNotFound
+			}
+			if err != nil {
+				return nil, err
+			}
+			cache[ref] = tmpl
+		}
+		if !canView(tmpl, viewer) {
+			return nil, ErrTemplateNotFound
+		}
+		if public && !tmpl.IsPublic {
+			return nil, ErrPrivatePartial
+		}
+		if !pinned {
+			return tmpl, nil
+		}
+
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, ErrVersionNotFound
+		}
+		if version == tmpl.Version {
+			return tmpl, nil
+		}
+		snapshot, err := s.getVersion(tmpl.ID, version)
+		if err != nil {
+			return nil, err
+		}
+		// 可见性以模板当前的设置为准，内容使用指定版本
+		pinnedTmpl := *tmpl
+		pinnedTmpl.Version = snapshot.Version
+		pinnedTmpl.Content = snapshot.Content
+		pinnedTmpl.Variables = snapshot.Variables
+		pinnedTmpl.Kind = snapshot.Kind
+		pinnedTmpl.Messages = snapshot.Messages
+		return &pinnedTmpl, nil
+	}
+	return &partialScope{resolve: resolve, templateID: templateID}
+}
+
+// ExtractVariables 从模板内容中提取变量（包括 {{#if}}、{{#each}} 等块以及 partial 中引用的变量），
+// 对话模板从所有消息中提取。模板语法错误或 partial 无法解析时返回 ErrInvalidTemplate
+func (s *TemplateService) ExtractVariables(kind, content string, messages models.ChatMessages, viewer *auth.Identity) ([]string, error) {
+	compiled, err := compileBody(kind, content, messages, s.partialScope(viewer, uuid.Nil, false))
+	if err != nil {
+		return nil, err
+	}
+	if compiled.variables == nil {
+		return []string{}, nil
+	}
+	return compiled.variables, nil
+}
+
+// mergePartialVariables 将 partial 中声明的变量合并到模板的变量定义中，
+// 同名变量以外层模板的定义为准
+func mergePartialVariables(declared []models.TemplateVariable, compiled *compiledTemplate) ([]models.TemplateVariable, error) {
+	if len(compiled.partials) == 0 {
+		return declared, nil
+	}
+	seen := make(map[string]bool, len(declared))
+	for _, variable := range declared {
+		seen[variable.Name] = true
+	}
+	merged := declared
+	for _, partial := range compiled.partials {
+		variables, err := parseVariables(partial.Variables)
+		if err != nil {
+			return nil, err
+		}
+		for _, variable := range variables {
+			if !seen[variable.Name] {
+				seen[variable.Name] = true
+				merged = append(merged, variable)
+			}
+		}
+	}
+	return merged, nil
+}
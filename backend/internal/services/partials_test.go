@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestPartialVisibility(t *testing.T) {
+	owner := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+	other := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+
+	repo := &fakeTemplateRepo{}
+	repo.add(&models.PromptTemplate{UserID: owner.UserID, Slug: strPtr("secret"), Content: "private fragment"})
+	repo.add(&models.PromptTemplate{UserID: other.UserID, Slug: strPtr("shared"), Content: "public fragment", IsPublic: true})
+	publicIncluder := repo.add(&models.PromptTemplate{UserID: owner.UserID, Content: "{{> template:secret}}", IsPublic: true})
+	privateIncluder := repo.add(&models.PromptTemplate{UserID: owner.UserID, Content: "{{> template:secret}} + {{> template:shared}}"})
+	s := NewTemplateService(repo, nil, nil, nil)
+
+	tests := []struct {
+		name    string
+		tmpl    *models.PromptTemplate
+		viewer  *auth.Identity
+		want    string
+		errPart string
+	}{
+		{"owner renders own private partial", privateIncluder, owner, "private fragment + public fragment", ""},
+		{"public template with private partial, owner", publicIncluder, owner, "", "is private"},
+		{"public template with private partial, other user", publicIncluder, other, "", "not found"},
+		{"public template with private partial, anonymous", publicIncluder, nil, "", "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prepared, err := s.prepareTemplate(tt.tmpl.ID, nil, tt.viewer)
+			if tt.errPart != "" {
+				if !errors.Is(err, ErrInvalidTemplate) || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want ErrInvalidTemplate containing %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareTemplate: %v", err)
+			}
+			resp, err := prepared.render(nil, false)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if resp.Prompt != tt.want {
+				t.Errorf("prompt = %q, want %q", resp.Prompt, tt.want)
+			}
+		})
+	}
+
+	// 公开包含私有 partial 的模板会被拒绝
+	tmpl, _ := repo.GetByID(privateIncluder.ID)
+	public := true
+	err := s.applyUpdate(tmpl, models.UpdateTemplateRequest{IsPublic: &public}, owner)
+	if !errors.Is(err, ErrInvalidTemplate) || !strings.Contains(err.Error(), "is private") {
+		t.Fatalf("publishing template with private partial: err = %v", err)
+	}
+}
+
+func TestPartialVersionPinning(t *testing.T) {
+	owner := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+	repo := &fakeTemplateRepo{}
+	partial := repo.add(&models.PromptTemplate{UserID: owner.UserID, Slug: strPtr("footer"), Content: "footer v2", Version: 2, IsPublic: true})
+	repo.versions = append(repo.versions, &models.PromptTemplateVersion{TemplateID: partial.ID, Version: 1, Content: "footer v1"})
+	s := NewTemplateService(repo, nil, nil, nil)
+
+	tests := []struct {
+		content string
+		want    string
+		errPart string
+	}{
+		{"{{> template:footer}}", "footer v2", ""},
+		{"{{> template:footer@2}}", "footer v2", ""},
+		{"{{> template:footer@1}}", "footer v1", ""},
+		{"{{> template:" + partial.ID.String() + "@1}}", "footer v1", ""},
+		{"{{> template:footer@1}} / {{> template:footer}}", "footer v1 / footer v2", ""},
+		{"{{> template:footer@9}}", "", "version not found"},
+		{"{{> template:footer@0}}", "", "invalid partial reference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			includer := repo.add(&models.PromptTemplate{UserID: owner.UserID, Content: tt.content})
+			prepared, err := s.prepareTemplate(includer.ID, nil, owner)
+			if tt.errPart != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want %q", err, tt.errPart)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("prepareTemplate: %v", err)
+			}
+			resp, err := prepared.render(nil, false)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if resp.Prompt != tt.want {
+				t.Errorf("prompt = %q, want %q", resp.Prompt, tt.want)
+			}
+		})
+	}
+}
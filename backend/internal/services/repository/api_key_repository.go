@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"time"
+
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyRepository API 密钥仓库接口
+type APIKeyRepository interface {
+	Create(key *models.APIKey) error
+	GetByHash(hash string) (*models.APIKey, error)
+	ListByUserID(userID uuid.UUID) ([]models.APIKey, error)
+	CountByUserID(userID uuid.UUID) (int64, error)
+	DeleteByOwner(id, userID uuid.UUID) error
+	TouchLastUsed(id uuid.UUID, at time.Time) error
+}
+
+// apiKeyRepository API 密钥仓库实现
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository 创建 API 密钥仓库
+func NewAPIKeyRepository(db *gorm.DB) APIKeyRepository {
+	return &apiKeyRepository{db: db}
+}
+
+// Create 创建 API 密钥
+func (r *apiKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+// GetByHash 根据密钥哈希获取 API 密钥
+func (r *apiKeyRepository) GetByHash(hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := r.db.Where("key_hash = ?", hash).First(&key).Error
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListByUserID 获取用户的 API 密钥
+func (r *apiKeyRepository) ListByUserID(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := r.db.Where("user_id = ?", userID).Order("created_at desc").Find(&keys).Error
+	return keys, err
+}
+
+// CountByUserID 统计用户的 API 密钥数量
+func (r *apiKeyRepository) CountByUserID(userID uuid.UUID) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.APIKey{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// DeleteByOwner 删除属于指定用户的 API 密钥，不存在或不属于该用户时返回 gorm.ErrRecordNotFound
+func (r *apiKeyRepository) DeleteByOwner(id, userID uuid.UUID) error {
+	result := r.db.Delete(&models.APIKey{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// TouchLastUsed 更新最近使用时间
+func (r *apiKeyRepository) TouchLastUsed(id uuid.UUID, at time.Time) error {
+	return r.db.Model(&models.APIKey{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsDataError 是否为写入的数据本身被数据库拒绝（Postgres 错误类 22 数据异常、23 约束冲突），
+// 这类错误重试相同的数据不会成功；连接中断、超时等其他错误可以原样重试。
+func IsDataError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return strings.HasPrefix(pgErr.Code, "22") || strings.HasPrefix(pgErr.Code, "23")
+}
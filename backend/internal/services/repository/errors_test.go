@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestIsDataError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"untranslatable character", &pgconn.PgError{Code: "22P05"}, true},
+		{"character not in repertoire", &pgconn.PgError{Code: "22021"}, true},
+		{"wrapped", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "22001"}), true},
+		{"foreign key violation", &pgconn.PgError{Code: "23503"}, true},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, false},
+		{"serialization failure", &pgconn.PgError{Code: "40001"}, false},
+		{"not a postgres error", errors.New("connection reset"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsDataError(tt.err); got != tt.want {
+			t.Errorf("%s: IsDataError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GenerationRunRepository 生成记录仓库接口
+type GenerationRunRepository interface {
+	Create(run *models.GenerationRun) error
+	// CreateBatch 在一条 INSERT 语句中写入多条生成记录，已存在的 ID 和已删除模板的记录被跳过
+	CreateBatch(runs []*models.GenerationRun) error
+	GetByID(id uuid.UUID) (*models.GenerationRun, error)
+	// ListByTemplate 按时间倒序获取模板的生成记录，userID 不为空时只返回该用户的记录
+	ListByTemplate(templateID uuid.UUID, userID *uuid.UUID, limit, offset int) ([]models.GenerationRun, error)
+	DeleteBefore(t time.Time) (int64, error)
+}
+
+// generationRunRepository 生成记录仓库实现
+type generationRunRepository struct {
+	db *gorm.DB
+}
+
+// NewGenerationRunRepository 创建生成记录仓库
+func NewGenerationRunRepository(db *gorm.DB) GenerationRunRepository {
+	return &generationRunRepository{db: db}
+}
+
+// Create 写入生成记录
+func (r *generationRunRepository) Create(run *models.GenerationRun) error {
+	return r.db.Create(run).Error
+}
+
+// CreateBatch 批量写入生成记录。重复写入同一 ID 不报错，失败后可以整批重试；
+// 模板已删除的记录被丢弃，调用方已删除时 user_id 置空，避免外键错误使整批无法写入。
+func (r *generationRunRepository) CreateBatch(runs []*models.GenerationRun) error {
+	if len(runs) == 0 {
+		return nil
+	}
+	rows := make([]string, 0, len(runs))
+	args := make([]interface{}, 0, len(runs)*11)
+	for _, run := range runs {
+		var userID interface{}
+		if run.UserID != nil {
+			userID = *run.UserID
+		}
+		variables := string(run.Variables)
+		if variables == "" {
+			variables = "{}"
+		}
+		rows = append(rows, "(?::uuid, ?::uuid, ?::integer, ?::uuid, ?::jsonb, ?::text, ?::boolean, ?::varchar, ?::text, ?::integer, ?::timestamptz)")
+		args = append(args, run.ID, run.TemplateID, run.TemplateVersion, userID, variables,
+			run.Output, run.Redacted, run.Status, run.Error, run.LatencyMs, run.CreatedAt)
+	}
+	return r.db.Exec(`INSERT INTO generation_runs
+			(id, template_id, template_version, user_id, variables, output, redacted, status, error, latency_ms, created_at)
+		SELECT v.id, v.template_id, v.template_version, u.id, v.variables, v.output, v.redacted, v.status, v.error, v.latency_ms, v.created_at
+		FROM (VALUES `+strings.Join(rows, ", ")+`)
+			AS v(id, template_id, template_version, user_id, variables, output, redacted, status, error, latency_ms, created_at)
+		JOIN prompt_templates t ON t.id = v.template_id
+		LEFT JOIN users u ON u.id = v.user_id
+		ON CONFLICT (id) DO NOTHING`, args...).Error
+}
+
+// GetByID 根据ID获取生成记录
+func (r *generationRunRepository) GetByID(id uuid.UUID) (*models.GenerationRun, error) {
+	var run models.GenerationRun
+	err := r.db.Where("id = ?", id).First(&run).Error
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListByTemplate 获取模板的生成记录
+func (r *generationRunRepository) ListByTemplate(templateID uuid.UUID, userID *uuid.UUID, limit, offset int) ([]models.GenerationRun, error) {
+	var runs []models.GenerationRun
+	query := r.db.Where("template_id = ?", templateID)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+	err := query.Order("created_at desc").Limit(limit).Offset(offset).Find(&runs).Error
+	return runs, err
+}
+
+// DeleteBefore 删除早于指定时间的生成记录，返回删除的条数
+func (r *generationRunRepository) DeleteBefore(t time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", t).Delete(&models.GenerationRun{})
+	return result.RowsAffected, result.Error
+}
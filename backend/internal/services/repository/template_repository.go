@@ -1,6 +1,10 @@
 package repository
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"prompt-backend/internal/models"
 
 	"github.com/google/uuid"
@@ -11,12 +15,22 @@ import (
 type TemplateRepository interface {
 	Create(template *models.PromptTemplate) error
 	GetByID(id uuid.UUID) (*models.PromptTemplate, error)
-	GetAll(category string, limit, offset int) ([]models.PromptTemplate, error)
-	GetByUserID(userID uuid.UUID, category string, limit, offset int) ([]models.PromptTemplate, error)
-	Update(template *models.PromptTemplate) error
+	GetBySlug(slug string) (*models.PromptTemplate, error)
+	GetAll(filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error)
+	GetVisible(viewerID uuid.UUID, filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error)
+	GetByUserID(userID uuid.UUID, filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error)
+	Update(template *models.PromptTemplate, editorID uuid.UUID) error
+	UpdateByOwner(template *models.PromptTemplate, ownerID uuid.UUID) error
 	Delete(id uuid.UUID) error
-	IncrementUsage(id uuid.UUID) error
-	GetPublicTemplates(category string, limit, offset int) ([]models.PromptTemplate, error)
+	DeleteByOwner(id, ownerID uuid.UUID) error
+	IncrementUsage(counts map[uuid.UUID]int) error
+	GetPublicTemplates(filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error)
+	// Search 全文检索模板并返回匹配总数，all 为 false 时只包含公开的或 viewerID 对应用户的模板
+	Search(q models.TemplateSearchQuery, viewerID *uuid.UUID, all bool, limit, offset int) ([]models.TemplateSearchResult, int64, error)
+	GetVersions(templateID uuid.UUID, limit, offset int) ([]models.PromptTemplateVersion, error)
+	GetVersion(templateID uuid.UUID, version int) (*models.PromptTemplateVersion, error)
+	// TagCounts 返回各标签的模板数，all 为 false 时只统计公开的或 viewerID 对应用户的模板
+	TagCounts(viewerID *uuid.UUID, all bool, limit int) ([]models.TagCount, error)
 }
 
 // templateRepository 模板仓库实现
@@ -29,9 +43,18 @@ func NewTemplateRepository(db *gorm.DB) TemplateRepository {
 	return &templateRepository{db: db}
 }
 
-// Create 创建模板
+// Create 创建模板和标签，并写入第一个版本快照
 func (r *templateRepository) Create(template *models.PromptTemplate) error {
-	return r.db.Create(template).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		template.Version = 1
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		if err := setTags(tx, template.ID, template.Tags); err != nil {
+			return err
+		}
+		return tx.Create(newVersionSnapshot(template, template.UserID)).Error
+	})
 }
 
 // GetByID 根据ID获取模板
@@ -41,34 +64,219 @@ func (r *templateRepository) GetByID(id uuid.UUID) (*models.PromptTemplate, erro
 	if err != nil {
 		return nil, err
 	}
-	return &template, nil
+	return &template, r.loadTags(&template)
+}
+
+// GetBySlug 根据别名获取模板
+func (r *templateRepository) GetBySlug(slug string) (*models.PromptTemplate, error) {
+	var template models.PromptTemplate
+	err := r.db.Where("slug = ?", slug).First(&template).Error
+	if err != nil {
+		return nil, err
+	}
+	return &template, r.loadTags(&template)
 }
 
 // GetAll 获取所有模板
-func (r *templateRepository) GetAll(category string, limit, offset int) ([]models.PromptTemplate, error) {
-	var templates []models.PromptTemplate
+func (r *templateRepository) GetAll(filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error) {
+	return r.findTemplates(r.db, filter, page)
+}
+
+// GetVisible 获取对指定用户可见的模板（公开模板及其本人的私有模板）。
+// viewerID 为 uuid.Nil 时只返回公开模板。
+func (r *templateRepository) GetVisible(viewerID uuid.UUID, filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error) {
 	query := r.db
-	if category != "" {
-		query = query.Where("category = ?", category)
+	if viewerID == uuid.Nil {
+		query = query.Where("is_public = ?", true)
+	} else {
+		query = query.Where("(is_public = ? OR user_id = ?)", true, viewerID)
 	}
-	err := query.Limit(limit).Offset(offset).Order("created_at desc").Find(&templates).Error
-	return templates, err
+	return r.findTemplates(query, filter, page)
 }
 
 // GetByUserID 获取用户模板
-func (r *templateRepository) GetByUserID(userID uuid.UUID, category string, limit, offset int) ([]models.PromptTemplate, error) {
-	var templates []models.PromptTemplate
-	query := r.db.Where("user_id = ?", userID)
-	if category != "" {
-		query = query.Where("category = ?", category)
+func (r *templateRepository) GetByUserID(userID uuid.UUID, filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error) {
+	return r.findTemplates(r.db.Where("user_id = ?", userID), filter, page)
+}
+
+// templateSortColumns 允许排序的列
+var templateSortColumns = map[string]string{
+	models.SortCreatedAt:  "created_at",
+	models.SortUpdatedAt:  "updated_at",
+	models.SortName:       "name",
+	models.SortUsageCount: "usage_count",
+}
+
+// findTemplates 按筛选条件分页查询模板并加载标签，同时统计满足条件的总数。
+// 结果按 page.Sort 和 id 排序；指定游标时使用 (排序列, id) 的 keyset 条件翻页，深分页不需要扫描并跳过前面的行。
+func (r *templateRepository) findTemplates(query *gorm.DB, filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error) {
+	// Session 之后的查询各自复制条件，统计和分页查询互不影响
+	query = applyTemplateFilter(query, filter, "").Session(&gorm.Session{})
+
+	result := &models.TemplatePage{}
+	if err := query.Model(&models.PromptTemplate{}).Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	sort := page.Sort
+	column, ok := templateSortColumns[sort.Field]
+	if !ok {
+		sort = models.DefaultTemplateSort
+		column = templateSortColumns[sort.Field]
+	}
+	direction, compare := "ASC", ">"
+	if sort.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	// 多取一条用于判断是否还有下一页
+	find := query.Order(fmt.Sprintf("%s %s, id %s", column, direction, direction)).Limit(page.Limit + 1)
+	if page.Cursor != nil {
+		find = find.Where(fmt.Sprintf("(%s, id) %s (?, ?)", column, compare), page.Cursor.Value, page.Cursor.ID)
+	} else {
+		find = find.Offset(page.Offset)
+	}
+	templates := make([]models.PromptTemplate, 0, page.Limit+1)
+	if err := find.Find(&templates).Error; err != nil {
+		return nil, err
+	}
+	if len(templates) > page.Limit {
+		templates = templates[:page.Limit]
+		result.NextCursor = models.NewTemplateCursor(sort, &templates[len(templates)-1]).Encode()
+	}
+	result.Templates = templates
+
+	ptrs := make([]*models.PromptTemplate, len(templates))
+	for i := range templates {
+		ptrs[i] = &templates[i]
+	}
+	return result, r.loadTags(ptrs...)
+}
+
+// applyTemplateFilter 添加分类和标签条件，alias 为 prompt_templates 在查询中的别名（可为空）
+func applyTemplateFilter(query *gorm.DB, filter models.TemplateFilter, alias string) *gorm.DB {
+	column := func(name string) string {
+		if alias == "" {
+			return name
+		}
+		return alias + "." + name
+	}
+	if filter.Category != "" {
+		query = query.Where(column("category")+" = ?", filter.Category)
+	}
+	if len(filter.Tags) > 0 {
+		tagged := `SELECT tt.template_id FROM template_tags tt JOIN tags g ON g.id = tt.tag_id WHERE g.name IN ?`
+		if filter.TagMatch == models.TagMatchAll {
+			query = query.Where(column("id")+" IN ("+tagged+" GROUP BY tt.template_id HAVING COUNT(*) = ?)", filter.Tags, len(filter.Tags))
+		} else {
+			query = query.Where(column("id")+" IN ("+tagged+")", filter.Tags)
+		}
+	}
+	return query
+}
+
+// loadTags 批量加载模板的标签（按名称排序），没有标签的模板为空列表
+func (r *templateRepository) loadTags(templates ...*models.PromptTemplate) error {
+	if len(templates) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(templates))
+	for i, t := range templates {
+		ids[i] = t.ID
+		t.Tags = []string{}
+	}
+	var rows []struct {
+		TemplateID uuid.UUID
+		Name       string
+	}
+	err := r.db.Raw(`SELECT tt.template_id, g.name FROM template_tags tt
+		JOIN tags g ON g.id = tt.tag_id
+		WHERE tt.template_id IN ?
+		ORDER BY g.name`, ids).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*models.PromptTemplate, len(templates))
+	for _, t := range templates {
+		byID[t.ID] = t
+	}
+	for _, row := range rows {
+		if t, ok := byID[row.TemplateID]; ok {
+			t.Tags = append(t.Tags, row.Name)
+		}
+	}
+	return nil
+}
+
+// setTags 将模板的标签替换为 tags，不存在的标签会被创建
+func setTags(tx *gorm.DB, templateID uuid.UUID, tags []string) error {
+	if err := tx.Exec("DELETE FROM template_tags WHERE template_id = ?", templateID).Error; err != nil {
+		return err
 	}
-	err := query.Limit(limit).Offset(offset).Order("created_at desc").Find(&templates).Error
-	return templates, err
+	if len(tags) == 0 {
+		return nil
+	}
+	rows := make([]string, len(tags))
+	args := make([]interface{}, 0, len(tags)*2)
+	for i, tag := range tags {
+		rows[i] = "(?, ?)"
+		args = append(args, uuid.New(), tag)
+	}
+	err := tx.Exec("INSERT INTO tags (id, name) VALUES "+strings.Join(rows, ", ")+" ON CONFLICT (name) DO NOTHING", args...).Error
+	if err != nil {
+		return err
+	}
+	return tx.Exec(`INSERT INTO template_tags (template_id, tag_id)
+		SELECT ?::uuid, id FROM tags WHERE name IN ?`, templateID, tags).Error
+}
+
+// Update 更新模板，版本号加一并写入新的版本快照
+func (r *templateRepository) Update(template *models.PromptTemplate, editorID uuid.UUID) error {
+	return r.updateWithVersion(template, editorID, "id = ?", template.ID)
 }
 
-// Update 更新模板
-func (r *templateRepository) Update(template *models.PromptTemplate) error {
-	return r.db.Save(template).Error
+// UpdateByOwner 仅当模板属于指定用户时更新，归属校验与写入在同一条语句中完成。
+// 模板不存在或不属于该用户时返回 gorm.ErrRecordNotFound。
+func (r *templateRepository) UpdateByOwner(template *models.PromptTemplate, ownerID uuid.UUID) error {
+	return r.updateWithVersion(template, ownerID, "id = ? AND user_id = ?", template.ID, ownerID)
+}
+
+// updateWithVersion 在同一事务中更新模板并写入版本快照
+func (r *templateRepository) updateWithVersion(template *models.PromptTemplate, editorID uuid.UUID, query string, args ...interface{}) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.PromptTemplate{}).Where(query, args...).Updates(map[string]interface{}{
+			"name":        template.Name,
+			"description": template.Description,
+			"content":     template.Content,
+			"variables":   template.Variables,
+			"kind":        template.Kind,
+			"messages":    template.Messages,
+			"category":    template.Category,
+			"is_public":   template.IsPublic,
+			"slug":        template.Slug,
+			"redact_runs": template.RedactRuns,
+			"updated_at":  template.UpdatedAt,
+			"version":     gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		// Tags 为 nil 时（未加载标签）保留原有标签
+		if template.Tags != nil {
+			if err := setTags(tx, template.ID, template.Tags); err != nil {
+				return err
+			}
+		}
+
+		// 被更新的行在事务结束前处于锁定状态，读到的版本号即本次写入的版本号
+		if err := tx.Model(&models.PromptTemplate{}).Select("version").Where("id = ?", template.ID).Row().Scan(&template.Version); err != nil {
+			return err
+		}
+		return tx.Create(newVersionSnapshot(template, editorID)).Error
+	})
 }
 
 // Delete 删除模板
@@ -76,18 +284,139 @@ func (r *templateRepository) Delete(id uuid.UUID) error {
 	return r.db.Delete(&models.PromptTemplate{}, "id = ?", id).Error
 }
 
-// IncrementUsage 增加使用次数
-func (r *templateRepository) IncrementUsage(id uuid.UUID) error {
-	return r.db.Model(&models.PromptTemplate{}).Where("id = ?", id).UpdateColumn("usage_count", gorm.Expr("usage_count + ?", 1)).Error
+// DeleteByOwner 仅当模板属于指定用户时删除。
+// 模板不存在或不属于该用户时返回 gorm.ErrRecordNotFound。
+func (r *templateRepository) DeleteByOwner(id, ownerID uuid.UUID) error {
+	result := r.db.Delete(&models.PromptTemplate{}, "id = ? AND user_id = ?", id, ownerID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// IncrementUsage 在一条 UPDATE 语句中累加多个模板的使用次数
+func (r *templateRepository) IncrementUsage(counts map[uuid.UUID]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	rows := make([]string, 0, len(counts))
+	args := make([]interface{}, 0, len(counts)*2)
+	for id, n := range counts {
+		rows = append(rows, "(?::uuid, ?::integer)")
+		args = append(args, id, n)
+	}
+	return r.db.Exec(`UPDATE prompt_templates AS t SET usage_count = t.usage_count + v.n
+		FROM (VALUES `+strings.Join(rows, ", ")+`) AS v(id, n)
+		WHERE t.id = v.id`, args...).Error
 }
 
 // GetPublicTemplates 获取公开模板
-func (r *templateRepository) GetPublicTemplates(category string, limit, offset int) ([]models.PromptTemplate, error) {
-	var templates []models.PromptTemplate
-	query := r.db.Where("is_public = ?", true)
-	if category != "" {
-		query = query.Where("category = ?", category)
-	}
-	err := query.Limit(limit).Offset(offset).Order("created_at desc").Find(&templates).Error
-	return templates, err
+func (r *templateRepository) GetPublicTemplates(filter models.TemplateFilter, page models.PageRequest) (*models.TemplatePage, error) {
+	return r.findTemplates(r.db.Where("is_public = ?", true), filter, page)
+}
+
+// TagCounts 统计各标签的模板数，按模板数倒序排列
+func (r *templateRepository) TagCounts(viewerID *uuid.UUID, all bool, limit int) ([]models.TagCount, error) {
+	query := r.db.Table("tags AS g").
+		Select("g.name, COUNT(*) AS count").
+		Joins("JOIN template_tags tt ON tt.tag_id = g.id").
+		Joins("JOIN prompt_templates t ON t.id = tt.template_id")
+	if !all {
+		if viewerID == nil {
+			query = query.Where("t.is_public = ?", true)
+		} else {
+			query = query.Where("(t.is_public = ? OR t.user_id = ?)", true, *viewerID)
+		}
+	}
+
+	counts := make([]models.TagCount, 0)
+	err := query.Group("g.name").Order("count DESC, g.name").Limit(limit).Scan(&counts).Error
+	return counts, err
+}
+
+// searchHeadlineOptions ts_headline 的参数，摘要最多取两个片段
+var searchHeadlineOptions = fmt.Sprintf(`StartSel=%s, StopSel=%s, MaxWords=40, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "`,
+	models.SearchHighlightStart, models.SearchHighlightStop)
+
+// Search 使用 search_vector 全文检索模板（见 internal/database/migrations/011_template_search.up.sql），
+// 每个检索词按短语匹配，多个检索词需全部命中，结果按相关度排序
+func (r *templateRepository) Search(q models.TemplateSearchQuery, viewerID *uuid.UUID, all bool, limit, offset int) ([]models.TemplateSearchResult, int64, error) {
+	terms := q.Terms()
+	phrases := make([]string, len(terms))
+	args := make([]interface{}, len(terms))
+	for i, term := range terms {
+		phrases[i] = "phraseto_tsquery('simple', template_search_text(?))"
+		args[i] = term
+	}
+
+	query := r.db.Table("prompt_templates AS t, (SELECT "+strings.Join(phrases, " && ")+" AS query) AS q", args...).
+		Where("t.search_vector @@ q.query")
+	if !all || q.PublicOnly {
+		if viewerID == nil || q.PublicOnly {
+			query = query.Where("t.is_public = ?", true)
+		} else {
+			query = query.Where("(t.is_public = ? OR t.user_id = ?)", true, *viewerID)
+		}
+	}
+	if q.Category != "" {
+		query = query.Where("t.category = ?", q.Category)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]models.TemplateSearchResult, 0)
+	err := query.Select(`t.*, ts_rank(t.search_vector, q.query) AS rank,
+			ts_headline('simple', template_search_text(concat_ws(' ', t.description, t.content)), q.query, ?) AS snippet`,
+		searchHeadlineOptions).
+		Order("rank DESC, t.created_at DESC").Limit(limit).Offset(offset).Scan(&results).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	ptrs := make([]*models.PromptTemplate, len(results))
+	for i := range results {
+		ptrs[i] = &results[i].PromptTemplate
+	}
+	return results, total, r.loadTags(ptrs...)
+}
+
+// GetVersions 获取模板的版本历史（按版本号倒序）
+func (r *templateRepository) GetVersions(templateID uuid.UUID, limit, offset int) ([]models.PromptTemplateVersion, error) {
+	var versions []models.PromptTemplateVersion
+	err := r.db.Where("template_id = ?", templateID).Limit(limit).Offset(offset).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+// GetVersion 获取模板的指定版本
+func (r *templateRepository) GetVersion(templateID uuid.UUID, version int) (*models.PromptTemplateVersion, error) {
+	var v models.PromptTemplateVersion
+	err := r.db.Where("template_id = ? AND version = ?", templateID, version).First(&v).Error
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// newVersionSnapshot 根据模板当前内容生成版本快照
+func newVersionSnapshot(template *models.PromptTemplate, createdBy uuid.UUID) *models.PromptTemplateVersion {
+	return &models.PromptTemplateVersion{
+		ID:          uuid.New(),
+		TemplateID:  template.ID,
+		Version:     template.Version,
+		Name:        template.Name,
+		Description: template.Description,
+		Content:     template.Content,
+		Variables:   template.Variables,
+		Kind:        template.Kind,
+		Messages:    template.Messages,
+		Category:    template.Category,
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+	}
 }
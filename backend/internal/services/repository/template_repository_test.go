@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB 返回只生成 SQL、不连接数据库的 gorm.DB，以及捕获到的查询语句（已填入参数）
+func dryRunDB(t *testing.T) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 sslmode=disable"}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries []string
+	err = db.Callback().Query().After("gorm:query").Register("test:capture", func(tx *gorm.DB) {
+		queries = append(queries, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, &queries
+}
+
+func TestFindTemplatesKeyset(t *testing.T) {
+	id := uuid.MustParse("00000000-0000-0000-0000-0000000000aa")
+
+	tests := []struct {
+		name  string
+		page  models.PageRequest
+		where string
+		order string
+	}{
+		{
+			// 排序值相同的行按 id 继续，(列, id) 的行比较不会跳过或重复并列的模板
+			name:  "ascending ties continue on id",
+			page:  models.PageRequest{Limit: 2, Sort: models.TemplateSort{Field: models.SortName}, Cursor: &models.TemplateCursor{Value: "same", ID: id}},
+			where: "WHERE (name, id) > ('same', '" + id.String() + "')",
+			order: "ORDER BY name ASC, id ASC LIMIT 3",
+		},
+		{
+			name:  "descending ties continue on id",
+			page:  models.PageRequest{Limit: 2, Sort: models.TemplateSort{Field: models.SortUsageCount, Desc: true}, Cursor: &models.TemplateCursor{Value: 7, ID: id}},
+			where: "WHERE (usage_count, id) < (7, '" + id.String() + "')",
+			order: "ORDER BY usage_count DESC, id DESC LIMIT 3",
+		},
+		{
+			name:  "offset without cursor",
+			page:  models.PageRequest{Limit: 10, Offset: 20, Sort: models.DefaultTemplateSort},
+			order: "ORDER BY created_at DESC, id DESC LIMIT 11 OFFSET 20",
+		},
+		{
+			name:  "unknown sort falls back to the default",
+			page:  models.PageRequest{Limit: 1, Sort: models.TemplateSort{Field: "password_hash"}},
+			order: "ORDER BY created_at DESC, id DESC LIMIT 2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRunDB(t)
+			r := &templateRepository{db: db}
+			if _, err := r.GetAll(models.TemplateFilter{}, tt.page); err != nil {
+				t.Fatalf("GetAll: %v", err)
+			}
+
+			var find string
+			for _, q := range *queries {
+				if strings.HasPrefix(q, `SELECT * FROM "prompt_templates"`) {
+					find = q
+				}
+			}
+			if find == "" {
+				t.Fatalf("no page query captured in %q", *queries)
+			}
+			if tt.where != "" && !strings.Contains(find, tt.where) {
+				t.Errorf("query %q does not contain %q", find, tt.where)
+			}
+			if tt.where == "" && strings.Contains(find, "WHERE") {
+				t.Errorf("query %q has a keyset condition without a cursor", find)
+			}
+			if !strings.HasSuffix(find, tt.order) {
+				t.Errorf("query %q does not end with %q", find, tt.order)
+			}
+		})
+	}
+}
+
+func TestTemplateTagFilter(t *testing.T) {
+	const tagged = `id IN (SELECT tt.template_id FROM template_tags tt JOIN tags g ON g.id = tt.tag_id WHERE g.name IN ('go','sql')`
+
+	tests := []struct {
+		name   string
+		filter models.TemplateFilter
+		want   string // 为空表示没有标签条件
+	}{
+		{"no tags", models.TemplateFilter{TagMatch: models.TagMatchAll}, ""},
+		{"any", models.TemplateFilter{Tags: []string{"go", "sql"}, TagMatch: models.TagMatchAny}, tagged + ")"},
+		// 模板必须带有全部标签：按模板分组后命中的标签数等于筛选的标签数
+		{"all", models.TemplateFilter{Tags: []string{"go", "sql"}, TagMatch: models.TagMatchAll}, tagged + " GROUP BY tt.template_id HAVING COUNT(*) = 2)"},
+		{"with category", models.TemplateFilter{Category: "coding", Tags: []string{"go", "sql"}}, `category = 'coding' AND ` + tagged + ")"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, queries := dryRunDB(t)
+			var rows []models.PromptTemplate
+			if err := applyTemplateFilter(db.Model(&models.PromptTemplate{}), tt.filter, "").Find(&rows).Error; err != nil {
+				t.Fatal(err)
+			}
+			if len(*queries) != 1 {
+				t.Fatalf("captured %q, want one query", *queries)
+			}
+			query := (*queries)[0]
+			if tt.want == "" {
+				if strings.Contains(query, "template_tags") {
+					t.Errorf("query %q filters on tags", query)
+				}
+				return
+			}
+			if !strings.Contains(query, tt.want) {
+				t.Errorf("query %q does not contain %q", query, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UsageStatsRepository 使用统计仓库接口
+type UsageStatsRepository interface {
+	// RecordBatch 在同一事务中累加合并后的小时计数、调用方和变量取值，失败时整批不生效
+	RecordBatch(batch *models.UsageStatsBatch) error
+	// DeleteValuesBefore 删除整天早于 t 的变量取值统计，返回删除的行数
+	DeleteValuesBefore(t time.Time) (int64, error)
+	// Buckets 按粒度汇总模板的计数和独立调用方，只返回有数据的时间段
+	Buckets(templateID uuid.UUID, q models.StatsQuery) ([]models.UsageBucket, error)
+	Totals(templateID uuid.UUID, from, to time.Time) (models.UsageCounts, error)
+	// TopValues 返回每个变量最常用的 perVariable 个取值
+	TopValues(templateID uuid.UUID, from, to time.Time, perVariable int) ([]models.VariableValueUsage, error)
+	// TopTemplates 返回生成次数最多的模板，viewerID 不为空时只包含公开的或该用户的模板
+	TopTemplates(viewerID *uuid.UUID, all bool, from, to time.Time, limit int) ([]models.TemplateUsage, error)
+}
+
+// usageStatsRepository 使用统计仓库实现
+type usageStatsRepository struct {
+	db *gorm.DB
+}
+
+// NewUsageStatsRepository 创建使用统计仓库
+func NewUsageStatsRepository(db *gorm.DB) UsageStatsRepository {
+	return &usageStatsRepository{db: db}
+}
+
+// usageStatsChunkSize 每条 INSERT 语句最多包含的行数
+const usageStatsChunkSize = 1000
+
+// RecordBatch 记录合并后的使用统计，计数通过 upsert 累加，并发写入不会丢失。
+// 批次中每个主键只出现一次，每张表按分块各执行一条多行 upsert；已删除模板的统计被跳过。
+func (r *usageStatsRepository) RecordBatch(batch *models.UsageStatsBatch) error {
+	if batch == nil || batch.Empty() {
+		return nil
+	}
+
+	hourly := make([]string, 0, len(batch.Hourly))
+	hourlyArgs := make([]interface{}, 0, len(batch.Hourly)*4)
+	for key, counts := range batch.Hourly {
+		hourly = append(hourly, "(?::uuid, ?::timestamptz, ?::integer, ?::integer)")
+		hourlyArgs = append(hourlyArgs, key.TemplateID, key.Bucket, counts.Generations, counts.Errors)
+	}
+	callers := make([]string, 0, len(batch.Callers))
+	callerArgs := make([]interface{}, 0, len(batch.Callers)*3)
+	for key := range batch.Callers {
+		callers = append(callers, "(?::uuid, ?::timestamptz, ?::uuid)")
+		callerArgs = append(callerArgs, key.TemplateID, key.Bucket, key.UserID)
+	}
+	values := make([]string, 0, len(batch.Values))
+	valueArgs := make([]interface{}, 0, len(batch.Values)*5)
+	for key, uses := range batch.Values {
+		values = append(values, "(?::uuid, ?::timestamptz, ?::varchar, ?::varchar, ?::integer)")
+		valueArgs = append(valueArgs, key.TemplateID, key.Bucket, key.Variable, key.Value, uses)
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := execChunks(tx, hourly, hourlyArgs, `INSERT INTO template_usage_hourly (template_id, bucket, generations, errors)
+			SELECT v.template_id, v.bucket, v.generations, v.errors
+			FROM (VALUES %s) AS v(template_id, bucket, generations, errors)
+			JOIN prompt_templates t ON t.id = v.template_id
+			ON CONFLICT (template_id, bucket) DO UPDATE SET
+				generations = template_usage_hourly.generations + EXCLUDED.generations,
+				errors = template_usage_hourly.errors + EXCLUDED.errors`)
+		if err != nil {
+			return err
+		}
+		err = execChunks(tx, callers, callerArgs, `INSERT INTO template_usage_callers (template_id, bucket, user_id)
+			SELECT v.template_id, v.bucket, v.user_id
+			FROM (VALUES %s) AS v(template_id, bucket, user_id)
+			JOIN prompt_templates t ON t.id = v.template_id
+			ON CONFLICT DO NOTHING`)
+		if err != nil {
+			return err
+		}
+		return execChunks(tx, values, valueArgs, `INSERT INTO template_variable_values (template_id, bucket, variable, value, uses)
+			SELECT v.template_id, v.bucket, v.variable, v.value, v.uses
+			FROM (VALUES %s) AS v(template_id, bucket, variable, value, uses)
+			JOIN prompt_templates t ON t.id = v.template_id
+			ON CONFLICT (template_id, bucket, variable, value) DO UPDATE SET
+				uses = template_variable_values.uses + EXCLUDED.uses`)
+	})
+}
+
+// execChunks 将 rows 按 usageStatsChunkSize 分块填入 query 的 VALUES 列表（%s）并执行，args 与 rows 按顺序一一对应
+func execChunks(tx *gorm.DB, rows []string, args []interface{}, query string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	perRow := len(args) / len(rows)
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > usageStatsChunkSize {
+			n = usageStatsChunkSize
+		}
+		if err := tx.Exec(fmt.Sprintf(query, strings.Join(rows[:n], ", ")), args[:n*perRow]...).Error; err != nil {
+			return err
+		}
+		rows, args = rows[n:], args[n*perRow:]
+	}
+	return nil
+}
+
+// DeleteValuesBefore 删除变量取值统计中已整天过期的部分（按天分桶，只删除在 t 之前结束的天）
+func (r *usageStatsRepository) DeleteValuesBefore(t time.Time) (int64, error) {
+	result := r.db.Exec(`DELETE FROM template_variable_values WHERE bucket < ?`, t.UTC().Truncate(24*time.Hour))
+	return result.RowsAffected, result.Error
+}
+
+// Buckets 汇总各时间段的计数（按 UTC 划分）
+func (r *usageStatsRepository) Buckets(templateID uuid.UUID, q models.StatsQuery) ([]models.UsageBucket, error) {
+	var counts []struct {
+		Start       time.Time
+		Generations int64
+		Errors      int64
+	}
+	err := r.db.Raw(`SELECT date_trunc(?, bucket AT TIME ZONE 'UTC') AS start,
+			SUM(generations) AS generations, SUM(errors) AS errors
+		FROM template_usage_hourly
+		WHERE template_id = ? AND bucket >= ? AND bucket < ?
+		GROUP BY 1 ORDER BY 1`, q.Interval, templateID, q.From, q.To).Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var callers []struct {
+		Start         time.Time
+		UniqueCallers int64
+	}
+	err = r.db.Raw(`SELECT date_trunc(?, bucket AT TIME ZONE 'UTC') AS start, COUNT(DISTINCT user_id) AS unique_callers
+		FROM template_usage_callers
+		WHERE template_id = ? AND bucket >= ? AND bucket < ?
+		GROUP BY 1`, q.Interval, templateID, q.From, q.To).Scan(&callers).Error
+	if err != nil {
+		return nil, err
+	}
+	callersByStart := make(map[time.Time]int64, len(callers))
+	for _, c := range callers {
+		callersByStart[c.Start.UTC()] = c.UniqueCallers
+	}
+
+	buckets := make([]models.UsageBucket, len(counts))
+	for i, c := range counts {
+		start := c.Start.UTC()
+		buckets[i] = models.UsageBucket{
+			Start: start,
+			UsageCounts: models.UsageCounts{
+				Generations:   c.Generations,
+				Errors:        c.Errors,
+				UniqueCallers: callersByStart[start],
+			},
+		}
+	}
+	return buckets, nil
+}
+
+// Totals 汇总时间范围内的计数和独立调用方
+func (r *usageStatsRepository) Totals(templateID uuid.UUID, from, to time.Time) (models.UsageCounts, error) {
+	var counts models.UsageCounts
+	err := r.db.Raw(`SELECT COALESCE(SUM(generations), 0) AS generations, COALESCE(SUM(errors), 0) AS errors
+		FROM template_usage_hourly
+		WHERE template_id = ? AND bucket >= ? AND bucket < ?`, templateID, from, to).Scan(&counts).Error
+	if err != nil {
+		return counts, err
+	}
+	err = r.db.Raw(`SELECT COUNT(DISTINCT user_id) FROM template_usage_callers
+		WHERE template_id = ? AND bucket >= ? AND bucket < ?`, templateID, from, to).Scan(&counts.UniqueCallers).Error
+	return counts, err
+}
+
+// TopValues 按使用次数返回每个变量最常用的取值
+func (r *usageStatsRepository) TopValues(templateID uuid.UUID, from, to time.Time, perVariable int) ([]models.VariableValueUsage, error) {
+	values := make([]models.VariableValueUsage, 0)
+	err := r.db.Raw(`SELECT variable, value, uses FROM (
+			SELECT variable, value, SUM(uses) AS uses,
+				ROW_NUMBER() OVER (PARTITION BY variable ORDER BY SUM(uses) DESC, value) AS rn
+			FROM template_variable_values
+			WHERE template_id = ? AND bucket >= ? AND bucket < ?
+			GROUP BY variable, value
+		) ranked
+		WHERE rn <= ?
+		ORDER BY variable, uses DESC, value`, templateID, from.UTC().Truncate(24*time.Hour), to, perVariable).Scan(&values).Error
+	return values, err
+}
+
+// TopTemplates 返回时间范围内生成次数最多的模板
+func (r *usageStatsRepository) TopTemplates(viewerID *uuid.UUID, all bool, from, to time.Time, limit int) ([]models.TemplateUsage, error) {
+	query := r.db.Table("template_usage_hourly AS h").
+		Select("h.template_id, t.name, SUM(h.generations) AS generations, SUM(h.errors) AS errors").
+		Joins("JOIN prompt_templates t ON t.id = h.template_id").
+		Where("h.bucket >= ? AND h.bucket < ?", from, to)
+	if !all {
+		if viewerID == nil {
+			query = query.Where("t.is_public = ?", true)
+		} else {
+			query = query.Where("(t.is_public = ? OR t.user_id = ?)", true, *viewerID)
+		}
+	}
+
+	usage := make([]models.TemplateUsage, 0)
+	err := query.Group("h.template_id, t.name").Order("generations DESC").Limit(limit).Scan(&usage).Error
+	if err != nil || len(usage) == 0 {
+		return usage, err
+	}
+
+	ids := make([]uuid.UUID, len(usage))
+	for i, u := range usage {
+		ids[i] = u.TemplateID
+	}
+	var callers []struct {
+		TemplateID    uuid.UUID
+		UniqueCallers int64
+	}
+	err = r.db.Raw(`SELECT template_id, COUNT(DISTINCT user_id) AS unique_callers FROM template_usage_callers
+		WHERE template_id IN ? AND bucket >= ? AND bucket < ?
+		GROUP BY template_id`, ids, from, to).Scan(&callers).Error
+	if err != nil {
+		return nil, err
+	}
+	callersByTemplate := make(map[uuid.UUID]int64, len(callers))
+	for _, c := range callers {
+		callersByTemplate[c.TemplateID] = c.UniqueCallers
+	}
+	for i := range usage {
+		usage[i].UniqueCallers = callersByTemplate[usage[i].TemplateID]
+	}
+	return usage, nil
+}
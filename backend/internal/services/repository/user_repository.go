@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserRepository 用户仓库接口
+type UserRepository interface {
+	Create(user *models.User) error
+	GetByID(id uuid.UUID) (*models.User, error)
+	GetByEmail(email string) (*models.User, error)
+}
+
+// userRepository 用户仓库实现
+type userRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository 创建用户仓库
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+// Create 创建用户
+func (r *userRepository) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+// GetByID 根据ID获取用户
+func (r *userRepository) GetByID(id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("id = ?", id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetByEmail 根据邮箱获取用户
+func (r *userRepository) GetByEmail(email string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("email = ?", email).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
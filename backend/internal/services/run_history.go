@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services/repository"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultRunRetention 生成记录的默认保留时长
+	defaultRunRetention = 30 * 24 * time.Hour
+	// runPruneInterval 清理过期生成记录的间隔
+	runPruneInterval = time.Hour
+	// runFlushBatchSize 每条 INSERT 语句最多包含的生成记录数
+	runFlushBatchSize = 200
+	// maxPendingRuns 内存中最多保留的待写入生成记录数，超出后丢弃新的记录（数据库长时间不可用时限制内存）
+	maxPendingRuns = 10000
+)
+
+var ErrRunNotFound = errors.New("generation run not found")
+
+// RunRetentionFromEnv 从 RUN_RETENTION 读取生成记录的保留时长（如 720h），0 表示永久保留
+func RunRetentionFromEnv() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("RUN_RETENTION"))
+	if value == "" {
+		return defaultRunRetention, nil
+	}
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention < 0 {
+		return 0, fmt.Errorf("invalid RUN_RETENTION: %q", value)
+	}
+	return retention, nil
+}
+
+// RunQueueMetrics 生成记录写入队列的运行指标
+type RunQueueMetrics struct {
+	Pending int   `json:"pending"`
+	Flushed int64 `json:"flushed"`
+	Dropped int64 `json:"dropped"`
+}
+
+// runQueue 生成记录的写入队列，注册到 UsageRecorder 后随其刷新批量插入，不在请求中同步写库。
+// 写入失败的记录放回队列等待下一次刷新；被数据库拒绝的记录丢弃，不阻塞后面的记录。
+type runQueue struct {
+	repo     repository.GenerationRunRepository
+	recorder *UsageRecorder
+
+	mu      sync.Mutex
+	pending []*models.GenerationRun
+	flushed int64
+	dropped int64
+}
+
+// newRunQueue 创建生成记录队列并注册到 recorder
+func newRunQueue(repo repository.GenerationRunRepository, recorder *UsageRecorder) *runQueue {
+	q := &runQueue{repo: repo, recorder: recorder}
+	recorder.register("runs", q)
+	return q
+}
+
+// add 将生成记录加入队列，返回是否接受。队列已满时丢弃记录并计入 Dropped。
+func (q *runQueue) add(run *models.GenerationRun) bool {
+	q.mu.Lock()
+	if len(q.pending) >= maxPendingRuns {
+		q.dropped++
+		q.mu.Unlock()
+		return false
+	}
+	q.pending = append(q.pending, run)
+	full := len(q.pending)%runFlushBatchSize == 0
+	q.mu.Unlock()
+
+	if full {
+		q.recorder.triggerFlush()
+	}
+	return true
+}
+
+func (q *runQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending) == 0
+}
+
+// flush 分批插入队列中的记录，失败时未写入的记录放在新记录之前，超出队列上限的部分丢弃。
+// 分批因数据错误失败时逐条重试，丢弃被拒绝的记录，避免同一批记录反复失败使后面的记录无法写入。
+func (q *runQueue) flush() error {
+	q.mu.Lock()
+	runs := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	var flushed, dropped int64
+	var err error
+	for len(runs) > 0 && err == nil {
+		n := len(runs)
+		if n > runFlushBatchSize {
+			n = runFlushBatchSize
+		}
+		err = q.repo.CreateBatch(runs[:n])
+		switch {
+		case err == nil:
+			flushed += int64(n)
+			runs = runs[n:]
+		case repository.IsDataError(err):
+			var written, rejected int
+			written, rejected, err = q.flushEach(runs[:n])
+			flushed += int64(written)
+			dropped += int64(rejected)
+			runs = runs[written+rejected:]
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.flushed += flushed
+	q.dropped += dropped
+	if err != nil {
+		requeued := make([]*models.GenerationRun, 0, len(runs)+len(q.pending))
+		requeued = append(append(requeued, runs...), q.pending...)
+		if len(requeued) > maxPendingRuns {
+			q.dropped += int64(len(requeued) - maxPendingRuns)
+			requeued = requeued[:maxPendingRuns]
+		}
+		q.pending = requeued
+	}
+	return err
+}
+
+// flushEach 逐条插入记录，丢弃因数据错误无法写入的记录。遇到其他错误时停止，
+// 返回已写入和已丢弃的条数，剩余的记录由调用方放回队列。
+func (q *runQueue) flushEach(runs []*models.GenerationRun) (written, rejected int, err error) {
+	for _, run := range runs {
+		if err := q.repo.CreateBatch([]*models.GenerationRun{run}); err != nil {
+			if !repository.IsDataError(err) {
+				return written, rejected, err
+			}
+			log.Printf("dropping generation run %s rejected by the database: %v", run.ID, err)
+			rejected++
+			continue
+		}
+		written++
+	}
+	return written, rejected, nil
+}
+
+func (q *runQueue) metrics() interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return RunQueueMetrics{Pending: len(q.pending), Flushed: q.flushed, Dropped: q.dropped}
+}
+
+// recordRun 生成一条生成记录并交给写入队列异步保存，返回记录 ID。
+// 记录在下一次刷新（默认 5 秒内）后才能查询到；队列已满或未配置时不保存，返回 nil，不影响生成结果。
+func (s *TemplateService) recordRun(p *preparedTemplate, variables map[string]string, caller *auth.Identity, resp *models.GenerateResponse, renderErr error, latency time.Duration) *uuid.UUID {
+	if s.runQueue == nil {
+		return nil
+	}
+	run, err := newGenerationRun(p, variables, caller, resp, renderErr, latency)
+	if err != nil {
+		log.Printf("failed to record generation run: %v", err)
+		return nil
+	}
+	if !s.runQueue.add(run) {
+		return nil
+	}
+	return &run.ID
+}
+
+// newGenerationRun 构造生成记录。模板开启 redact_runs 时变量值替换为占位符且不保存输出。
+func newGenerationRun(p *preparedTemplate, variables map[string]string, caller *auth.Identity, resp *models.GenerateResponse, renderErr error, latency time.Duration) (*models.GenerationRun, error) {
+	run := &models.GenerationRun{
+		ID:              uuid.New(),
+		TemplateID:      p.source.TemplateID,
+		TemplateVersion: p.source.Version,
+		UserID:          callerID(caller),
+		Redacted:        p.redactRuns,
+		Status:          models.RunStatusSuccess,
+		LatencyMs:       latency.Milliseconds(),
+		CreatedAt:       time.Now(),
+	}
+
+	data, err := json.Marshal(p.redactVariables(variables))
+	if err != nil {
+		return nil, err
+	}
+	run.Variables = data
+
+	if renderErr != nil {
+		run.Status = models.RunStatusError
+		run.Error = renderErr.Error()
+	} else if !p.redactRuns {
+		run.Output = resp.Prompt
+	}
+	return run, nil
+}
+
+// redactVariables 返回要保存的变量值，模板开启 redact_runs 时每个值替换为 models.RedactedValue
+func (p *preparedTemplate) redactVariables(variables map[string]string) map[string]string {
+	recorded := make(map[string]string, len(variables))
+	for name, value := range variables {
+		if p.redactRuns {
+			value = models.RedactedValue
+		}
+		recorded[name] = value
+	}
+	return recorded
+}
+
+// GetTemplateRuns 获取模板的生成记录。模板所有者和管理员可以查看全部记录，其他用户只能查看自己的调用。
+func (s *TemplateService) GetTemplateRuns(id uuid.UUID, page, pageSize int, viewer *auth.Identity) ([]models.GenerationRun, error) {
+	tmpl, err := s.GetTemplate(id, viewer)
+	if err != nil {
+		return nil, err
+	}
+	if viewer == nil {
+		return nil, ErrForbidden
+	}
+
+	var userID *uuid.UUID
+	if !canModify(tmpl, viewer) {
+		userID = &viewer.UserID
+	}
+	limit := pageSize
+	offset := (page - 1) * pageSize
+	return s.runs.ListByTemplate(id, userID, limit, offset)
+}
+
+// GetRun 获取单条生成记录，仅调用方本人、模板所有者和管理员可见
+func (s *TemplateService) GetRun(id uuid.UUID, viewer *auth.Identity) (*models.GenerationRun, error) {
+	if viewer == nil {
+		return nil, ErrRunNotFound
+	}
+	run, err := s.runs.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRunNotFound
+		}
+		return nil, err
+	}
+	if run.UserID != nil && *run.UserID == viewer.UserID {
+		return run, nil
+	}
+
+	tmpl, err := s.getTemplate(run.TemplateID)
+	if err != nil {
+		if errors.Is(err, ErrTemplateNotFound) {
+			return nil, ErrRunNotFound
+		}
+		return nil, err
+	}
+	// 无权查看时与不存在的记录返回相同的错误，避免泄露记录 ID
+	if !canModify(tmpl, viewer) {
+		return nil, ErrRunNotFound
+	}
+	return run, nil
+}
+
+// PruneRuns 删除超出保留时长的生成记录
+func (s *TemplateService) PruneRuns(retention time.Duration) (int64, error) {
+	return s.runs.DeleteBefore(time.Now().Add(-retention))
+}
+
+// PruneVariableValues 删除超出保留时长的变量取值统计（其中含调用方传入的原始值，与生成记录使用相同的保留时长）
+func (s *TemplateService) PruneVariableValues(retention time.Duration) (int64, error) {
+	return s.stats.DeleteValuesBefore(time.Now().Add(-retention))
+}
+
+// StartRunRetention 在后台定期清理过期的生成记录和变量取值统计，直到 ctx 结束；retention 为 0 时不清理
+func (s *TemplateService) StartRunRetention(ctx context.Context, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(runPruneInterval)
+		defer ticker.Stop()
+		for {
+			if deleted, err := s.PruneRuns(retention); err != nil {
+				log.Printf("failed to prune generation runs: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Pruned %d generation runs older than %s", deleted, retention)
+			}
+			if deleted, err := s.PruneVariableValues(retention); err != nil {
+				log.Printf("failed to prune variable value stats: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Pruned %d variable value stats older than %s", deleted, retention)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestNewGenerationRunRedaction(t *testing.T) {
+	variables := map[string]string{"name": "Alice", "ssn": "123-45-6789"}
+	resp := &models.GenerateResponse{Prompt: "Hello Alice"}
+	caller := &auth.Identity{UserID: uuid.New()}
+	renderErr := errors.New("variable name is required")
+
+	tests := []struct {
+		name       string
+		redact     bool
+		renderErr  error
+		wantOutput string
+		wantStatus string
+	}{
+		{"plain success", false, nil, "Hello Alice", models.RunStatusSuccess},
+		{"redacted success", true, nil, "", models.RunStatusSuccess},
+		{"plain error", false, renderErr, "", models.RunStatusError},
+		{"redacted error", true, renderErr, "", models.RunStatusError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &preparedTemplate{
+				source:     &models.PromptTemplateVersion{TemplateID: uuid.New(), Version: 3},
+				redactRuns: tt.redact,
+			}
+			run, err := newGenerationRun(p, variables, caller, resp, tt.renderErr, 5*time.Millisecond)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var recorded map[string]string
+			if err := json.Unmarshal(run.Variables, &recorded); err != nil {
+				t.Fatal(err)
+			}
+			if len(recorded) != len(variables) {
+				t.Fatalf("recorded %v, want every variable name kept", recorded)
+			}
+			for name, value := range variables {
+				want := value
+				if tt.redact {
+					want = models.RedactedValue
+				}
+				if recorded[name] != want {
+					t.Errorf("%s = %q, want %q", name, recorded[name], want)
+				}
+			}
+			if run.Output != tt.wantOutput || run.Status != tt.wantStatus || run.Redacted != tt.redact {
+				t.Errorf("output=%q status=%s redacted=%v", run.Output, run.Status, run.Redacted)
+			}
+			if run.TemplateVersion != 3 || run.UserID == nil || *run.UserID != caller.UserID || run.LatencyMs != 5 {
+				t.Errorf("unexpected metadata: %+v", run)
+			}
+		})
+	}
+}
+
+func TestRunQueueRequeuesFailedFlush(t *testing.T) {
+	runs := &fakeRunStore{failures: failures{failOn: map[int]bool{1: true}}}
+	r := NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval)
+	q := newRunQueue(runs, r)
+
+	q.add(&models.GenerationRun{ID: uuid.New()})
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the injected error")
+	}
+	if m := q.metrics().(RunQueueMetrics); m.Pending != 1 || m.Flushed != 0 {
+		t.Fatalf("after failed flush: %+v", m)
+	}
+	if m := r.Metrics(); m.FailedFlushes != 1 || m.Buffers["runs"] != (RunQueueMetrics{Pending: 1}) {
+		t.Fatalf("recorder metrics: %+v", m)
+	}
+
+	// 失败的记录排在新记录之前，Close 时一并写入
+	second := &models.GenerationRun{ID: uuid.New()}
+	q.add(second)
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(runs.runs) != 2 || runs.runs[1] != second {
+		t.Errorf("runs written = %+v, want both in order", runs.runs)
+	}
+	if m := q.metrics().(RunQueueMetrics); m.Pending != 0 || m.Flushed != 2 || m.Dropped != 0 {
+		t.Errorf("after Close: %+v", m)
+	}
+}
+
+func TestRunQueueDropsRejectedRuns(t *testing.T) {
+	bad := &models.GenerationRun{ID: uuid.New()}
+	runs := &fakeRunStore{reject: map[uuid.UUID]bool{bad.ID: true}}
+	r := NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval)
+	q := newRunQueue(runs, r)
+
+	// 被数据库拒绝的记录每次都会使整批写入失败，不能一直放回队列阻塞后面的记录
+	first, last := &models.GenerationRun{ID: uuid.New()}, &models.GenerationRun{ID: uuid.New()}
+	q.add(first)
+	q.add(bad)
+	q.add(last)
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(runs.runs) != 2 || runs.runs[0] != first || runs.runs[1] != last {
+		t.Fatalf("runs written = %+v, want every run except the rejected one", runs.runs)
+	}
+	if m := q.metrics().(RunQueueMetrics); m.Pending != 0 || m.Flushed != 2 || m.Dropped != 1 {
+		t.Fatalf("after flush: %+v", m)
+	}
+
+	later := &models.GenerationRun{ID: uuid.New()}
+	q.add(later)
+	if err := r.Flush(); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if len(runs.runs) != 3 || runs.runs[2] != later {
+		t.Errorf("runs written = %+v, want the later run flushed", runs.runs)
+	}
+}
+
+func TestRunQueueRetriesRowsAfterConnectionError(t *testing.T) {
+	// 第 1 次整批写入数据错误，逐条重试时第 2 条（第 3 次调用）遇到连接错误：剩余记录放回队列
+	bad := &models.GenerationRun{ID: uuid.New()}
+	runs := &fakeRunStore{reject: map[uuid.UUID]bool{bad.ID: true}, failures: failures{failOn: map[int]bool{3: true}}}
+	r := NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval)
+	q := newRunQueue(runs, r)
+
+	first, last := &models.GenerationRun{ID: uuid.New()}, &models.GenerationRun{ID: uuid.New()}
+	q.add(first)
+	q.add(bad)
+	q.add(last)
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the connection error")
+	}
+	if m := q.metrics().(RunQueueMetrics); m.Pending != 2 || m.Flushed != 1 || m.Dropped != 0 {
+		t.Fatalf("after failed flush: %+v", m)
+	}
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if len(runs.runs) != 2 || runs.runs[1] != last {
+		t.Errorf("runs written = %+v, want first and last", runs.runs)
+	}
+	if m := q.metrics().(RunQueueMetrics); m.Pending != 0 || m.Flushed != 2 || m.Dropped != 1 {
+		t.Errorf("after retry: %+v", m)
+	}
+}
+
+func TestRunQueueDropsRunsWhenFull(t *testing.T) {
+	q := newRunQueue(&fakeRunStore{}, NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval))
+	for i := 0; i < maxPendingRuns; i++ {
+		if !q.add(&models.GenerationRun{ID: uuid.New()}) {
+			t.Fatalf("run %d rejected before the queue is full", i)
+		}
+	}
+	if q.add(&models.GenerationRun{ID: uuid.New()}) {
+		t.Fatal("run accepted beyond maxPendingRuns")
+	}
+	if m := q.metrics().(RunQueueMetrics); m.Pending != maxPendingRuns || m.Dropped != 1 {
+		t.Errorf("pending=%d dropped=%d", m.Pending, m.Dropped)
+	}
+}
+
+func TestRecordRunWithoutRunStore(t *testing.T) {
+	// 未配置生成记录仓库时不保存记录，也不返回记录 ID
+	s := NewTemplateService(&fakeTemplateRepo{}, nil, nil, NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval))
+	p := &preparedTemplate{source: &models.PromptTemplateVersion{TemplateID: uuid.New(), Version: 1}}
+	if id := s.recordRun(p, nil, nil, &models.GenerateResponse{}, nil, 0); id != nil {
+		t.Errorf("recordRun returned %v, want nil", id)
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/llm"
+	"prompt-backend/internal/models"
+)
+
+var (
+	// ErrProviderFailed 调用模型服务失败
+	ErrProviderFailed = errors.New("llm request failed")
+	// ErrModelNotAllowed 请求指定的模型不在允许列表中
+	ErrModelNotAllowed = errors.New("model is not allowed")
+)
+
+// RunService 渲染模板并将结果发送给模型
+type RunService struct {
+	templates     *TemplateService
+	provider      llm.Provider
+	allowedModels map[string]bool
+}
+
+// NewRunService 创建运行服务，provider 为 nil 时运行请求返回 llm.ErrNotConfigured。
+// 请求中的 model 必须在 allowedModels 中，未指定时使用提供方的默认模型。
+func NewRunService(templates *TemplateService, provider llm.Provider, allowedModels []string) *RunService {
+	allowed := make(map[string]bool, len(allowedModels))
+	for _, model := range allowedModels {
+		allowed[model] = true
+	}
+	return &RunService{templates: templates, provider: provider, allowedModels: allowed}
+}
+
+// checkModel 校验请求指定的模型，在渲染模板之前调用，被拒绝的请求不计入使用次数
+func (s *RunService) checkModel(model string) error {
+	if model != "" && !s.allowedModels[model] {
+		return fmt.Errorf("%w: %s", ErrModelNotAllowed, model)
+	}
+	return nil
+}
+
+// Run 渲染模板后调用模型。文本模板作为一条 user 消息发送，对话模板发送渲染后的消息列表。
+// 模板和变量错误与 GeneratePrompt 相同；模型不在允许列表中时返回 ErrModelNotAllowed，
+// 模型调用失败时返回包装了 ErrProviderFailed 的错误。
+func (s *RunService) Run(ctx context.Context, req models.RunRequest, viewer *auth.Identity) (*models.RunResponse, error) {
+	if s.provider == nil {
+		return nil, llm.ErrNotConfigured
+	}
+	if err := s.checkModel(req.Model); err != nil {
+		return nil, err
+	}
+
+	rendered, err := s.templates.GeneratePrompt(req.GenerateRequest, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	completion, err := s.provider.Complete(ctx, completionRequest(req, rendered))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrProviderFailed, err)
+	}
+
+	resp := &models.RunResponse{
+		GenerateResponse: *rendered,
+		Model:            completion.Model,
+		FinishReason:     completion.FinishReason,
+		Usage:            completion.Usage,
+		LatencyMs:        time.Since(start).Milliseconds(),
+	}
+	resp.Result = completion.Content
+	return resp, nil
+}
+
+// completionRequest 将渲染结果转换为模型请求
+func completionRequest(req models.RunRequest, rendered *models.GenerateResponse) llm.Request {
+	messages := []models.ChatMessage(rendered.Messages)
+	if len(messages) == 0 {
+		messages = []models.ChatMessage{{Role: models.ChatRoleUser, Content: rendered.Prompt}}
+	}
+	return llm.Request{
+		Model:       req.Model,
+		Messages:    messages,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+	}
+}
+
+// RunStream 流式运行的结果：Deltas 依次输出模型的增量内容，关闭后通过 Result 获取汇总结果
+type RunStream struct {
+	// Rendered 发送给模型的内容
+	Rendered *models.GenerateResponse
+	Deltas   <-chan string
+
+	done chan struct{}
+	resp *models.RunResponse
+	err  error
+}
+
+// Result 等待流结束并返回包含完整输出和用量的结果
+func (r *RunStream) Result() (*models.RunResponse, error) {
+	<-r.done
+	return r.resp, r.err
+}
+
+// Stream 渲染模板后以流式方式调用模型。模板和变量错误在返回前同步报告；
+// 模型调用在后台进行，ctx 取消（如客户端断开）时中止上游请求。
+func (s *RunService) Stream(ctx context.Context, req models.RunRequest, viewer *auth.Identity) (*RunStream, error) {
+	if s.provider == nil {
+		return nil, llm.ErrNotConfigured
+	}
+	if err := s.checkModel(req.Model); err != nil {
+		return nil, err
+	}
+
+	rendered, err := s.templates.GeneratePrompt(req.GenerateRequest, viewer)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := make(chan string)
+	stream := &RunStream{Rendered: rendered, Deltas: deltas, done: make(chan struct{})}
+	go func() {
+		defer close(stream.done)
+		defer close(deltas)
+
+		start := time.Now()
+		completion, err := s.provider.Stream(ctx, completionRequest(req, rendered), func(delta string) error {
+			select {
+			case deltas <- delta:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			stream.err = fmt.Errorf("%w: %w", ErrProviderFailed, err)
+			return
+		}
+
+		stream.resp = &models.RunResponse{
+			GenerateResponse: *rendered,
+			Model:            completion.Model,
+			FinishReason:     completion.FinishReason,
+			Usage:            completion.Usage,
+			LatencyMs:        time.Since(start).Milliseconds(),
+		}
+		stream.resp.Result = completion.Content
+	}()
+	return stream, nil
+}
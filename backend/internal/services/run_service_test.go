@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/llm"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// fakeProvider 记录收到的请求，返回固定的输出
+type fakeProvider struct {
+	requests []llm.Request
+}
+
+func (p *fakeProvider) Complete(_ context.Context, req llm.Request) (*llm.Response, error) {
+	p.requests = append(p.requests, req)
+	return &llm.Response{Content: "ok", Model: req.Model, FinishReason: "stop"}, nil
+}
+
+func (p *fakeProvider) Stream(ctx context.Context, req llm.Request, onDelta func(string) error) (*llm.Response, error) {
+	resp, _ := p.Complete(ctx, req)
+	if err := onDelta(resp.Content); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func TestRunServiceModelAllowlist(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   string
+		wantErr bool
+	}{
+		{"default model", "", false},
+		{"allowed", "gpt-4o", false},
+		{"not allowed", "gpt-4-32k", true},
+		{"case sensitive", "GPT-4o", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+			repo := &fakeTemplateRepo{}
+			tmpl := repo.add(&models.PromptTemplate{UserID: caller.UserID, Content: "Hello"})
+			provider := &fakeProvider{}
+			s := NewRunService(NewTemplateService(repo, nil, nil, nil), provider, []string{"gpt-4o-mini", "gpt-4o"})
+			req := models.RunRequest{GenerateRequest: models.GenerateRequest{TemplateID: tmpl.ID}, Model: tt.model}
+
+			_, runErr := s.Run(context.Background(), req, caller)
+			stream, streamErr := s.Stream(context.Background(), req, caller)
+			if stream != nil {
+				for range stream.Deltas {
+				}
+			}
+			for name, err := range map[string]error{"Run": runErr, "Stream": streamErr} {
+				if tt.wantErr != errors.Is(err, ErrModelNotAllowed) {
+					t.Errorf("%s: err = %v, want model not allowed = %v", name, err, tt.wantErr)
+				}
+				if !tt.wantErr && err != nil {
+					t.Errorf("%s: %v", name, err)
+				}
+			}
+			// 被拒绝的请求不会发送给模型
+			if wantCalls := map[bool]int{false: 2, true: 0}[tt.wantErr]; len(provider.requests) != wantCalls {
+				t.Errorf("provider called %d times, want %d", len(provider.requests), wantCalls)
+			}
+		})
+	}
+}
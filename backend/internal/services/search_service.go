@@ -0,0 +1,85 @@
+package services
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// SearchTemplates 全文检索调用方可以查看的模板，按相关度排序，同时返回匹配总数
+func (s *TemplateService) SearchTemplates(q models.TemplateSearchQuery, page, pageSize int, viewer *auth.Identity) ([]models.TemplateSearchResult, int64, error) {
+	limit := pageSize
+	offset := (page - 1) * pageSize
+	var viewerID *uuid.UUID
+	if viewer != nil {
+		viewerID = &viewer.UserID
+	}
+	results, total, err := s.repo.Search(q, viewerID, viewer.IsAdmin(), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range results {
+		results[i].Snippet = formatSnippet(results[i].Snippet)
+	}
+	return results, total, nil
+}
+
+// formatSnippet 整理 ts_headline 生成的摘要：
+// 去掉为分词在中日韩文字两侧插入的空格、合并相邻的命中标记，
+// 转义 HTML 后将命中标记替换为 <mark>
+func formatSnippet(snippet string) string {
+	runes := []rune(snippet)
+	var b strings.Builder
+	// prev 为已输出的最后一个非标记字符
+	var prev rune
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if !unicode.IsSpace(r) {
+			b.WriteRune(r)
+			if !isHighlightMark(r) {
+				prev = r
+			}
+			continue
+		}
+		j := i
+		for j < len(runes) && unicode.IsSpace(runes[j]) {
+			j++
+		}
+		next := rune(0)
+		for k := j; k < len(runes); k++ {
+			if !unicode.IsSpace(runes[k]) && !isHighlightMark(runes[k]) {
+				next = runes[k]
+				break
+			}
+		}
+		if prev != 0 && next != 0 && !(isCJK(prev) && isCJK(next)) {
+			b.WriteByte(' ')
+		}
+		i = j - 1
+	}
+
+	text := strings.ReplaceAll(b.String(), models.SearchHighlightStop+models.SearchHighlightStart, "")
+	text = html.EscapeString(text)
+	return strings.NewReplacer(
+		models.SearchHighlightStart, "<mark>",
+		models.SearchHighlightStop, "</mark>",
+	).Replace(text)
+}
+
+func isHighlightMark(r rune) bool {
+	return string(r) == models.SearchHighlightStart || string(r) == models.SearchHighlightStop
+}
+
+// isCJK 与 internal/database/migrations/011_template_search.up.sql 中 template_search_text 单独分词的字符范围一致
+func isCJK(r rune) bool {
+	return (r >= 0x3040 && r <= 0x30ff) ||
+		(r >= 0x3400 && r <= 0x4dbf) ||
+		(r >= 0x4e00 && r <= 0x9fff) ||
+		(r >= 0xf900 && r <= 0xfaff) ||
+		(r >= 0xac00 && r <= 0xd7af)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+
+	"prompt-backend/internal/models"
+)
+
+func TestFormatSnippet(t *testing.T) {
+	const start, stop = models.SearchHighlightStart, models.SearchHighlightStop
+
+	tests := []struct {
+		name    string
+		snippet string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"latin text unchanged", "write a summary", "write a summary"},
+		{"whitespace collapsed", "write \n\t a  summary", "write a summary"},
+		{"leading and trailing space", "  summary  ", "summary"},
+		{"cjk spacing removed", "写 一 篇 摘 要", "写一篇摘要"},
+		{"kana and hangul", "こ ん に ち は 안 녕", "こんにちは안녕"},
+		{"space kept between cjk and latin", "使 用 GPT 生 成", "使用 GPT 生成"},
+		{"digits next to cjk", "第 3 章", "第 3 章"},
+		{"highlight", "write a " + start + "summary" + stop, "write a <mark>summary</mark>"},
+		{"cjk highlight", "写 一 篇 " + start + "摘" + stop + " " + start + "要" + stop, "写一篇<mark>摘要</mark>"},
+		{"adjacent highlights merged", start + "摘" + stop + start + "要" + stop, "<mark>摘要</mark>"},
+		{"separate latin highlights", start + "a" + stop + " " + start + "b" + stop, "<mark>a</mark> <mark>b</mark>"},
+		{"cjk highlight after latin", "GPT " + start + "摘" + stop, "GPT <mark>摘</mark>"},
+		{"html escaped", `<b>"a" & b</b>`, "&lt;b&gt;&#34;a&#34; &amp; b&lt;/b&gt;"},
+		{"html in highlight", start + "<x>" + stop, "<mark>&lt;x&gt;</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatSnippet(tt.snippet); got != tt.want {
+				t.Errorf("formatSnippet(%q) = %q, want %q", tt.snippet, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsCJK(t *testing.T) {
+	// 与 migrations/011_template_search.up.sql 中的字符范围一致
+	tests := []struct {
+		r    rune
+		want bool
+	}{
+		{'a', false},
+		{'1', false},
+		{'，', false},
+		{'ぁ', true},
+		{'ヿ', true},
+		{'㐀', true},
+		{'中', true},
+		{'鿿', true},
+		{'豈', true},
+		{'가', true},
+		{'힯', true},
+		{'ힰ', false},
+	}
+	for _, tt := range tests {
+		if got := isCJK(tt.r); got != tt.want {
+			t.Errorf("isCJK(%q U+%04X) = %v, want %v", tt.r, tt.r, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+	"prompt-backend/internal/services/repository"
+
+	"github.com/google/uuid"
+)
+
+// maxPendingValues 内存中最多合并的变量取值个数（按模板、天、变量、取值计），超出后新的取值不再统计
+const maxPendingValues = 50000
+
+// UsageStatsQueueMetrics 使用统计写入队列的运行指标
+type UsageStatsQueueMetrics struct {
+	PendingRows   int   `json:"pending_rows"`
+	DroppedValues int64 `json:"dropped_values"`
+}
+
+// usageStatsQueue 使用统计（小时计数、调用方、变量取值）的写入队列，按主键合并后
+// 随 UsageRecorder 的刷新在一个事务中批量 upsert；写入失败时整批放回，不会重复累加。
+// 数据库拒绝的变量取值（数据错误）被丢弃并计入 DroppedValues，不会使整批一直重试。
+type usageStatsQueue struct {
+	repo repository.UsageStatsRepository
+
+	mu      sync.Mutex
+	pending *models.UsageStatsBatch
+	dropped int64
+}
+
+// newUsageStatsQueue 创建使用统计队列并注册到 recorder
+func newUsageStatsQueue(repo repository.UsageStatsRepository, recorder *UsageRecorder) *usageStatsQueue {
+	q := &usageStatsQueue{repo: repo, pending: models.NewUsageStatsBatch()}
+	recorder.register("stats", q)
+	return q
+}
+
+// add 将一次（或一批）生成的统计合并到内存中，随下一次刷新写入
+func (q *usageStatsQueue) add(event models.UsageEvent) {
+	if event.Generations <= 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dropped += int64(q.pending.Add(event, maxPendingValues))
+}
+
+func (q *usageStatsQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending.Empty()
+}
+
+func (q *usageStatsQueue) flush() error {
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = models.NewUsageStatsBatch()
+	q.mu.Unlock()
+	if batch.Empty() {
+		return nil
+	}
+
+	rest := batch
+	var dropped int64
+	err := q.repo.RecordBatch(batch)
+	if err != nil && repository.IsDataError(err) {
+		rest = models.NewUsageStatsBatch()
+		dropped, err = q.recordSplit(batch, rest)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.dropped += dropped
+	if err != nil {
+		rest.Merge(q.pending)
+		q.pending = rest
+	}
+	return err
+}
+
+// recordSplit 整批写入因数据错误失败后，先单独写入小时计数和调用方，再分批写入变量取值：
+// 失败的分批二分重试，丢弃数据库拒绝的取值。遇到其他错误时未写入的部分合并到 rest，返回丢弃的取值个数。
+func (q *usageStatsQueue) recordSplit(batch, rest *models.UsageStatsBatch) (int64, error) {
+	counts := &models.UsageStatsBatch{Hourly: batch.Hourly, Callers: batch.Callers, Values: map[models.VariableValueKey]int64{}}
+	if err := q.repo.RecordBatch(counts); err != nil {
+		rest.Merge(batch)
+		return 0, err
+	}
+	keys := make([]models.VariableValueKey, 0, len(batch.Values))
+	for key := range batch.Values {
+		keys = append(keys, key)
+	}
+	return q.recordValues(keys, batch.Values, rest)
+}
+
+// recordValues 写入 keys 对应的变量取值，数据错误时二分重试直到找出被拒绝的单个取值
+func (q *usageStatsQueue) recordValues(keys []models.VariableValueKey, values map[models.VariableValueKey]int64, rest *models.UsageStatsBatch) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	chunk := models.NewUsageStatsBatch()
+	for _, key := range keys {
+		chunk.Values[key] = values[key]
+	}
+	err := q.repo.RecordBatch(chunk)
+	switch {
+	case err == nil:
+		return 0, nil
+	case !repository.IsDataError(err):
+		rest.Merge(chunk)
+		return 0, err
+	case len(keys) == 1:
+		log.Printf("dropping variable value stats for template %s variable %s rejected by the database: %v", keys[0].TemplateID, keys[0].Variable, err)
+		return 1, nil
+	}
+
+	half := len(keys) / 2
+	dropped, err := q.recordValues(keys[:half], values, rest)
+	if err != nil {
+		for _, key := range keys[half:] {
+			rest.Values[key] += values[key]
+		}
+		return dropped, err
+	}
+	more, err := q.recordValues(keys[half:], values, rest)
+	return dropped + more, err
+}
+
+func (q *usageStatsQueue) metrics() interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return UsageStatsQueueMetrics{
+		PendingRows:   len(q.pending.Hourly) + len(q.pending.Callers) + len(q.pending.Values),
+		DroppedValues: q.dropped,
+	}
+}
+
+// recordUsage 将使用统计交给写入队列，与使用次数一起批量写入；不在请求中同步写库，不影响生成结果
+func (s *TemplateService) recordUsage(event models.UsageEvent) {
+	if s.statsQueue != nil {
+		s.statsQueue.add(event)
+	}
+}
+
+// usageEvent 单次生成的统计数据。变量取值只统计成功的生成，并遵循与生成记录相同的 redact_runs 设置：
+// 开启时不统计任何取值（隐去后的占位符没有统计意义）。
+func usageEvent(p *preparedTemplate, variables map[string]string, caller *auth.Identity, renderErr error) models.UsageEvent {
+	event := models.UsageEvent{
+		TemplateID:  p.source.TemplateID,
+		At:          time.Now(),
+		UserID:      callerID(caller),
+		Generations: 1,
+	}
+	if renderErr != nil {
+		event.Errors = 1
+	} else {
+		event.Variables = p.trackedVariables(variables)
+	}
+	return event
+}
+
+// trackedVariables 过滤出参与取值统计的变量：模板开启 redact_runs 时不统计，空值、过长的值和包含控制字符的值不统计
+func (p *preparedTemplate) trackedVariables(variables map[string]string) map[string]string {
+	if p.redactRuns {
+		return nil
+	}
+	tracked := make(map[string]string, len(variables))
+	for name, value := range variables {
+		if value != "" && utf8.RuneCountInString(value) <= models.MaxTrackedValueLen && !models.ContainsControlChar(value) {
+			tracked[name] = value
+		}
+	}
+	return tracked
+}
+
+func callerID(caller *auth.Identity) *uuid.UUID {
+	if caller == nil {
+		return nil
+	}
+	id := caller.UserID
+	return &id
+}
+
+// GetTemplateStats 获取模板的使用统计，仅模板所有者和管理员可见（包含调用方传入的变量取值）。
+// 没有数据的时间段以 0 填充。
+func (s *TemplateService) GetTemplateStats(id uuid.UUID, q models.StatsQuery, viewer *auth.Identity) (*models.TemplateStats, error) {
+	tmpl, err := s.getTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canView(tmpl, viewer) {
+		return nil, ErrTemplateNotFound
+	}
+	if !canModify(tmpl, viewer) {
+		return nil, ErrForbidden
+	}
+
+	step := time.Hour
+	if q.Interval == models.StatsIntervalDay {
+		step = 24 * time.Hour
+	}
+	from := q.From.UTC().Truncate(step)
+	to := q.To.UTC()
+
+	buckets, err := s.stats.Buckets(id, models.StatsQuery{Interval: q.Interval, From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+	total, err := s.stats.Totals(id, from, to)
+	if err != nil {
+		return nil, err
+	}
+	total.SetErrorRate()
+	topValues, err := s.stats.TopValues(id, from, to, models.TopValuesPerVariable)
+	if err != nil {
+		return nil, err
+	}
+
+	byStart := make(map[time.Time]models.UsageBucket, len(buckets))
+	for _, bucket := range buckets {
+		byStart[bucket.Start] = bucket
+	}
+	filled := make([]models.UsageBucket, 0, int(to.Sub(from)/step)+1)
+	for start := from; start.Before(to); start = start.Add(step) {
+		bucket, ok := byStart[start]
+		if !ok {
+			bucket = models.UsageBucket{Start: start}
+		}
+		bucket.SetErrorRate()
+		filled = append(filled, bucket)
+	}
+
+	return &models.TemplateStats{
+		TemplateID: id,
+		Interval:   q.Interval,
+		From:       from,
+		To:         to,
+		Total:      total,
+		Buckets:    filled,
+		TopValues:  topValues,
+	}, nil
+}
+
+// GetTopTemplates 获取时间范围内生成次数最多的模板，只包含调用方可以查看的模板
+func (s *TemplateService) GetTopTemplates(from, to time.Time, limit int, viewer *auth.Identity) ([]models.TemplateUsage, error) {
+	var viewerID *uuid.UUID
+	if viewer != nil {
+		viewerID = &viewer.UserID
+	}
+	usage, err := s.stats.TopTemplates(viewerID, viewer.IsAdmin(), from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range usage {
+		usage[i].SetErrorRate()
+	}
+	return usage, nil
+}
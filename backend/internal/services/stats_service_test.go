@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestUsageEventVariables(t *testing.T) {
+	variables := map[string]string{"name": "Alice", "empty": "", "long": strings.Repeat("x", models.MaxTrackedValueLen+1), "nul": "a\x00b"}
+
+	tests := []struct {
+		name      string
+		redact    bool
+		renderErr error
+		want      map[string]string
+	}{
+		{"tracked", false, nil, map[string]string{"name": "Alice"}},
+		{"redacted template", true, nil, nil},
+		{"failed generation", false, ErrInvalidTemplate, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &preparedTemplate{source: &models.PromptTemplateVersion{TemplateID: uuid.New()}, redactRuns: tt.redact}
+			event := usageEvent(p, variables, nil, tt.renderErr)
+			if len(event.Variables) != len(tt.want) {
+				t.Fatalf("variables = %v, want %v", event.Variables, tt.want)
+			}
+			for name, value := range tt.want {
+				if event.Variables[name] != value {
+					t.Errorf("%s = %q, want %q", name, event.Variables[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestUsageStatsBatch(t *testing.T) {
+	templateID, userID := uuid.New(), uuid.New()
+	at := time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC)
+	event := models.UsageEvent{TemplateID: templateID, At: at, UserID: &userID, Generations: 2, Errors: 1, Variables: map[string]string{"lang": "go"}}
+
+	batch := models.NewUsageStatsBatch()
+	batch.Add(event, 0)
+	batch.Add(models.UsageEvent{TemplateID: templateID, At: at.Add(30 * time.Minute), UserID: &userID, Generations: 1, Variables: map[string]string{"lang": "go"}}, 0)
+
+	other := models.NewUsageStatsBatch()
+	other.Add(event, 0)
+	batch.Merge(other)
+
+	hour := models.UsageHourKey{TemplateID: templateID, Bucket: at.Truncate(time.Hour)}
+	if len(batch.Hourly) != 1 || batch.Hourly[hour].Generations != 5 || batch.Hourly[hour].Errors != 2 {
+		t.Errorf("hourly = %v, want one bucket with 5 generations and 2 errors", batch.Hourly)
+	}
+	if len(batch.Callers) != 1 {
+		t.Errorf("callers = %v, want one", batch.Callers)
+	}
+	value := models.VariableValueKey{TemplateID: templateID, Bucket: at.Truncate(24 * time.Hour), Variable: "lang", Value: "go"}
+	if len(batch.Values) != 1 || batch.Values[value] != 3 {
+		t.Errorf("values = %v, want lang=go used 3 times", batch.Values)
+	}
+
+	// 取值个数达到上限后只丢弃新的取值，已有取值和计数照常累加
+	if dropped := batch.Add(models.UsageEvent{TemplateID: templateID, At: at, Generations: 1, Variables: map[string]string{"lang": "go", "os": "linux"}}, 1); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	if len(batch.Values) != 1 || batch.Values[value] != 4 || batch.Hourly[hour].Generations != 6 {
+		t.Errorf("after cap: values = %v, hourly = %v", batch.Values, batch.Hourly)
+	}
+}
+
+func TestUsageStatsQueueRequeuesFailedFlush(t *testing.T) {
+	stats := &fakeStatsStore{failures: failures{failOn: map[int]bool{1: true}}}
+	r := NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval)
+	q := newUsageStatsQueue(stats, r)
+
+	id := uuid.New()
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	q.add(models.UsageEvent{TemplateID: id, At: at, Generations: 2})
+	q.add(models.UsageEvent{TemplateID: id, At: at}) // 没有生成次数的事件忽略
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the injected error")
+	}
+	if m := r.Metrics(); m.FailedFlushes != 1 || m.Buffers["stats"] != (UsageStatsQueueMetrics{PendingRows: 1}) {
+		t.Fatalf("after failed flush: %+v", m)
+	}
+
+	// 失败的整批与新的统计合并后由 Close 写入，不会重复累加
+	q.add(models.UsageEvent{TemplateID: id, At: at, Generations: 1, Errors: 1})
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	hour := stats.total.Hourly[models.UsageHourKey{TemplateID: id, Bucket: at}]
+	if len(stats.total.Hourly) != 1 || hour.Generations != 3 || hour.Errors != 1 {
+		t.Errorf("hourly = %v, want 3 generations and 1 error", stats.total.Hourly)
+	}
+	if m := q.metrics().(UsageStatsQueueMetrics); m.PendingRows != 0 {
+		t.Errorf("pending after Close: %+v", m)
+	}
+}
+
+func TestUsageStatsQueueDropsRejectedValues(t *testing.T) {
+	stats := &fakeStatsStore{reject: map[string]bool{"bad": true}}
+	r := NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval)
+	q := newUsageStatsQueue(stats, r)
+
+	// 一个模板的取值被数据库拒绝时，所有模板的计数和其他取值照常写入，被拒绝的取值不再重试
+	a, b := uuid.New(), uuid.New()
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	q.add(models.UsageEvent{TemplateID: a, At: at, Generations: 1, Variables: map[string]string{"v": "bad"}})
+	for i := 0; i < 9; i++ {
+		q.add(models.UsageEvent{TemplateID: b, At: at, Generations: 1, Variables: map[string]string{"v": fmt.Sprintf("ok%d", i)}})
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if stats.total.Hourly[models.UsageHourKey{TemplateID: a, Bucket: at}].Generations != 1 ||
+		stats.total.Hourly[models.UsageHourKey{TemplateID: b, Bucket: at}].Generations != 9 {
+		t.Errorf("hourly = %v, want both templates counted", stats.total.Hourly)
+	}
+	if len(stats.total.Values) != 9 {
+		t.Errorf("values = %v, want the 9 accepted values", stats.total.Values)
+	}
+	if m := q.metrics().(UsageStatsQueueMetrics); m.PendingRows != 0 || m.DroppedValues != 1 {
+		t.Fatalf("after flush: %+v", m)
+	}
+
+	q.add(models.UsageEvent{TemplateID: b, At: at, Generations: 1})
+	if err := r.Flush(); err != nil {
+		t.Fatalf("second Flush: %v", err)
+	}
+	if got := stats.total.Hourly[models.UsageHourKey{TemplateID: b, Bucket: at}].Generations; got != 10 {
+		t.Errorf("generations = %d, want the later event written", got)
+	}
+}
+
+func TestUsageStatsQueueRequeuesValuesAfterConnectionError(t *testing.T) {
+	// 第 1 次整批写入数据错误，第 2 次写入计数成功，第 3 次写入取值时连接中断：取值放回队列，计数不重复写入
+	stats := &fakeStatsStore{reject: map[string]bool{"bad": true}, failures: failures{failOn: map[int]bool{3: true}}}
+	r := NewUsageRecorder(&fakeUsageCounts{}, testFlushInterval)
+	q := newUsageStatsQueue(stats, r)
+
+	id := uuid.New()
+	at := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	q.add(models.UsageEvent{TemplateID: id, At: at, Generations: 1, Variables: map[string]string{"v": "bad"}})
+	q.add(models.UsageEvent{TemplateID: id, At: at, Generations: 1, Variables: map[string]string{"v": "ok"}})
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the connection error")
+	}
+	if m := q.metrics().(UsageStatsQueueMetrics); m.PendingRows != 2 || m.DroppedValues != 0 {
+		t.Fatalf("after failed flush: %+v", m)
+	}
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	if got := stats.total.Hourly[models.UsageHourKey{TemplateID: id, Bucket: at}].Generations; got != 2 {
+		t.Errorf("generations = %d, want 2", got)
+	}
+	if len(stats.total.Values) != 1 {
+		t.Errorf("values = %v, want only the accepted value", stats.total.Values)
+	}
+	if m := q.metrics().(UsageStatsQueueMetrics); m.PendingRows != 0 || m.DroppedValues != 1 {
+		t.Errorf("after retry: %+v", m)
+	}
+}
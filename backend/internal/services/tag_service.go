@@ -0,0 +1,20 @@
+package services
+
+import (
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// GetTagCounts 获取各标签的模板数，只统计调用方可以查看的模板；publicOnly 为 true 时只统计公开模板
+func (s *TemplateService) GetTagCounts(publicOnly bool, limit int, viewer *auth.Identity) ([]models.TagCount, error) {
+	if publicOnly {
+		return s.repo.TagCounts(nil, false, limit)
+	}
+	var viewerID *uuid.UUID
+	if viewer != nil {
+		viewerID = &viewer.UserID
+	}
+	return s.repo.TagCounts(viewerID, viewer.IsAdmin(), limit)
+}
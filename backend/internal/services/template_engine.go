@@ -0,0 +1,587 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// 模板语法（完整说明见 README 的“模板语法”一节）：
+//
+//	{{name}}                      输出变量
+//	{{#if name}}…{{else}}…{{/if}}  条件，空字符串、"false"、"0"、空列表为假（见 truthy）
+//	{{#unless name}}…{{/unless}}  条件取反
+//	{{#each items}}…{{/each}}     遍历列表变量，块内 {{this}} 为当前元素，{{@index}} 为从 0 开始的下标
+//	{{> template:<id 或 slug>}}    包含另一个模板当前版本的内容（partial），其变量与当前模板共用
+//	{{> template:<id 或 slug>@3}}  包含另一个模板第 3 版的内容
+//	{{name | upper | indent 4}}   对输出的值依次应用过滤器，可用的过滤器见 templateFilters
+//
+// 模板内容不会直接交给 text/template 解析，而是先由 compileTemplate 逐个解析标签，
+// 再生成只包含上述结构的 text/template 源码，原始文本一律作为字符串常量输出，
+// 因此用户无法在模板中调用任意的 text/template 动作或函数。
+
+var ErrInvalidTemplate = errors.New("invalid template content")
+
+var identPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// partialRefPattern 合法的 partial 引用（模板 ID 或别名），可以用 @版本号 固定版本
+var partialRefPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]+(@[1-9][0-9]*)?$`)
+
+const (
+	// maxPartialDepth partial 最大嵌套层数
+	maxPartialDepth = 5
+	// maxPartialIncludes 单个模板展开的 partial 总数上限，避免菱形引用导致指数级展开
+	maxPartialIncludes = 50
+)
+
+// partialScope 展开 partial 所需的上下文
+type partialScope struct {
+	// resolve 根据 {{> template:<ref>}} 中的引用查找被包含的模板（引用带 @版本号 时返回该版本的内容）。
+	// 模板或版本不存在、调用方不可见时返回 ErrTemplateNotFound 或 ErrVersionNotFound，
+	// 公开模板包含私有模板时返回 ErrPrivatePartial。
+	resolve func(ref string) (*models.PromptTemplate, error)
+	// templateID 为当前模板的 ID（新建模板时为 uuid.Nil），用于检测循环引用
+	templateID uuid.UUID
+}
+
+type tokenKind int
+
+const (
+	tokText tokenKind = iota
+	tokVariable
+	tokThis
+	tokIndex
+	tokLiteral
+	tokIf
+	tokUnless
+	tokEach
+	tokElse
+	tokClose
+	tokPartial
+)
+
+type token struct {
+	kind tokenKind
+	// text 对文本为原文，对变量和块为变量名，对结束标签为块名（if/unless/each），对 partial 为引用
+	text string
+	line int
+	// filters 为输出标签上的过滤器
+	filters []filterCall
+}
+
+func (t token) isBlock() bool {
+	switch t.kind {
+	case tokIf, tokUnless, tokEach, tokElse, tokClose:
+		return true
+	}
+	return false
+}
+
+func (t token) hasFilter(name string) bool {
+	for _, f := range t.filters {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// pipeline 返回过滤器对应的 text/template 管道。没有过滤器时经过 text 输出，
+// 列表变量与经过过滤器时一样按行输出，而不是 Go 的 [a b] 格式
+func (t token) pipeline() string {
+	if len(t.filters) == 0 {
+		return " | text"
+	}
+	var b strings.Builder
+	for _, f := range t.filters {
+		b.WriteString(" | " + f.name)
+		for _, arg := range f.args {
+			b.WriteString(" " + arg)
+		}
+	}
+	return b.String()
+}
+
+// compiledTemplate 编译后的模板
+type compiledTemplate struct {
+	source string
+	// variables 为引用到的顶层变量，按首次出现的顺序排列
+	variables []string
+	// lists 为被 {{#each}} 遍历的变量，渲染时需要以列表形式传入
+	lists map[string]bool
+	// outputs 为在任何块之外直接输出的变量，未声明时视为必填
+	outputs map[string]bool
+	// partials 为展开的 partial 模板（按模板和版本去重，按首次出现的顺序排列）
+	partials []*models.PromptTemplate
+	// parts 为模板的段数，普通模板为 1，对话模板为消息条数
+	parts int
+	tmpl  *template.Template
+}
+
+// compileTemplate 将模板内容编译为 text/template 源码，scope 为 nil 时模板中不允许出现 partial
+func compileTemplate(content string, scope *partialScope) (*compiledTemplate, error) {
+	return compileParts([]string{content}, scope)
+}
+
+// compileParts 将多段模板内容（如对话模板的各条消息）编译为一个模板。
+// 各段共用变量，分别定义为独立的子模板，渲染时依次输出，见 renderParts。
+func compileParts(contents []string, scope *partialScope) (*compiledTemplate, error) {
+	c := &compiledTemplate{lists: make(map[string]bool), outputs: make(map[string]bool), parts: len(contents)}
+
+	e := &partialExpander{scope: scope, compiled: c}
+	var chain []uuid.UUID
+	if scope != nil && scope.templateID != uuid.Nil {
+		chain = append(chain, scope.templateID)
+	}
+
+	var buf strings.Builder
+	loopCount := 0
+	for i, content := range contents {
+		tokens, err := e.parse(content, chain)
+		if err == nil {
+			fmt.Fprintf(&buf, "{{define %q}}", partName(i))
+			err = c.emit(&buf, tokens, &loopCount)
+			buf.WriteString("{{end}}")
+		}
+		if err != nil {
+			if len(contents) > 1 {
+				return nil, fmt.Errorf("message %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+	}
+
+	c.source = buf.String()
+	// 编译结果可被并发渲染（如批量生成），这里只解析一次
+	t, err := template.New("prompt").Funcs(filterFuncs).Option("missingkey=error").Parse(c.source)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	c.tmpl = t
+	return c, nil
+}
+
+// emit 将标签序列转换为 text/template 源码，同时记录引用到的变量。
+// loopCount 为已分配的循环变量编号，多段内容之间共用，避免重名。
+func (c *compiledTemplate) emit(buf *strings.Builder, tokens []token, loopCount *int) error {
+	type frame struct {
+		kind    tokenKind
+		line    int
+		hasElse bool
+		// loop 为 {{#each}} 块的循环变量编号
+		loop int
+	}
+	var stack []frame
+	var loops []int
+	currentLoop := func() (int, bool) {
+		if len(loops) == 0 {
+			return 0, false
+		}
+		return loops[len(loops)-1], true
+	}
+	// operand 返回条件或输出所引用的值表达式
+	operand := func(t token) (string, error) {
+		if t.text == "this" {
+			loop, ok := currentLoop()
+			if !ok {
+				return "", templateError(t.line, "{{this}} can only be used inside {{#each}}")
+			}
+			return fmt.Sprintf("$it%d", loop), nil
+		}
+		c.addVariable(t.text)
+		return "$." + t.text, nil
+	}
+
+	for _, t := range tokens {
+		switch t.kind {
+		case tokText:
+			writeText(buf, t.text)
+		case tokLiteral:
+			writeText(buf, t.text)
+		case tokVariable, tokThis:
+			expr, err := operand(t)
+			if err != nil {
+				return err
+			}
+			if t.kind == tokVariable {
+				// 使用 default 过滤器的变量可以省略，被 join 的变量按列表传入
+				if len(stack) == 0 && !t.hasFilter("default") {
+					c.outputs[t.text] = true
+				}
+				if t.hasFilter("join") {
+					c.lists[t.text] = true
+				}
+			}
+			buf.WriteString("{{" + expr + t.pipeline() + "}}")
+		case tokIndex:
+			loop, ok := currentLoop()
+			if !ok {
+				return templateError(t.line, "{{@index}} can only be used inside {{#each}}")
+			}
+			fmt.Fprintf(buf, "{{$idx%d%s}}", loop, t.pipeline())
+		case tokIf, tokUnless:
+			expr, err := operand(t)
+			if err != nil {
+				return err
+			}
+			if t.kind == tokIf {
+				buf.WriteString("{{if truthy " + expr + "}}")
+			} else {
+				buf.WriteString("{{if not (truthy " + expr + ")}}")
+			}
+			stack = append(stack, frame{kind: t.kind, line: t.line})
+		case tokEach:
+			if t.text == "this" {
+				return templateError(t.line, "{{#each}} requires a variable name")
+			}
+			c.addVariable(t.text)
+			c.lists[t.text] = true
+			*loopCount++
+			loop := *loopCount
+			fmt.Fprintf(buf, "{{range $idx%d, $it%d := $.%s}}", loop, loop, t.text)
+			stack = append(stack, frame{kind: t.kind, line: t.line, loop: loop})
+			loops = append(loops, loop)
+		case tokElse:
+			if len(stack) == 0 {
+				return templateError(t.line, "{{else}} outside of a block")
+			}
+			top := &stack[len(stack)-1]
+			if top.hasElse {
+				return templateError(t.line, "duplicate {{else}} in block")
+			}
+			top.hasElse = true
+			if top.kind == tokEach {
+				// {{else}} 之后不再处于循环体内
+				loops = loops[:len(loops)-1]
+			}
+			buf.WriteString("{{else}}")
+		case tokClose:
+			if len(stack) == 0 {
+				return templateError(t.line, "unexpected {{/%s}}", t.text)
+			}
+			top := stack[len(stack)-1]
+			if blockName(top.kind) != t.text {
+				return templateError(t.line, "{{/%s}} does not match {{#%s}} opened at line %d", t.text, blockName(top.kind), top.line)
+			}
+			stack = stack[:len(stack)-1]
+			if top.kind == tokEach && !top.hasElse {
+				loops = loops[:len(loops)-1]
+			}
+			buf.WriteString("{{end}}")
+		}
+	}
+	if len(stack) > 0 {
+		top := stack[len(stack)-1]
+		return templateError(top.line, "{{#%s}} is not closed", blockName(top.kind))
+	}
+	return nil
+}
+
+func (c *compiledTemplate) addVariable(name string) {
+	for _, v := range c.variables {
+		if v == name {
+			return
+		}
+	}
+	c.variables = append(c.variables, name)
+}
+
+// renderParts 使用给定数据依次渲染各段模板，可并发调用
+func (c *compiledTemplate) renderParts(data map[string]interface{}) ([]string, error) {
+	results := make([]string, 0, c.parts)
+	for i := 0; i < c.parts; i++ {
+		var buf bytes.Buffer
+		if err := c.tmpl.ExecuteTemplate(&buf, partName(i), data); err != nil {
+			return nil, err
+		}
+		results = append(results, buf.String())
+	}
+	return results, nil
+}
+
+func partName(i int) string {
+	return "part" + strconv.Itoa(i)
+}
+
+// partialExpander 递归展开模板中的 partial
+type partialExpander struct {
+	scope    *partialScope
+	compiled *compiledTemplate
+	includes int
+}
+
+// parse 切分模板内容并将其中的 partial 替换为被包含模板的标签序列。
+// chain 为从根模板到当前模板的包含路径。
+func (e *partialExpander) parse(content string, chain []uuid.UUID) ([]token, error) {
+	tokens, err := tokenize(content)
+	if err != nil {
+		return nil, err
+	}
+	stripStandaloneLines(tokens)
+
+	result := make([]token, 0, len(tokens))
+	for _, t := range tokens {
+		if t.kind != tokPartial {
+			result = append(result, t)
+			continue
+		}
+		partial, err := e.include(t, chain)
+		if err != nil {
+			return nil, err
+		}
+		nested, err := e.parse(partial.Content, append(chain[:len(chain):len(chain)], partial.ID))
+		if err != nil {
+			return nil, fmt.Errorf("in partial %q: %w", t.text, err)
+		}
+		result = append(result, nested...)
+	}
+	return result, nil
+}
+
+// include 解析 partial 引用，并检查嵌套深度、总数和循环引用
+func (e *partialExpander) include(t token, chain []uuid.UUID) (*models.PromptTemplate, error) {
+	if e.scope == nil {
+		return nil, templateError(t.line, "partials are not supported here")
+	}
+	if len(chain) > maxPartialDepth {
+		return nil, templateError(t.line, "partials nested too deeply (max %d)", maxPartialDepth)
+	}
+	e.includes++
+	if e.includes > maxPartialIncludes {
+		return nil, templateError(t.line, "too many partials (max %d)", maxPartialIncludes)
+	}
+
+	partial, err := e.scope.resolve(t.text)
+	switch {
+	case errors.Is(err, ErrTemplateNotFound):
+		return nil, templateError(t.line, "partial %q not found", t.text)
+	case errors.Is(err, ErrVersionNotFound):
+		return nil, templateError(t.line, "partial %q: version not found", t.text)
+	case errors.Is(err, ErrPrivatePartial):
+		return nil, templateError(t.line, "partial %q is private and cannot be included in a public template", t.text)
+	case err != nil:
+		return nil, err
+	}
+	for _, id := range chain {
+		if id == partial.ID {
+			return nil, templateError(t.line, "partial %q includes itself", t.text)
+		}
+	}
+
+	seen := false
+	for _, p := range e.compiled.partials {
+		if p.ID == partial.ID && p.Version == partial.Version {
+			seen = true
+			break
+		}
+	}
+	if !seen {
+		e.compiled.partials = append(e.compiled.partials, partial)
+	}
+	return partial, nil
+}
+
+// tokenize 将模板内容切分为文本和标签
+func tokenize(content string) ([]token, error) {
+	var tokens []token
+	line := 1
+	rest := content
+	for rest != "" {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			tokens = append(tokens, token{kind: tokText, text: rest, line: line})
+			break
+		}
+		if start > 0 {
+			tokens = append(tokens, token{kind: tokText, text: rest[:start], line: line})
+			line += strings.Count(rest[:start], "\n")
+		}
+
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			return nil, templateError(line, "unclosed tag")
+		}
+		raw := rest[start : start+2+end+2]
+		tok, err := parseTag(strings.TrimSpace(raw[2:len(raw)-2]), line)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+		line += strings.Count(raw, "\n")
+		rest = rest[start+len(raw):]
+	}
+	return tokens, nil
+}
+
+// parseTag 解析 {{ 与 }} 之间的内容
+func parseTag(inner string, line int) (token, error) {
+	if segments := splitPipeline(inner); len(segments) > 1 {
+		return parseFilteredTag(segments, line)
+	}
+
+	switch {
+	case inner == "":
+		return token{}, templateError(line, "empty tag")
+	case inner == "else":
+		return token{kind: tokElse, line: line}, nil
+	case inner == "this" || inner == ".":
+		return token{kind: tokThis, text: "this", line: line}, nil
+	case inner == "@index":
+		return token{kind: tokIndex, line: line}, nil
+	case strings.HasPrefix(inner, "#"):
+		fields := strings.Fields(inner[1:])
+		if len(fields) != 2 {
+			return token{}, templateError(line, "block tag {{%s}} requires exactly one variable", inner)
+		}
+		kind, ok := map[string]tokenKind{"if": tokIf, "unless": tokUnless, "each": tokEach}[fields[0]]
+		if !ok {
+			return token{}, templateError(line, "unknown block {{#%s}}", fields[0])
+		}
+		arg := fields[1]
+		if arg == "." {
+			arg = "this"
+		}
+		if arg != "this" && !identPattern.MatchString(arg) {
+			return token{}, templateError(line, "invalid variable name %q", arg)
+		}
+		return token{kind: kind, text: arg, line: line}, nil
+	case strings.HasPrefix(inner, ">"):
+		ref := strings.TrimSpace(inner[1:])
+		if !strings.HasPrefix(ref, "template:") {
+			return token{}, templateError(line, "partial must be written as {{> template:<id or slug>}}")
+		}
+		ref = strings.TrimPrefix(ref, "template:")
+		if !partialRefPattern.MatchString(ref) {
+			return token{}, templateError(line, "invalid partial reference %q", ref)
+		}
+		return token{kind: tokPartial, text: ref, line: line}, nil
+	case strings.HasPrefix(inner, "/"):
+		name := strings.TrimSpace(inner[1:])
+		if name != "if" && name != "unless" && name != "each" {
+			return token{}, templateError(line, "unknown closing tag {{/%s}}", name)
+		}
+		return token{kind: tokClose, text: name, line: line}, nil
+	case identPattern.MatchString(inner):
+		return token{kind: tokVariable, text: inner, line: line}, nil
+	case !strings.ContainsAny(inner, " \t\r\n{}"):
+		// 兼容旧行为：{{中文}} 等非变量名的占位符按字面量输出
+		return token{kind: tokLiteral, text: inner, line: line}, nil
+	}
+	return token{}, templateError(line, "unsupported tag {{%s}}", inner)
+}
+
+// parseFilteredTag 解析带过滤器的输出标签，如 {{name | upper}}
+func parseFilteredTag(segments []string, line int) (token, error) {
+	tok, err := parseTag(segments[0], line)
+	if err != nil {
+		return token{}, err
+	}
+	if tok.kind != tokVariable && tok.kind != tokThis && tok.kind != tokIndex {
+		return token{}, templateError(line, "filters can only be applied to variables")
+	}
+	for _, segment := range segments[1:] {
+		filter, err := parseFilter(segment, line)
+		if err != nil {
+			return token{}, err
+		}
+		tok.filters = append(tok.filters, filter)
+	}
+	return tok, nil
+}
+
+// stripStandaloneLines 块标签单独占一行时，去掉该行的缩进和换行，避免在输出中留下空行
+func stripStandaloneLines(tokens []token) {
+	type cut struct{ head, tail bool }
+	cuts := make([]cut, len(tokens))
+
+	for i, t := range tokens {
+		if !t.isBlock() {
+			continue
+		}
+		prevOK := i == 0
+		if !prevOK && tokens[i-1].kind == tokText {
+			text := tokens[i-1].text
+			lastLine := text[strings.LastIndex(text, "\n")+1:]
+			prevOK = isBlank(lastLine) && (strings.Contains(text, "\n") || i-1 == 0)
+		}
+		nextOK := i == len(tokens)-1
+		if !nextOK && tokens[i+1].kind == tokText {
+			text := tokens[i+1].text
+			firstLine := text
+			if idx := strings.Index(text, "\n"); idx >= 0 {
+				firstLine = text[:idx]
+			}
+			nextOK = isBlank(firstLine) && (strings.Contains(text, "\n") || i+1 == len(tokens)-1)
+		}
+		if prevOK && nextOK {
+			if i > 0 {
+				cuts[i-1].tail = true
+			}
+			if i < len(tokens)-1 {
+				cuts[i+1].head = true
+			}
+		}
+	}
+
+	for i := range tokens {
+		if tokens[i].kind != tokText || (!cuts[i].head && !cuts[i].tail) {
+			continue
+		}
+		text := tokens[i].text
+		start, end := 0, len(text)
+		if cuts[i].head {
+			if idx := strings.Index(text, "\n"); idx >= 0 {
+				start = idx + 1
+			} else {
+				start = len(text)
+			}
+		}
+		if cuts[i].tail {
+			end = strings.LastIndex(text, "\n") + 1
+		}
+		if start > end {
+			start = end
+		}
+		tokens[i].text = text[start:end]
+	}
+}
+
+// writeText 输出普通文本；包含花括号的文本作为字符串常量输出，避免与生成的动作拼接出新的分隔符
+func writeText(buf *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	if strings.ContainsAny(text, "{}") {
+		buf.WriteString("{{" + strconv.Quote(text) + "}}")
+		return
+	}
+	buf.WriteString(text)
+}
+
+func blockName(kind tokenKind) string {
+	switch kind {
+	case tokIf:
+		return "if"
+	case tokUnless:
+		return "unless"
+	case tokEach:
+		return "each"
+	}
+	return ""
+}
+
+func isBlank(s string) bool {
+	return strings.Trim(s, " \t\r") == ""
+}
+
+func templateError(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: line %d: %s", ErrInvalidTemplate, line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/models"
+)
+
+// renderString 编译并渲染模板，变量按未声明处理（与旧模板相同）
+func renderString(content string, values map[string]string, declared ...models.TemplateVariable) (string, error) {
+	compiled, err := compileTemplate(content, nil)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := resolveVariables(declared, compiled, values, false)
+	if err != nil {
+		return "", err
+	}
+	parts, err := compiled.renderParts(buildRenderData(resolved, declared, compiled))
+	if err != nil {
+		return "", err
+	}
+	return parts[0], nil
+}
+
+func TestTemplateEngineRender(t *testing.T) {
+	boolVar := models.TemplateVariable{Name: "flag", Type: models.VariableTypeBoolean}
+
+	tests := []struct {
+		name     string
+		content  string
+		values   map[string]string
+		declared []models.TemplateVariable
+		want     string
+	}{
+		{"variable", "Hello {{name}}!", map[string]string{"name": "world"}, nil, "Hello world!"},
+		{"literal placeholder", "{{中文}}", nil, nil, "中文"},
+		{"dot field is literal text", "{{.Secret}}", map[string]string{"Secret": "s"}, nil, ".Secret"},
+		{"braces in text", "json: {\"a\": 1} {{name}}", map[string]string{"name": "x"}, nil, "json: {\"a\": 1} x"},
+
+		{"if true", "{{#if flag}}yes{{/if}}", map[string]string{"flag": "on"}, nil, "yes"},
+		{"if empty", "{{#if flag}}yes{{/if}}", map[string]string{"flag": ""}, nil, ""},
+		{"if missing", "{{#if flag}}yes{{/if}}", nil, nil, ""},
+		{"if undeclared false", "{{#if flag}}yes{{/if}}", map[string]string{"flag": "false"}, nil, ""},
+		{"if undeclared FALSE", "{{#if flag}}yes{{/if}}", map[string]string{"flag": " FALSE "}, nil, ""},
+		{"if undeclared zero", "{{#if flag}}yes{{/if}}", map[string]string{"flag": "0"}, nil, ""},
+		{"if undeclared true", "{{#if flag}}yes{{/if}}", map[string]string{"flag": "true"}, nil, "yes"},
+		{"if declared false", "{{#if flag}}yes{{/if}}", map[string]string{"flag": "false"}, []models.TemplateVariable{boolVar}, ""},
+		{"if declared true", "{{#if flag}}yes{{/if}}", map[string]string{"flag": "true"}, []models.TemplateVariable{boolVar}, "yes"},
+		{"if else", "{{#if flag}}yes{{else}}no{{/if}}", map[string]string{"flag": "false"}, nil, "no"},
+		{"unless false", "{{#unless flag}}off{{/unless}}", map[string]string{"flag": "false"}, nil, "off"},
+		{"unless true", "{{#unless flag}}off{{/unless}}", map[string]string{"flag": "yes"}, nil, ""},
+		{"unless else", "{{#unless flag}}off{{else}}on{{/unless}}", map[string]string{"flag": "1"}, nil, "on"},
+
+		{"each", "{{#each items}}[{{@index}}:{{this}}]{{/each}}", map[string]string{"items": `["a", "b"]`}, nil, "[0:a][1:b]"},
+		{"each lines", "{{#each items}}{{this}};{{/each}}", map[string]string{"items": "x\ny"}, nil, "x;y;"},
+		{"each else", "{{#each items}}{{this}}{{else}}none{{/each}}", map[string]string{"items": ""}, nil, "none"},
+		{"each outer variable", "{{#each items}}{{prefix}}{{this}} {{/each}}", map[string]string{"items": "a\nb", "prefix": "-"}, nil, "-a -b "},
+		{"nested each index", "{{#each rows}}{{#each cols}}{{@index}}{{/each}}|{{/each}}", map[string]string{"rows": "r1\nr2", "cols": "a\nb"}, nil, "01|01|"},
+		{"if this in each", "{{#each items}}{{#if this}}{{this}},{{/if}}{{/each}}", map[string]string{"items": `["a", "0", "b"]`}, nil, "a,b,"},
+		{"filters", "{{name | trim | upper}}", map[string]string{"name": "  ab "}, nil, "AB"},
+
+		{"standalone if lines", "a\n{{#if flag}}\nb\n{{/if}}\nc", map[string]string{"flag": "1"}, nil, "a\nb\nc"},
+		{"standalone false block", "a\n  {{#if flag}}\nb\n  {{/if}}\nc", map[string]string{"flag": "false"}, nil, "a\nc"},
+		{"standalone each lines", "list:\n{{#each items}}\n- {{this}}\n{{/each}}\nend", map[string]string{"items": "x\ny"}, nil, "list:\n- x\n- y\nend"},
+		{"standalone else line", "{{#if flag}}\nyes\n{{else}}\nno\n{{/if}}\n", map[string]string{"flag": ""}, nil, "no\n"},
+		{"inline block keeps line", "a {{#if flag}}b{{/if}}\nc", map[string]string{"flag": "1"}, nil, "a b\nc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderString(tt.content, tt.values, tt.declared...)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateEngineRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errPart string
+	}{
+		{"printf", `{{printf "%s" name}}`, "unsupported tag"},
+		{"printf filter", `{{name | printf "%s"}}`, "unknown filter"},
+		{"internal truthy helper", `{{name | truthy}}`, "unknown filter"},
+		{"call", `{{call .fn}}`, "unsupported tag"},
+		{"index", `{{index .items 0}}`, "unsupported tag"},
+		{"define", `{{define "x"}}y{{end}}`, "unsupported tag"},
+		{"template", `{{template "part0"}}`, "unsupported tag"},
+		{"range action", `{{range .items}}{{end}}`, "unsupported tag"},
+		{"comment action", `{{/* hi */}}`, "unknown closing tag"},
+		{"unclosed tag", `{{name`, "unclosed tag"},
+		{"unclosed block", "{{#if a}}\nx", "{{#if}} is not closed"},
+		{"mismatched close", "{{#if a}}x{{/each}}", "does not match"},
+		{"stray else", "{{else}}", "outside of a block"},
+		{"duplicate else", "{{#if a}}x{{else}}y{{else}}z{{/if}}", "duplicate {{else}}"},
+		{"this outside each", "{{this}}", "inside {{#each}}"},
+		{"index outside each", "{{@index}}", "inside {{#each}}"},
+		{"unknown block", "{{#with a}}x{{/with}}", "unknown block"},
+		{"partial without scope", "{{> template:other}}", "partials are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileTemplate(tt.content, nil)
+			if !errors.Is(err, ErrInvalidTemplate) {
+				t.Fatalf("err = %v, want ErrInvalidTemplate", err)
+			}
+			if !strings.Contains(err.Error(), tt.errPart) {
+				t.Errorf("err = %q, want it to contain %q", err, tt.errPart)
+			}
+		})
+	}
+}
+
+func TestTemplateEngineVariables(t *testing.T) {
+	compiled, err := compileTemplate("{{a}} {{#if b}}{{c}}{{/if}} {{#each d}}{{this}}{{/each}} {{e | default \"x\"}} {{a}}", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(compiled.variables, ","); got != "a,b,c,d,e" {
+		t.Errorf("variables = %s", got)
+	}
+	if !compiled.outputs["a"] || compiled.outputs["c"] || compiled.outputs["e"] {
+		t.Errorf("outputs = %v, want only a", compiled.outputs)
+	}
+	if !compiled.lists["d"] {
+		t.Errorf("lists = %v, want d", compiled.lists)
+	}
+
+	// 块外直接输出的未声明变量为必填
+	if _, err := renderString("{{a}}", nil); err == nil {
+		t.Error("missing output variable accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+// maxIndentWidth indent 过滤器允许的最大缩进
+const maxIndentWidth = 64
+
+type filterArgKind int
+
+const (
+	// filterArgInt 非负整数
+	filterArgInt filterArgKind = iota
+	// filterArgString 双引号字符串
+	filterArgString
+)
+
+// filterSpec 过滤器定义。模板中只能使用此处列出的过滤器，
+// text/template 的内置函数（printf、call、index 等）不会暴露给模板作者。
+type filterSpec struct {
+	args []filterArgKind
+	// fn 接收 args 对应的参数，最后一个参数为管道传入的值
+	fn interface{}
+}
+
+var templateFilters = map[string]filterSpec{
+	"upper":      {fn: func(v interface{}) string { return strings.ToUpper(filterString(v)) }},
+	"lower":      {fn: func(v interface{}) string { return strings.ToLower(filterString(v)) }},
+	"trim":       {fn: func(v interface{}) string { return strings.TrimSpace(filterString(v)) }},
+	"indent":     {args: []filterArgKind{filterArgInt}, fn: filterIndent},
+	"truncate":   {args: []filterArgKind{filterArgInt}, fn: filterTruncate},
+	"join":       {args: []filterArgKind{filterArgString}, fn: filterJoin},
+	"jsonpretty": {fn: filterJSONPretty},
+	"default":    {args: []filterArgKind{filterArgString}, fn: filterDefault},
+}
+
+// filterFuncs 渲染时注册的函数表。truthy 和 text 只在生成的条件和输出中使用，不能作为过滤器调用
+var filterFuncs = func() template.FuncMap {
+	funcs := make(template.FuncMap, len(templateFilters)+2)
+	for name, spec := range templateFilters {
+		funcs[name] = spec.fn
+	}
+	funcs["truthy"] = truthy
+	funcs["text"] = filterString
+	return funcs
+}()
+
+// truthy {{#if}}/{{#unless}} 的真假规则，对所有变量一致（无论是否声明为布尔类型）：
+// 空字符串、"false"（不区分大小写）、"0" 和空列表为假
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		return s != "" && s != "0" && !strings.EqualFold(s, "false")
+	case []string:
+		return len(v) > 0
+	}
+	return true
+}
+
+// filterCall 模板中的一次过滤器调用
+type filterCall struct {
+	name string
+	// args 为参数的 text/template 字面量
+	args []string
+}
+
+// parseFilter 解析形如 `truncate 500` 或 `join ", "` 的过滤器调用
+func parseFilter(segment string, line int) (filterCall, error) {
+	words, err := splitFilterWords(segment)
+	if err != nil {
+		return filterCall{}, templateError(line, "%v", err)
+	}
+	if len(words) == 0 {
+		return filterCall{}, templateError(line, "empty filter")
+	}
+
+	name := words[0]
+	spec, ok := templateFilters[name]
+	if !ok {
+		return filterCall{}, templateError(line, "unknown filter %q", name)
+	}
+	if len(words)-1 != len(spec.args) {
+		return filterCall{}, templateError(line, "filter %s expects %d argument(s), got %d", name, len(spec.args), len(words)-1)
+	}
+
+	call := filterCall{name: name}
+	for i, kind := range spec.args {
+		word := words[i+1]
+		switch kind {
+		case filterArgInt:
+			n, err := strconv.Atoi(word)
+			if err != nil || n < 0 {
+				return filterCall{}, templateError(line, "filter %s expects a non-negative integer, got %s", name, word)
+			}
+			call.args = append(call.args, strconv.Itoa(n))
+		case filterArgString:
+			if !strings.HasPrefix(word, `"`) {
+				return filterCall{}, templateError(line, "filter %s expects a quoted string, got %s", name, word)
+			}
+			s, err := strconv.Unquote(word)
+			if err != nil {
+				return filterCall{}, templateError(line, "invalid string %s", word)
+			}
+			call.args = append(call.args, strconv.Quote(s))
+		}
+	}
+	return call, nil
+}
+
+// splitPipeline 按不在引号内的 | 切分标签内容
+func splitPipeline(inner string) []string {
+	var segments []string
+	start, inQuote := 0, false
+	for i := 0; i < len(inner); i++ {
+		switch c := inner[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '"':
+			inQuote = !inQuote
+		case c == '|' && !inQuote:
+			segments = append(segments, strings.TrimSpace(inner[start:i]))
+			start = i + 1
+		}
+	}
+	return append(segments, strings.TrimSpace(inner[start:]))
+}
+
+// splitFilterWords 按空白切分过滤器名称和参数，双引号字符串作为一个整体
+func splitFilterWords(segment string) ([]string, error) {
+	var words []string
+	i := 0
+	for i < len(segment) {
+		if segment[i] == ' ' || segment[i] == '\t' {
+			i++
+			continue
+		}
+		start := i
+		if segment[i] == '"' {
+			i++
+			for i < len(segment) && segment[i] != '"' {
+				if segment[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(segment) {
+				return nil, fmt.Errorf("unterminated string in filter %q", segment)
+			}
+			i++
+		} else {
+			for i < len(segment) && segment[i] != ' ' && segment[i] != '\t' {
+				i++
+			}
+		}
+		words = append(words, segment[start:i])
+	}
+	return words, nil
+}
+
+// filterString 将管道中的值转换为字符串，列表按行拼接
+func filterString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return value
+	case []string:
+		return strings.Join(value, "\n")
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func filterIndent(width int, v interface{}) string {
+	if width > maxIndentWidth {
+		width = maxIndentWidth
+	}
+	prefix := strings.Repeat(" ", width)
+	lines := strings.Split(filterString(v), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// filterTruncate 按字符数截断
+func filterTruncate(length int, v interface{}) string {
+	s := filterString(v)
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	return string([]rune(s)[:length])
+}
+
+func filterJoin(sep string, v interface{}) string {
+	if items, ok := v.([]string); ok {
+		return strings.Join(items, sep)
+	}
+	return filterString(v)
+}
+
+// filterJSONPretty 格式化 JSON，取值不是合法 JSON 时原样输出
+func filterJSONPretty(v interface{}) string {
+	s := filterString(v)
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(strings.TrimSpace(s)), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// filterDefault 取值为空（空字符串或空列表）时使用默认值
+func filterDefault(def string, v interface{}) string {
+	if s := filterString(v); s != "" {
+		return s
+	}
+	return def
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/models"
+)
+
+func TestTemplateFilters(t *testing.T) {
+	list := models.TemplateVariable{Name: "items", Type: models.VariableTypeArray}
+
+	tests := []struct {
+		name     string
+		content  string
+		values   map[string]string
+		declared []models.TemplateVariable
+		want     string
+	}{
+		{"upper", "{{v | upper}}", map[string]string{"v": "abc é"}, nil, "ABC É"},
+		{"lower", "{{v | lower}}", map[string]string{"v": "ABC"}, nil, "abc"},
+		{"trim", "[{{v | trim}}]", map[string]string{"v": "\t a b \n"}, nil, "[a b]"},
+		{"chain runs left to right", "{{v | trim | truncate 3 | upper}}", map[string]string{"v": "  abcdef"}, nil, "ABC"},
+		{"spaces around pipes", "{{ v|upper  |  lower }}", map[string]string{"v": "Ab"}, nil, "ab"},
+
+		{"indent", "{{v | indent 2}}", map[string]string{"v": "a\n\nb"}, nil, "  a\n\n  b"},
+		{"indent zero", "{{v | indent 0}}", map[string]string{"v": "a"}, nil, "a"},
+		{"indent capped", "{{v | indent 100}}", map[string]string{"v": "a"}, nil, strings.Repeat(" ", maxIndentWidth) + "a"},
+
+		{"truncate counts runes", "{{v | truncate 2}}", map[string]string{"v": "中文字"}, nil, "中文"},
+		{"truncate shorter value", "{{v | truncate 10}}", map[string]string{"v": "abc"}, nil, "abc"},
+		{"truncate zero", "[{{v | truncate 0}}]", map[string]string{"v": "abc"}, nil, "[]"},
+
+		{"join list", `{{items | join ", "}}`, map[string]string{"items": `["a", "b"]`}, []models.TemplateVariable{list}, "a, b"},
+		{"join escapes", `{{items | join "\n- "}}`, map[string]string{"items": "a\nb"}, []models.TemplateVariable{list}, "a\n- b"},
+		{"join pipe in separator", `{{items | join " | "}}`, map[string]string{"items": "a\nb"}, []models.TemplateVariable{list}, "a | b"},
+		{"join undeclared variable", `{{v | join ", "}}`, map[string]string{"v": "a\nb"}, nil, "a, b"},
+		{"list without filter", "{{items}}", map[string]string{"items": `["a", "b"]`}, []models.TemplateVariable{list}, "a\nb"},
+		{"each list without filter", "{{#each items}}{{this}},{{/each}} {{items}}", map[string]string{"items": "a\nb"}, nil, "a,b, a\nb"},
+		{"upper list", "{{items | upper}}", map[string]string{"items": "a\nb"}, []models.TemplateVariable{list}, "A\nB"},
+
+		{"jsonpretty", "{{v | jsonpretty}}", map[string]string{"v": ` {"a":[1,2]} `}, nil, "{\n  \"a\": [\n    1,\n    2\n  ]\n}"},
+		{"jsonpretty invalid", "{{v | jsonpretty}}", map[string]string{"v": "{not json"}, nil, "{not json"},
+
+		{"default used", `{{v | default "none"}}`, map[string]string{"v": ""}, nil, "none"},
+		{"default missing", `{{v | default "none"}}`, nil, nil, "none"},
+		{"default kept", `{{v | default "none"}}`, map[string]string{"v": "x"}, nil, "x"},
+		{"default empty list", `{{items | default "none"}}`, map[string]string{"items": "[]"}, []models.TemplateVariable{list}, "none"},
+		{"default before upper", `{{v | default "none" | upper}}`, nil, nil, "NONE"},
+		{"default whitespace kept", `[{{v | default "none"}}]`, map[string]string{"v": " "}, nil, "[ ]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderString(tt.content, tt.values, tt.declared...)
+			if err != nil {
+				t.Fatalf("render: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateFiltersReject(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		errPart string
+	}{
+		{"unknown", "{{v | reverse}}", `unknown filter "reverse"`},
+		{"internal text helper", "{{v | text}}", `unknown filter "text"`},
+		{"empty", "{{v | }}", "empty filter"},
+		{"missing argument", "{{v | truncate}}", "expects 1 argument(s), got 0"},
+		{"extra argument", "{{v | upper 1}}", "expects 0 argument(s), got 1"},
+		{"negative integer", "{{v | indent -1}}", "non-negative integer"},
+		{"integer as string", `{{v | truncate "3"}}`, "non-negative integer"},
+		{"unquoted string", "{{v | join ,}}", "quoted string"},
+		{"unterminated string", `{{v | default "x}}`, "unterminated string"},
+		{"invalid escape", `{{v | default "\q"}}`, "invalid string"},
+		{"reports line", "a\n{{v | nope}}", "line 2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compileTemplate(tt.content, nil)
+			if !errors.Is(err, ErrInvalidTemplate) {
+				t.Fatalf("err = %v, want ErrInvalidTemplate", err)
+			}
+			if !strings.Contains(err.Error(), tt.errPart) {
+				t.Errorf("err = %q, want it to contain %q", err, tt.errPart)
+			}
+		})
+	}
+}
+
+func TestSplitPipeline(t *testing.T) {
+	tests := []struct {
+		inner string
+		want  []string
+	}{
+		{"v", []string{"v"}},
+		{" v | upper ", []string{"v", "upper"}},
+		{`v | join " | " | trim`, []string{"v", `join " | "`, "trim"}},
+		{`v | default "a\"|b"`, []string{"v", `default "a\"|b"`}},
+	}
+	for _, tt := range tests {
+		got := splitPipeline(tt.inner)
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+			t.Errorf("splitPipeline(%q) = %q, want %q", tt.inner, got, tt.want)
+		}
+	}
+}
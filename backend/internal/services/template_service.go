@@ -1,105 +1,187 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
+	"prompt-backend/internal/auth"
 	"prompt-backend/internal/models"
 	"prompt-backend/internal/services/repository"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("template not found")
+	ErrForbidden        = errors.New("permission denied")
+	ErrSlugTaken        = errors.New("slug already in use")
 )
 
 // TemplateService 模板服务
 type TemplateService struct {
-	repo repository.TemplateRepository
+	repo  repository.TemplateRepository
+	runs  repository.GenerationRunRepository
+	stats repository.UsageStatsRepository
+	usage *UsageRecorder
+	// runQueue、statsQueue 生成记录和使用统计的写入队列，随 usage 一起刷新；
+	// 对应的仓库或 usage 为 nil 时不保存
+	runQueue   *runQueue
+	statsQueue *usageStatsQueue
 }
 
 // NewTemplateService 创建模板服务
-func NewTemplateService(repo repository.TemplateRepository) *TemplateService {
-	return &TemplateService{repo: repo}
+func NewTemplateService(repo repository.TemplateRepository, runs repository.GenerationRunRepository, stats repository.UsageStatsRepository, usage *UsageRecorder) *TemplateService {
+	s := &TemplateService{repo: repo, runs: runs, stats: stats, usage: usage}
+	if runs != nil && usage != nil {
+		s.runQueue = newRunQueue(runs, usage)
+	}
+	if stats != nil && usage != nil {
+		s.statsQueue = newUsageStatsQueue(stats, usage)
+	}
+	return s
+}
+
+// GeneratePrompt 生成提示词，req.Version 不为空时使用指定历史版本的内容。
+// 声明了默认值的变量会自动补全，缺少必填变量时返回 models.VariableErrors。
+// 对话模板逐条渲染消息，同时返回消息列表和拼接后的文本。
+// 模板加载成功后，每次生成（包括失败）都会异步写入一条生成记录（/api/run 的记录只包含渲染结果）；
+// 批量生成和数据集只计入使用统计，不逐条保存生成记录。
+func (s *TemplateService) GeneratePrompt(req models.GenerateRequest, viewer *auth.Identity) (*models.GenerateResponse, error) {
+	start := time.Now()
+	prepared, err := s.prepareTemplate(req.TemplateID, req.Version, viewer)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := prepared.render(req.Variables, req.Strict)
+	runID := s.recordRun(prepared, req.Variables, viewer, resp, err, time.Since(start))
+	s.recordUsage(usageEvent(prepared, req.Variables, viewer, err))
+	if err != nil {
+		return nil, err
+	}
+	resp.RunID = runID
+
+	s.usage.Add(req.TemplateID, 1)
+
+	return resp, nil
 }
 
-// GeneratePrompt 生成提示词
-func (s *TemplateService) GeneratePrompt(templateID uuid.UUID, variables map[string]string) (string, error) {
-	// 获取模板
-	tmpl, err := s.repo.GetByID(templateID)
+// preparedTemplate 已加载并编译的模板，可使用不同的变量多次（并发）渲染
+type preparedTemplate struct {
+	source   *models.PromptTemplateVersion
+	compiled *compiledTemplate
+	// declared 为模板及其 partial 中声明的变量
+	declared []models.TemplateVariable
+	// redactRuns 生成记录中是否隐去变量值和输出
+	redactRuns bool
+}
+
+// prepareTemplate 加载模板（或其指定版本）并编译
+func (s *TemplateService) prepareTemplate(templateID uuid.UUID, version *int, viewer *auth.Identity) (*preparedTemplate, error) {
+	tmpl, err := s.GetTemplate(templateID, viewer)
 	if err != nil {
-		// 明确返回未找到的友好错误，便于 handler 返回 404 而不是 500
-		if strings.Contains(strings.ToLower(err.Error()), "record not found") {
-			return "", fmt.Errorf("template not found")
+		return nil, err
+	}
+	source := snapshotOf(tmpl)
+	if version != nil && *version != tmpl.Version {
+		source, err = s.getVersion(templateID, *version)
+		if err != nil {
+			return nil, err
 		}
-		return "", err
 	}
 
-	// 解析模板
-	normalizedContent := normalizeTemplateContent(tmpl.Content)
-	// 简单检查模板占位符对是否匹配，避免 text/template 解析时出现未捕获的错误
-	if strings.Count(normalizedContent, "{{") != strings.Count(normalizedContent, "}}") {
-		return "", fmt.Errorf("invalid template content: unbalanced braces")
+	compiled, err := compileBody(source.Kind, source.Content, source.Messages, s.partialScope(viewer, tmpl.ID, tmpl.IsPublic))
+	if err != nil {
+		return nil, err
+	}
+
+	// partial 中声明的变量一并生效
+	declared, err := parseVariables(source.Variables)
+	if err != nil {
+		return nil, err
 	}
-	t, err := template.New(tmpl.Name).Parse(normalizedContent)
+	declared, err = mergePartialVariables(declared, compiled)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	return &preparedTemplate{source: source, compiled: compiled, declared: declared, redactRuns: tmpl.RedactRuns}, nil
+}
 
-	// 执行模板替换
-	var buf bytes.Buffer
-	if err := t.Execute(&buf, variables); err != nil {
-		return "", err
+// render 补全默认值、校验变量并渲染模板
+func (p *preparedTemplate) render(provided map[string]string, strict bool) (*models.GenerateResponse, error) {
+	variables, err := resolveVariables(p.declared, p.compiled, provided, strict)
+	if err != nil {
+		return nil, err
 	}
 
-	// 异步更新使用次数
-	go func() {
-		if err := s.repo.IncrementUsage(templateID); err != nil {
-			// 记录错误但不影响主流程
-			// 在实际项目中应该使用日志库
+	parts, err := p.compiled.renderParts(buildRenderData(variables, p.declared, p.compiled))
+	if err != nil {
+		return nil, err
+	}
+	resp := &models.GenerateResponse{Prompt: parts[0]}
+	if p.source.Kind == models.TemplateKindChat {
+		resp.Messages = make(models.ChatMessages, len(p.source.Messages))
+		for i, message := range p.source.Messages {
+			resp.Messages[i] = models.ChatMessage{Role: message.Role, Content: parts[i]}
 		}
-	}()
-
-	return buf.String(), nil
+		resp.Prompt = resp.Messages.Flatten()
+	}
+	resp.Result = resp.Prompt
+	return resp, nil
 }
 
-func normalizeTemplateContent(content string) string {
-	// 匹配 {{...}} 内的内容（尽量宽松），然后根据内容是否为合法 ASCII 变量名分别处理：
-	// - 若为 ASCII 变量名：转换为 {{.name}} 来从传入 map 中读取值
-	// - 若包含非 ASCII 字符（比如中文）：将其作为字面量文本输出，使用 printf 转义以保证模板解析安全
-	re := regexp.MustCompile(`\{\{\s*([^\}\s]+)\s*\}\}`)
-	asciiIdent := regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
-
-	return re.ReplaceAllStringFunc(content, func(m string) string {
-		sub := re.FindStringSubmatch(m)
-		if len(sub) < 2 {
-			return m
-		}
-		name := sub[1]
-		if asciiIdent.MatchString(name) {
-			return "{{." + name + "}}"
-		}
-		// 对非 ASCII 内容，作为字面量返回（安全地加引号）
-		return fmt.Sprintf("{{printf %s}}", strconv.Quote(name))
-	})
+// compileBody 按模板类型编译模板内容，对话模板的每条消息编译为独立的一段
+func compileBody(kind, content string, messages models.ChatMessages, scope *partialScope) (*compiledTemplate, error) {
+	if kind != models.TemplateKindChat {
+		return compileTemplate(content, scope)
+	}
+	contents := make([]string, len(messages))
+	for i, message := range messages {
+		contents[i] = message.Content
+	}
+	return compileParts(contents, scope)
 }
 
 // CreateTemplate 创建模板
-func (s *TemplateService) CreateTemplate(req models.CreateTemplateRequest, userID uuid.UUID) (*models.PromptTemplate, error) {
+func (s *TemplateService) CreateTemplate(req models.CreateTemplateRequest, creator *auth.Identity) (*models.PromptTemplate, error) {
+	kind := req.Kind
+	if kind == "" {
+		kind = models.TemplateKindText
+	}
+	content, messages := req.Content, req.Messages
+	if kind == models.TemplateKindChat {
+		content = messages.Flatten()
+	} else {
+		messages = nil
+	}
+	if _, err := compileBody(kind, content, messages, s.partialScope(creator, uuid.Nil, req.IsPublic)); err != nil {
+		return nil, err
+	}
+
 	template := &models.PromptTemplate{
 		ID:          uuid.New(),
-		UserID:      userID,
+		UserID:      creator.UserID,
 		Name:        req.Name,
 		Description: req.Description,
-		Content:     req.Content,
+		Content:     content,
+		Kind:        kind,
+		Messages:    messages,
 		Category:    req.Category,
 		IsPublic:    req.IsPublic,
+		RedactRuns:  req.RedactRuns,
+		Tags:        req.Tags,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
+	if req.Slug != "" {
+		template.Slug = &req.Slug
+	}
+	if template.Tags == nil {
+		template.Tags = []string{}
+	}
 
 	// 将变量列表转换为 JSONB
 	variablesData, err := s.marshalVariables(req.Variables)
@@ -109,39 +191,81 @@ func (s *TemplateService) CreateTemplate(req models.CreateTemplateRequest, userI
 	template.Variables = variablesData
 
 	if err := s.repo.Create(template); err != nil {
+		if isDuplicateKey(err) {
+			return nil, ErrSlugTaken
+		}
 		return nil, err
 	}
 
 	return template, nil
 }
 
-// GetTemplate 获取模板
-func (s *TemplateService) GetTemplate(id uuid.UUID) (*models.PromptTemplate, error) {
-	return s.repo.GetByID(id)
+// GetTemplate 获取模板，私有模板仅对所有者和管理员可见
+func (s *TemplateService) GetTemplate(id uuid.UUID, viewer *auth.Identity) (*models.PromptTemplate, error) {
+	tmpl, err := s.getTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canView(tmpl, viewer) {
+		// 不暴露私有模板是否存在
+		return nil, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+// GetTemplates 获取对调用方可见的模板列表（公开模板及本人的私有模板，管理员可见全部）。
+// cursor 不为空时从游标处翻页，忽略 page。
+func (s *TemplateService) GetTemplates(filter models.TemplateFilter, page, pageSize int, sort models.TemplateSort, cursor *models.TemplateCursor, viewer *auth.Identity) (*models.TemplatePage, error) {
+	req := pageRequest(page, pageSize, sort, cursor)
+	if viewer.IsAdmin() {
+		return s.repo.GetAll(filter, req)
+	}
+	viewerID := uuid.Nil
+	if viewer != nil {
+		viewerID = viewer.UserID
+	}
+	return s.repo.GetVisible(viewerID, filter, req)
 }
 
-// GetTemplates 获取模板列表
-func (s *TemplateService) GetTemplates(category string, page, pageSize int) ([]models.PromptTemplate, error) {
-	limit := pageSize
-	offset := (page - 1) * pageSize
-	return s.repo.GetAll(category, limit, offset)
+// GetUserTemplates 获取用户自己的模板（包含私有模板）
+func (s *TemplateService) GetUserTemplates(userID uuid.UUID, filter models.TemplateFilter, page, pageSize int, sort models.TemplateSort, cursor *models.TemplateCursor) (*models.TemplatePage, error) {
+	return s.repo.GetByUserID(userID, filter, pageRequest(page, pageSize, sort, cursor))
 }
 
 // GetPublicTemplates 获取公开模板
-func (s *TemplateService) GetPublicTemplates(category string, page, pageSize int) ([]models.PromptTemplate, error) {
-	limit := pageSize
-	offset := (page - 1) * pageSize
-	return s.repo.GetPublicTemplates(category, limit, offset)
+func (s *TemplateService) GetPublicTemplates(filter models.TemplateFilter, page, pageSize int, sort models.TemplateSort, cursor *models.TemplateCursor) (*models.TemplatePage, error) {
+	return s.repo.GetPublicTemplates(filter, pageRequest(page, pageSize, sort, cursor))
 }
 
-// UpdateTemplate 更新模板
-func (s *TemplateService) UpdateTemplate(id uuid.UUID, req models.UpdateTemplateRequest) (*models.PromptTemplate, error) {
-	tmpl, err := s.repo.GetByID(id)
+func pageRequest(page, pageSize int, sort models.TemplateSort, cursor *models.TemplateCursor) models.PageRequest {
+	return models.PageRequest{Limit: pageSize, Offset: (page - 1) * pageSize, Sort: sort, Cursor: cursor}
+}
+
+// UpdateTemplate 更新模板，仅模板所有者或管理员可操作
+func (s *TemplateService) UpdateTemplate(id uuid.UUID, req models.UpdateTemplateRequest, caller *auth.Identity) (*models.PromptTemplate, error) {
+	tmpl, err := s.getTemplate(id)
 	if err != nil {
 		return nil, err
 	}
+	if !canModify(tmpl, caller) {
+		return nil, ErrForbidden
+	}
+
+	if err := s.applyUpdate(tmpl, req, caller); err != nil {
+		return nil, err
+	}
+	if err := s.saveTemplate(tmpl, caller); err != nil {
+		if isDuplicateKey(err) {
+			return nil, ErrSlugTaken
+		}
+		return nil, err
+	}
+
+	return tmpl, nil
+}
 
-	// 更新字段
+// applyUpdate 将更新请求中非空的字段写入模板（不落库）
+func (s *TemplateService) applyUpdate(tmpl *models.PromptTemplate, req models.UpdateTemplateRequest, caller *auth.Identity) error {
 	if req.Name != nil {
 		tmpl.Name = *req.Name
 	}
@@ -151,50 +275,139 @@ func (s *TemplateService) UpdateTemplate(id uuid.UUID, req models.UpdateTemplate
 	if req.Content != nil {
 		tmpl.Content = *req.Content
 	}
-	if req.Category != nil {
-		tmpl.Category = *req.Category
+	if req.Kind != nil {
+		tmpl.Kind = *req.Kind
+	}
+	if req.Messages != nil {
+		tmpl.Messages = req.Messages
+	}
+	if tmpl.EffectiveKind() == models.TemplateKindChat {
+		if len(tmpl.Messages) == 0 {
+			return fmt.Errorf("%w: chat templates require at least one message", ErrInvalidTemplate)
+		}
+		tmpl.Content = tmpl.Messages.Flatten()
+	} else {
+		if len(req.Messages) > 0 {
+			return fmt.Errorf("%w: messages are only allowed for chat templates", ErrInvalidTemplate)
+		}
+		tmpl.Messages = nil
 	}
 	if req.IsPublic != nil {
 		tmpl.IsPublic = *req.IsPublic
 	}
+	// 公开模板只能包含公开的 partial，公开已有模板时同样需要检查
+	if req.Content != nil || req.Kind != nil || req.Messages != nil || req.IsPublic != nil {
+		if _, err := compileBody(tmpl.EffectiveKind(), tmpl.Content, tmpl.Messages, s.partialScope(caller, tmpl.ID, tmpl.IsPublic)); err != nil {
+			return err
+		}
+	}
+	if req.Category != nil {
+		tmpl.Category = *req.Category
+	}
+	if req.RedactRuns != nil {
+		tmpl.RedactRuns = *req.RedactRuns
+	}
+	if req.Tags != nil {
+		tmpl.Tags = req.Tags
+	}
+	if req.Slug != nil {
+		if *req.Slug == "" {
+			tmpl.Slug = nil
+		} else {
+			slug := *req.Slug
+			tmpl.Slug = &slug
+		}
+	}
 	if req.Variables != nil {
 		variablesData, err := s.marshalVariables(req.Variables)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		tmpl.Variables = variablesData
 	}
+	return nil
+}
+
+// saveTemplate 保存模板修改并生成新版本，调用方需已通过 canModify 校验
+func (s *TemplateService) saveTemplate(tmpl *models.PromptTemplate, caller *auth.Identity) error {
 	tmpl.UpdatedAt = time.Now()
 
-	if err := s.repo.Update(tmpl); err != nil {
-		return nil, err
+	var err error
+	if caller.IsAdmin() {
+		err = s.repo.Update(tmpl, caller.UserID)
+	} else {
+		// 归属校验与写入在同一条语句中完成，避免检查与更新之间的竞态
+		err = s.repo.UpdateByOwner(tmpl, caller.UserID)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrTemplateNotFound
 	}
+	return err
+}
 
+// DeleteTemplate 删除模板，仅模板所有者或管理员可操作
+func (s *TemplateService) DeleteTemplate(id uuid.UUID, caller *auth.Identity) error {
+	if caller == nil {
+		return ErrForbidden
+	}
+	if caller.IsAdmin() {
+		if _, err := s.getTemplate(id); err != nil {
+			return err
+		}
+		return s.repo.Delete(id)
+	}
+
+	err := s.repo.DeleteByOwner(id, caller.UserID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 区分模板不存在与无权删除
+		if _, getErr := s.getTemplate(id); getErr != nil {
+			return getErr
+		}
+		return ErrForbidden
+	}
+	return err
+}
+
+// getTemplate 获取模板，未找到时返回 ErrTemplateNotFound
+func (s *TemplateService) getTemplate(id uuid.UUID) (*models.PromptTemplate, error) {
+	tmpl, err := s.repo.GetByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, err
+	}
 	return tmpl, nil
 }
 
-// DeleteTemplate 删除模板
-func (s *TemplateService) DeleteTemplate(id uuid.UUID) error {
-	return s.repo.Delete(id)
+// canView 调用方是否可以查看和使用模板
+func canView(tmpl *models.PromptTemplate, viewer *auth.Identity) bool {
+	return tmpl.IsPublic || canModify(tmpl, viewer)
 }
 
-// ExtractVariables 从模板内容中提取变量
-func ExtractVariables(content string) []string {
-	// 使用正则表达式提取 {{variable}} 格式的变量
-	re := regexp.MustCompile(`\{\{(\w+)\}\}`)
-	matches := re.FindAllStringSubmatch(content, -1)
+// canModify 调用方是否可以修改或删除模板
+func canModify(tmpl *models.PromptTemplate, caller *auth.Identity) bool {
+	if caller == nil {
+		return false
+	}
+	return caller.IsAdmin() || tmpl.UserID == caller.UserID
+}
 
-	variables := make([]string, 0)
-	seen := make(map[string]bool)
+// isDuplicateKey 是否为唯一索引冲突
+func isDuplicateKey(err error) bool {
+	return errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(err.Error(), "duplicate key")
+}
 
-	for _, match := range matches {
-		if len(match) > 1 && !seen[match[1]] {
-			variables = append(variables, match[1])
-			seen[match[1]] = true
-		}
+// parseVariables 将 JSONB 中保存的变量列表解析为结构体
+func parseVariables(data models.JSONB) ([]models.TemplateVariable, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
 	}
-
-	return variables
+	var variables []models.TemplateVariable
+	if err := json.Unmarshal(data, &variables); err != nil {
+		return nil, fmt.Errorf("invalid template variables: %w", err)
+	}
+	return variables, nil
 }
 
 // marshalVariables 将变量列表转换为 JSONB
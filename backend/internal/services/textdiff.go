@@ -0,0 +1,257 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxDiffEdits 行级 diff 的最大编辑距离，超出后退化为整体替换。
+// 回溯需保存每一轮的 V 数组，内存随编辑距离平方增长（500 时约 2MB）
+const maxDiffEdits = 500
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type lineEdit struct {
+	op   diffOp
+	text string
+	// aIdx/bIdx 为该行之前已消费的 a/b 行数（即 0 基的位置）
+	aIdx int
+	bIdx int
+}
+
+// unifiedDiff 生成两段文本的行级统一 diff（unified format），内容相同时返回空字符串
+func unifiedDiff(fromLabel, toLabel, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	i := 0
+	for i < len(edits) {
+		for i < len(edits) && edits[i].op == diffEqual {
+			i++
+		}
+		if i >= len(edits) {
+			break
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		// 向后合并相距不超过 2*context 行的变更
+		end := i
+		for {
+			for end < len(edits) && edits[end].op != diffEqual {
+				end++
+			}
+			next := end
+			for next < len(edits) && edits[next].op == diffEqual {
+				next++
+			}
+			if next < len(edits) && next-end <= 2*context {
+				end = next
+				continue
+			}
+			end += context
+			if end > next {
+				end = next
+			}
+			break
+		}
+
+		writeHunk(&buf, edits[start:end])
+		i = end
+	}
+
+	return buf.String()
+}
+
+func writeHunk(buf *strings.Builder, hunk []lineEdit) {
+	aLen, bLen := 0, 0
+	for _, e := range hunk {
+		if e.op != diffInsert {
+			aLen++
+		}
+		if e.op != diffDelete {
+			bLen++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(hunk[0].aIdx, aLen), hunkRange(hunk[0].bIdx, bLen))
+
+	for _, e := range hunk {
+		switch e.op {
+		case diffEqual:
+			buf.WriteByte(' ')
+		case diffDelete:
+			buf.WriteByte('-')
+		case diffInsert:
+			buf.WriteByte('+')
+		}
+		buf.WriteString(e.text)
+		buf.WriteByte('\n')
+	}
+}
+
+// hunkRange 按 GNU diff 的约定输出区间：空区间使用前一行的行号
+func hunkRange(idx, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", idx)
+	case 1:
+		return fmt.Sprintf("%d", idx+1)
+	default:
+		return fmt.Sprintf("%d,%d", idx+1, length)
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines 使用 Myers 算法计算行级最短编辑脚本
+func diffLines(a, b []string) []lineEdit {
+	// 先去掉公共前缀和后缀，常见的局部修改只需在很小的区间内求解
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffEqual)
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, diffEqual)
+	}
+
+	edits := make([]lineEdit, 0, len(ops))
+	x, y := 0, 0
+	for _, op := range ops {
+		switch op {
+		case diffEqual:
+			edits = append(edits, lineEdit{op: op, text: a[x], aIdx: x, bIdx: y})
+			x++
+			y++
+		case diffDelete:
+			edits = append(edits, lineEdit{op: op, text: a[x], aIdx: x, bIdx: y})
+			x++
+		case diffInsert:
+			edits = append(edits, lineEdit{op: op, text: b[y], aIdx: x, bIdx: y})
+			y++
+		}
+	}
+	return edits
+}
+
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(n, m)
+	}
+
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	// trace[d] 保存第 d 轮开始前 v 在 [-d, d] 区间的值
+	trace := make([][]int, 0, 16)
+
+	for d := 0; d <= maxD; d++ {
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+
+	return replaceAll(n, m)
+}
+
+func backtrack(trace [][]int, n, m int) []diffOp {
+	ops := make([]diffOp, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffEqual)
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffInsert)
+				y--
+			} else {
+				ops = append(ops, diffDelete)
+				x--
+			}
+		}
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+func replaceAll(n, m int) []diffOp {
+	ops := make([]diffOp, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, diffDelete)
+	}
+	for i := 0; i < m; i++ {
+		ops = append(ops, diffInsert)
+	}
+	return ops
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"identical", "same\n", "same\n", ""},
+		{"empty to one line", "", "hello\n", "--- a\n+++ b\n@@ -0,0 +1 @@\n+hello\n"},
+		{"one line to empty", "hello\n", "", "--- a\n+++ b\n@@ -1 +0,0 @@\n-hello\n"},
+		{"replace single line", "a\nb\nc\n", "a\nB\nc\n", "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"insert in middle", "a\nc\n", "a\nb\nc\n", "--- a\n+++ b\n@@ -1,2 +1,3 @@\n a\n+b\n c\n"},
+		{"crlf normalized", "a\r\nb\r\n", "a\nb\nc\n", "--- a\n+++ b\n@@ -1,2 +1,3 @@\n a\n b\n+c\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("a", "b", tt.a, tt.b, 3); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffSeparateHunks(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 20; i++ {
+		a = append(a, fmt.Sprintf("line %d", i))
+		b = append(b, fmt.Sprintf("line %d", i))
+	}
+	b[1], b[18] = "changed 1", "changed 18"
+
+	got := unifiedDiff("a", "b", strings.Join(a, "\n"), strings.Join(b, "\n"), 3)
+	if n := strings.Count(got, "@@ -"); n != 2 {
+		t.Fatalf("got %d hunks, want 2:\n%s", n, got)
+	}
+	if !strings.Contains(got, "@@ -1,5 +1,5 @@\n") || !strings.Contains(got, "@@ -16,5 +16,5 @@\n") {
+		t.Errorf("unexpected hunk headers:\n%s", got)
+	}
+}
+
+// interleaved 返回 n 行原文，以及在每行后插入一行新内容的修改版本（编辑距离为 n）
+func interleaved(n int) ([]string, []string) {
+	var a, b []string
+	for i := 0; i < n; i++ {
+		a = append(a, fmt.Sprintf("keep %d", i))
+		b = append(b, fmt.Sprintf("keep %d", i), fmt.Sprintf("new %d", i))
+	}
+	return a, b
+}
+
+func countOps(edits []lineEdit) (equal, del, ins int) {
+	for _, e := range edits {
+		switch e.op {
+		case diffEqual:
+			equal++
+		case diffDelete:
+			del++
+		case diffInsert:
+			ins++
+		}
+	}
+	return
+}
+
+func TestDiffLinesEditCap(t *testing.T) {
+	// 编辑距离在上限内时得到最短编辑脚本
+	a, b := interleaved(maxDiffEdits)
+	equal, del, ins := countOps(diffLines(a, b))
+	if equal != maxDiffEdits || del != 0 || ins != maxDiffEdits {
+		t.Fatalf("within cap: equal=%d delete=%d insert=%d, want %d/0/%d", equal, del, ins, maxDiffEdits, maxDiffEdits)
+	}
+
+	// 超出上限时公共前缀以外的部分退化为整体替换
+	a, b = interleaved(maxDiffEdits + 1)
+	equal, del, ins = countOps(diffLines(a, b))
+	if equal != 1 || del != len(a)-1 || ins != len(b)-1 {
+		t.Fatalf("over cap: equal=%d delete=%d insert=%d, want 1/%d/%d", equal, del, ins, len(a)-1, len(b)-1)
+	}
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"prompt-backend/internal/services/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultUsageFlushInterval = 5 * time.Second
+	// usageFlushBatchSize 每条 UPDATE 语句最多包含的模板数
+	usageFlushBatchSize = 500
+	// usageFlushThreshold 待写入的模板数达到该值时立即刷新，不等待定时器
+	usageFlushThreshold = 1000
+)
+
+// UsageRecorderMetrics 使用次数记录器的运行指标
+type UsageRecorderMetrics struct {
+	PendingTemplates    int        `json:"pending_templates"`
+	PendingIncrements   int64      `json:"pending_increments"`
+	RecordedIncrements  int64      `json:"recorded_increments"`
+	FlushedIncrements   int64      `json:"flushed_increments"`
+	Flushes             int64      `json:"flushes"`
+	FailedFlushes       int64      `json:"failed_flushes"`
+	LastFlushAt         *time.Time `json:"last_flush_at,omitempty"`
+	LastFlushDurationMs int64      `json:"last_flush_duration_ms"`
+	// LastFlushFailed 最近一次刷新是否失败，错误详情只写入服务端日志
+	LastFlushFailed bool `json:"last_flush_failed"`
+	// Buffers 通过 register 注册的队列各自的指标，按注册名称索引
+	Buffers map[string]interface{} `json:"buffers,omitempty"`
+}
+
+// usageBuffer 随 UsageRecorder 一起刷新的其他写入队列（如生成记录、使用统计），通过 register 注册。
+// 队列自行加锁；写入失败的部分由队列保留到下一次刷新。
+type usageBuffer interface {
+	empty() bool
+	flush() error
+	metrics() interface{}
+}
+
+type namedBuffer struct {
+	name   string
+	buffer usageBuffer
+}
+
+// UsageRecorder 在内存中合并模板的使用次数，定期通过一条 UPDATE … FROM (VALUES …) 批量写入，不在请求中同步写库。
+// 其他写入队列（如生成记录、使用统计）通过 register 注册后随每次刷新一起写入。
+// 写入失败的计数会保留到下一次刷新；Close 时写入剩余的部分。
+type UsageRecorder struct {
+	repo     repository.TemplateRepository
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]int
+	metrics UsageRecorderMetrics
+	buffers []namedBuffer
+
+	// flushMu 保证同一时间只有一次刷新
+	flushMu  sync.Mutex
+	trigger  chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	// started 记录 Start 是否已调用，未启动时 Close 不等待后台刷新
+	started atomic.Bool
+}
+
+// NewUsageRecorder 创建使用次数记录器，需调用 Start 启动后台刷新
+func NewUsageRecorder(repo repository.TemplateRepository, interval time.Duration) *UsageRecorder {
+	if interval <= 0 {
+		interval = defaultUsageFlushInterval
+	}
+	return &UsageRecorder{
+		repo:     repo,
+		interval: interval,
+		pending:  make(map[uuid.UUID]int),
+		trigger:  make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// UsageFlushIntervalFromEnv 从 USAGE_FLUSH_INTERVAL 读取刷新间隔（如 5s）
+func UsageFlushIntervalFromEnv() (time.Duration, error) {
+	value := strings.TrimSpace(os.Getenv("USAGE_FLUSH_INTERVAL"))
+	if value == "" {
+		return defaultUsageFlushInterval, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid USAGE_FLUSH_INTERVAL: %q", value)
+	}
+	return interval, nil
+}
+
+// Start 启动后台定时刷新，重复调用时只启动一次
+func (r *UsageRecorder) Start() {
+	if r.started.Swap(true) {
+		return
+	}
+	go func() {
+		defer close(r.done)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-r.trigger:
+			case <-r.stop:
+				return
+			}
+			r.Flush()
+		}
+	}()
+}
+
+// register 注册随每次刷新（包括 Close）一起写入的队列
+func (r *UsageRecorder) register(name string, buffer usageBuffer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buffers = append(r.buffers, namedBuffer{name: name, buffer: buffer})
+}
+
+// Add 记录模板使用了 n 次，只修改内存中的计数
+func (r *UsageRecorder) Add(templateID uuid.UUID, n int) {
+	if r == nil || n <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.pending[templateID] += n
+	r.metrics.RecordedIncrements += int64(n)
+	full := len(r.pending) >= usageFlushThreshold
+	r.mu.Unlock()
+
+	if full {
+		r.triggerFlush()
+	}
+}
+
+// triggerFlush 通知后台立即刷新，已有待处理的通知时不重复发送
+func (r *UsageRecorder) triggerFlush() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Flush 将当前累计的计数和注册的队列写入数据库，失败的部分放回待写入队列
+func (r *UsageRecorder) Flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = make(map[uuid.UUID]int)
+	buffers := r.buffers
+	r.mu.Unlock()
+	if len(batch) == 0 && buffersEmpty(buffers) {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(batch))
+	for id := range batch {
+		ids = append(ids, id)
+	}
+
+	start := time.Now()
+	var flushed int64
+	var flushErr error
+	for len(ids) > 0 && flushErr == nil {
+		n := len(ids)
+		if n > usageFlushBatchSize {
+			n = usageFlushBatchSize
+		}
+		chunk := make(map[uuid.UUID]int, n)
+		for _, id := range ids[:n] {
+			chunk[id] = batch[id]
+		}
+		if flushErr = r.repo.IncrementUsage(chunk); flushErr == nil {
+			for id, count := range chunk {
+				flushed += int64(count)
+				delete(batch, id)
+			}
+			ids = ids[n:]
+		}
+	}
+
+	var buffersErr error
+	for _, b := range buffers {
+		if err := b.buffer.flush(); err != nil {
+			log.Printf("failed to flush %s: %v", b.name, err)
+			buffersErr = errors.Join(buffersErr, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.metrics.Flushes++
+	r.metrics.FlushedIncrements += flushed
+	r.metrics.LastFlushAt = &now
+	r.metrics.LastFlushDurationMs = now.Sub(start).Milliseconds()
+	if flushErr != nil {
+		// 未写入的计数（失败的和未执行的分批）放回队列，等待下次刷新
+		for id, n := range batch {
+			r.pending[id] += n
+		}
+		log.Printf("failed to flush usage counts: %v", flushErr)
+	}
+	if err := errors.Join(flushErr, buffersErr); err != nil {
+		r.metrics.FailedFlushes++
+		r.metrics.LastFlushFailed = true
+		return err
+	}
+	r.metrics.LastFlushFailed = false
+	return nil
+}
+
+// Close 停止后台刷新并写入剩余的计数和注册的队列，ctx 到期时返回而不再等待。
+// 未调用 Start（如启动中途失败）时直接写入剩余部分。
+func (r *UsageRecorder) Close(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	if r.started.Load() {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	result := make(chan error, 1)
+	go func() { result <- r.Flush() }()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Metrics 返回当前的运行指标
+func (r *UsageRecorder) Metrics() UsageRecorderMetrics {
+	r.mu.Lock()
+	metrics := r.metrics
+	metrics.PendingTemplates = len(r.pending)
+	for _, n := range r.pending {
+		metrics.PendingIncrements += int64(n)
+	}
+	buffers := r.buffers
+	r.mu.Unlock()
+
+	if len(buffers) > 0 {
+		metrics.Buffers = make(map[string]interface{}, len(buffers))
+		for _, b := range buffers {
+			metrics.Buffers[b.name] = b.buffer.metrics()
+		}
+	}
+	return metrics
+}
+
+func buffersEmpty(buffers []namedBuffer) bool {
+	for _, b := range buffers {
+		if !b.buffer.empty() {
+			return false
+		}
+	}
+	return true
+}
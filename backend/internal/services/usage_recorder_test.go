@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 测试中的刷新间隔足够长，刷新只由测试显式触发
+const testFlushInterval = time.Hour
+
+func TestUsageRecorderRequeuesFailedFlush(t *testing.T) {
+	counts := &fakeUsageCounts{failures: failures{failOn: map[int]bool{1: true}}}
+	r := NewUsageRecorder(counts, testFlushInterval)
+
+	a, b := uuid.New(), uuid.New()
+	r.Add(a, 2)
+	r.Add(b, 1)
+
+	if err := r.Flush(); err == nil {
+		t.Fatal("first flush succeeded, want the injected error")
+	}
+	m := r.Metrics()
+	if m.PendingIncrements != 3 || m.PendingTemplates != 2 || m.FlushedIncrements != 0 || !m.LastFlushFailed {
+		t.Fatalf("after failed flush: %+v", m)
+	}
+
+	// 失败后新增的计数与放回的计数合并
+	r.Add(a, 1)
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("second flush: %v", err)
+	}
+	if counts.counts[a] != 3 || counts.counts[b] != 1 {
+		t.Errorf("usage counts = %v, want a=3 b=1", counts.counts)
+	}
+
+	m = r.Metrics()
+	if m.PendingIncrements != 0 || m.PendingTemplates != 0 {
+		t.Errorf("pending after retry: %+v", m)
+	}
+	if m.RecordedIncrements != 4 || m.FlushedIncrements != 4 {
+		t.Errorf("recorded=%d flushed=%d, want 4/4", m.RecordedIncrements, m.FlushedIncrements)
+	}
+	if m.Flushes != 2 || m.FailedFlushes != 1 || m.LastFlushFailed {
+		t.Errorf("flushes=%d failed=%d last failed=%v", m.Flushes, m.FailedFlushes, m.LastFlushFailed)
+	}
+}
+
+func TestUsageRecorderPartialFlush(t *testing.T) {
+	// 第二个分批失败：第一个分批已写入，不能在重试时再写一次
+	counts := &fakeUsageCounts{failures: failures{failOn: map[int]bool{2: true}}}
+	r := NewUsageRecorder(counts, testFlushInterval)
+
+	ids := make([]uuid.UUID, usageFlushBatchSize+10)
+	for i := range ids {
+		ids[i] = uuid.New()
+		r.Add(ids[i], i%3+1)
+	}
+	want := r.Metrics().RecordedIncrements
+
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the injected error")
+	}
+	m := r.Metrics()
+	if m.PendingTemplates != 10 || m.FlushedIncrements+m.PendingIncrements != want {
+		t.Fatalf("after partial flush: pending templates=%d flushed=%d pending=%d, want 10 pending templates and %d in total",
+			m.PendingTemplates, m.FlushedIncrements, m.PendingIncrements, want)
+	}
+
+	if err := r.Flush(); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	for i, id := range ids {
+		if counts.counts[id] != i%3+1 {
+			t.Fatalf("template %d counted %d times, want %d", i, counts.counts[id], i%3+1)
+		}
+	}
+	if m := r.Metrics(); m.FlushedIncrements != want || m.PendingIncrements != 0 {
+		t.Errorf("flushed=%d pending=%d, want %d/0", m.FlushedIncrements, m.PendingIncrements, want)
+	}
+}
+
+func TestUsageRecorderCloseDrains(t *testing.T) {
+	counts := &fakeUsageCounts{failures: failures{failOn: map[int]bool{1: true}}}
+	r := NewUsageRecorder(counts, testFlushInterval)
+	r.Start()
+
+	id := uuid.New()
+	r.Add(id, 5)
+	// 后台刷新失败一次，剩余部分由 Close 写入
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the injected error")
+	}
+	r.Add(id, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if counts.counts[id] != 6 {
+		t.Errorf("usage count = %d, want 6", counts.counts[id])
+	}
+	if m := r.Metrics(); m.PendingIncrements != 0 {
+		t.Errorf("pending after Close: %+v", m)
+	}
+
+	// 重复 Close 不再写入
+	if err := r.Close(ctx); err != nil || counts.counts[id] != 6 {
+		t.Errorf("second Close: err=%v count=%d", err, counts.counts[id])
+	}
+}
+
+func TestUsageRecorderCloseFailure(t *testing.T) {
+	counts := &fakeUsageCounts{failures: failures{failOn: map[int]bool{1: true}}}
+	r := NewUsageRecorder(counts, testFlushInterval)
+	r.Start()
+
+	id := uuid.New()
+	r.Add(id, 2)
+	if err := r.Close(context.Background()); err == nil {
+		t.Fatal("Close succeeded, want the injected error")
+	}
+	// 写入失败的计数保留在内存中，可以通过 Metrics 报告丢失的数量
+	if m := r.Metrics(); m.PendingIncrements != 2 {
+		t.Errorf("pending = %d, want 2", m.PendingIncrements)
+	}
+}
+
+func TestUsageRecorderCloseWithoutStart(t *testing.T) {
+	counts := &fakeUsageCounts{}
+	r := NewUsageRecorder(counts, testFlushInterval)
+
+	id := uuid.New()
+	r.Add(id, 3)
+	// 未启动后台刷新时 Close 直接写入，而不是等到 ctx 到期
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := r.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if counts.counts[id] != 3 {
+		t.Errorf("usage count = %d, want 3", counts.counts[id])
+	}
+}
+
+// fakeBuffer 记录 flush 调用次数的队列
+type fakeBuffer struct {
+	failures
+	pending int
+	written int
+}
+
+func (b *fakeBuffer) empty() bool { return b.pending == 0 }
+
+func (b *fakeBuffer) flush() error {
+	if err := b.next(); err != nil {
+		return err
+	}
+	b.written += b.pending
+	b.pending = 0
+	return nil
+}
+
+func (b *fakeBuffer) metrics() interface{} { return b.pending }
+
+func TestUsageRecorderFlushesRegisteredBuffers(t *testing.T) {
+	counts := &fakeUsageCounts{}
+	r := NewUsageRecorder(counts, testFlushInterval)
+	buffer := &fakeBuffer{failures: failures{failOn: map[int]bool{1: true}}}
+	r.register("fake", buffer)
+
+	// 只有注册的队列中有数据时同样需要刷新，队列失败计入刷新失败
+	buffer.pending = 2
+	if err := r.Flush(); err == nil {
+		t.Fatal("flush succeeded, want the buffer's error")
+	}
+	if m := r.Metrics(); m.FailedFlushes != 1 || !m.LastFlushFailed || m.Buffers["fake"] != 2 {
+		t.Fatalf("after failed flush: %+v", m)
+	}
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if buffer.written != 2 {
+		t.Errorf("buffer wrote %d items, want 2", buffer.written)
+	}
+	if m := r.Metrics(); m.Flushes != 2 || m.LastFlushFailed || m.Buffers["fake"] != 0 {
+		t.Errorf("after Close: %+v", m)
+	}
+}
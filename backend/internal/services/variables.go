@@ -0,0 +1,117 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"prompt-backend/internal/models"
+)
+
+// resolveVariables 根据模板声明的变量补全默认值，并校验必填项及类型规则。
+//   - declared 为模板声明的变量定义；
+//   - compiled 为编译后的模板，其中引用了但未声明的变量：在块外直接输出的视为必填，
+//     仅在 {{#if}}/{{#each}} 等块中使用的视为可选；
+//   - strict 为 true 时，传入未声明也未被引用的变量会被拒绝。
+//
+// 返回的 map 包含所有被引用或声明的变量，缺省的可选变量取空字符串，
+// 保证渲染时不会出现 "<no value>"。
+func resolveVariables(declared []models.TemplateVariable, compiled *compiledTemplate, provided map[string]string, strict bool) (map[string]string, error) {
+	referenced := compiled.variables
+	values := make(map[string]string, len(declared)+len(referenced))
+	known := make(map[string]bool, len(declared)+len(referenced))
+	var errs models.VariableErrors
+
+	for _, variable := range declared {
+		known[variable.Name] = true
+		value, ok := provided[variable.Name]
+		if !ok || value == "" {
+			value = variable.DefaultValue
+		}
+		if value == "" && variable.Required {
+			errs = append(errs, missingVariable(variable.Name))
+			continue
+		}
+		if value != "" {
+			if verr := variable.ValidateValue(value); verr != nil {
+				errs = append(errs, *verr)
+				continue
+			}
+		}
+		values[variable.Name] = value
+	}
+
+	for _, name := range referenced {
+		if known[name] {
+			continue
+		}
+		known[name] = true
+		value := provided[name]
+		if value == "" && compiled.outputs[name] {
+			errs = append(errs, missingVariable(name))
+			continue
+		}
+		values[name] = value
+	}
+
+	unknown := make([]string, 0)
+	for name, value := range provided {
+		if known[name] {
+			continue
+		}
+		if !strict {
+			// 非严格模式下保留额外的变量，兼容未声明变量的旧模板
+			values[name] = value
+			continue
+		}
+		unknown = append(unknown, name)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			errs = append(errs, models.VariableError{
+				Variable: name,
+				Code:     models.VariableErrorUnknown,
+				Message:  fmt.Sprintf("variable %s is not declared by the template", name),
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return values, nil
+}
+
+func missingVariable(name string) models.VariableError {
+	return models.VariableError{
+		Variable: name,
+		Code:     models.VariableErrorRequired,
+		Message:  fmt.Sprintf("variable %s is required", name),
+	}
+}
+
+// buildRenderData 将字符串取值转换为渲染所需的类型：
+// 布尔变量转为 bool（输出为 true/false），列表变量和被 {{#each}} 遍历的变量转为 []string。
+// 条件的真假由 truthy 统一判断。
+func buildRenderData(values map[string]string, declared []models.TemplateVariable, compiled *compiledTemplate) map[string]interface{} {
+	types := make(map[string]string, len(declared))
+	for _, variable := range declared {
+		types[variable.Name] = variable.EffectiveType()
+	}
+
+	data := make(map[string]interface{}, len(values))
+	for name, value := range values {
+		switch {
+		case types[name] == models.VariableTypeArray || compiled.lists[name]:
+			data[name] = models.ParseListValue(value)
+		case types[name] == models.VariableTypeBoolean:
+			b, _ := strconv.ParseBool(strings.TrimSpace(value))
+			data[name] = b
+		default:
+			data[name] = value
+		}
+	}
+	return data
+}
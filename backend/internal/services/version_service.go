@@ -0,0 +1,107 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrVersionNotFound = errors.New("template version not found")
+
+// GetTemplateVersions 获取模板的版本历史
+func (s *TemplateService) GetTemplateVersions(id uuid.UUID, page, pageSize int, viewer *auth.Identity) ([]models.PromptTemplateVersion, error) {
+	if _, err := s.GetTemplate(id, viewer); err != nil {
+		return nil, err
+	}
+	limit := pageSize
+	offset := (page - 1) * pageSize
+	return s.repo.GetVersions(id, limit, offset)
+}
+
+// GetTemplateVersion 获取模板的指定版本
+func (s *TemplateService) GetTemplateVersion(id uuid.UUID, version int, viewer *auth.Identity) (*models.PromptTemplateVersion, error) {
+	if _, err := s.GetTemplate(id, viewer); err != nil {
+		return nil, err
+	}
+	return s.getVersion(id, version)
+}
+
+// RestoreTemplateVersion 将模板回滚到指定版本。
+// 回滚不会删除历史，而是以该版本的内容生成一个新版本。
+func (s *TemplateService) RestoreTemplateVersion(id uuid.UUID, version int, caller *auth.Identity) (*models.PromptTemplate, error) {
+	tmpl, err := s.getTemplate(id)
+	if err != nil {
+		return nil, err
+	}
+	if !canModify(tmpl, caller) {
+		return nil, ErrForbidden
+	}
+
+	snapshot, err := s.getVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// 快照按更新的规则重新校验：保存时有效的内容现在可能已无效（如引用的 partial 已改为私有）
+	req, err := restoreRequest(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	if err := s.applyUpdate(tmpl, req, caller); err != nil {
+		return nil, err
+	}
+
+	if err := s.saveTemplate(tmpl, caller); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// restoreRequest 将版本快照转换为更新请求，与普通更新走同一套校验
+func restoreRequest(snapshot *models.PromptTemplateVersion) (models.UpdateTemplateRequest, error) {
+	variables, err := parseVariables(snapshot.Variables)
+	if err != nil {
+		return models.UpdateTemplateRequest{}, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	if variables == nil {
+		variables = []models.TemplateVariable{}
+	}
+	kind := snapshot.Kind
+	if kind == "" {
+		kind = models.TemplateKindText
+	}
+	req := models.UpdateTemplateRequest{
+		Name:        &snapshot.Name,
+		Description: &snapshot.Description,
+		Variables:   variables,
+		Category:    &snapshot.Category,
+		Kind:        &kind,
+	}
+	if kind == models.TemplateKindChat {
+		req.Messages = snapshot.Messages
+	} else {
+		req.Content = &snapshot.Content
+	}
+	return req, nil
+}
+
+// getVersion 获取版本快照，未找到时返回 ErrVersionNotFound
+func (s *TemplateService) getVersion(id uuid.UUID, version int) (*models.PromptTemplateVersion, error) {
+	snapshot, err := s.repo.GetVersion(id, version)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, err
+	}
+	return snapshot, nil
+}
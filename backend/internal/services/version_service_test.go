@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"prompt-backend/internal/auth"
+	"prompt-backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRestoreTemplateVersionValidatesSnapshot(t *testing.T) {
+	owner := &auth.Identity{UserID: uuid.New(), Role: models.RoleUser}
+	repo := &fakeTemplateRepo{}
+	// 版本 1 保存时 footer 还是公开的，之后被改为私有
+	repo.add(&models.PromptTemplate{UserID: owner.UserID, Slug: strPtr("footer"), Content: "private footer"})
+	tmpl := repo.add(&models.PromptTemplate{UserID: owner.UserID, Name: "current", Content: "Hello {{name}}", IsPublic: true, Version: 5})
+	repo.versions = append(repo.versions,
+		&models.PromptTemplateVersion{TemplateID: tmpl.ID, Version: 1, Name: "with partial", Content: "{{> template:footer}}", Variables: models.JSONB(`[]`)},
+		&models.PromptTemplateVersion{TemplateID: tmpl.ID, Version: 2, Name: "bad rule", Content: "{{n}}", Variables: models.JSONB(`[{"name":"n","type":"integer","min":10,"max":1}]`)},
+		&models.PromptTemplateVersion{TemplateID: tmpl.ID, Version: 3, Name: "bad variables", Content: "{{n}}", Variables: models.JSONB(`{"n":1}`)},
+		&models.PromptTemplateVersion{TemplateID: tmpl.ID, Version: 4, Name: "valid", Content: "Hi {{name}}", Variables: models.JSONB(`[{"name":"name","default_value":"there"}]`)},
+	)
+	s := NewTemplateService(repo, nil, nil, nil)
+
+	tests := []struct {
+		version int
+		errPart string
+	}{
+		{1, "is private"},
+		{2, "min cannot be greater than max"},
+		{3, "invalid template variables"},
+		{4, ""},
+	}
+	for _, tt := range tests {
+		t.Run(repo.versions[tt.version-1].Name, func(t *testing.T) {
+			restored, err := s.RestoreTemplateVersion(tmpl.ID, tt.version, owner)
+			current, _ := repo.GetByID(tmpl.ID)
+			if tt.errPart != "" {
+				if !errors.Is(err, ErrInvalidTemplate) || !strings.Contains(err.Error(), tt.errPart) {
+					t.Fatalf("err = %v, want ErrInvalidTemplate containing %q", err, tt.errPart)
+				}
+				if current.Name != "current" {
+					t.Errorf("template saved as %q despite the invalid snapshot", current.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RestoreTemplateVersion: %v", err)
+			}
+			if restored.Content != "Hi {{name}}" || current.Name != "valid" || current.Version != 6 {
+				t.Errorf("restored %+v, stored %+v", restored, current)
+			}
+			prepared, err := s.prepareTemplate(tmpl.ID, nil, owner)
+			if err != nil {
+				t.Fatalf("prepareTemplate: %v", err)
+			}
+			if resp, err := prepared.render(nil, false); err != nil || resp.Prompt != "Hi there" {
+				t.Errorf("render = %v, %v; want the restored default", resp, err)
+			}
+		})
+	}
+}
@@ -30,7 +30,10 @@ export default function GeneratePage() {
 
     if (!Array.isArray(template.variables) || template.variables.length === 0) {
       try {
-        const response = await templateAPI.extractVariables(template.content);
+        const response = await templateAPI.extractVariables(
+          template.content,
+          template.kind === 'chat' ? template.messages : undefined
+        );
         const extracted = (response.variables || []).map((name, index) => ({
           name,
           display_name: name,
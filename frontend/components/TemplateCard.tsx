@@ -50,6 +50,15 @@ export default function TemplateCard({ template, onSelect, onEdit, onDelete }: T
         </div>
       </div>
       <p className="text-gray-600 text-sm mb-3 line-clamp-2">{template.description}</p>
+      {template.tags && template.tags.length > 0 && (
+        <div className="flex flex-wrap gap-1 mb-3">
+          {template.tags.map((tag) => (
+            <span key={tag} className="px-2 py-0.5 bg-blue-50 text-blue-700 text-xs rounded">
+              #{tag}
+            </span>
+          ))}
+        </div>
+      )}
       <div className="flex items-center justify-between text-xs text-gray-500">
         <span>使用次数: {template.usage_count}</span>
         {template.is_public && (
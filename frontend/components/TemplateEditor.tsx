@@ -1,7 +1,16 @@
 'use client';
 
 import { useEffect, useState } from 'react';
-import { CreateTemplateRequest, Template, TemplateVariable, templateAPI } from '@/lib/api';
+import {
+  ChatMessage,
+  ChatRole,
+  CreateTemplateRequest,
+  Template,
+  TemplateKind,
+  TemplateVariable,
+  VariableType,
+  templateAPI,
+} from '@/lib/api';
 
 interface TemplateEditorProps {
   template?: Template | null;
@@ -22,8 +31,13 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
   const [name, setName] = useState('');
   const [description, setDescription] = useState('');
   const [category, setCategory] = useState('');
+  const [tags, setTags] = useState('');
+  const [slug, setSlug] = useState('');
   const [isPublic, setIsPublic] = useState(false);
+  const [redactRuns, setRedactRuns] = useState(false);
   const [content, setContent] = useState('');
+  const [kind, setKind] = useState<TemplateKind>('text');
+  const [messages, setMessages] = useState<ChatMessage[]>([]);
   const [variables, setVariables] = useState<TemplateVariable[]>([]);
   const [saving, setSaving] = useState(false);
   const [extracting, setExtracting] = useState(false);
@@ -32,8 +46,13 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
     setName(template?.name || '');
     setDescription(template?.description || '');
     setCategory(template?.category || '');
+    setTags((template?.tags || []).join(', '));
+    setSlug(template?.slug || '');
     setIsPublic(Boolean(template?.is_public));
+    setRedactRuns(Boolean(template?.redact_runs));
     setContent(template?.content || '');
+    setKind(template?.kind || 'text');
+    setMessages(template?.messages || []);
     setVariables(template?.variables || []);
   }, [template]);
 
@@ -53,12 +72,34 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
     });
   };
 
+  const isChat = kind === 'chat';
+  const hasBody = isChat ? messages.some((message) => message.content.trim()) : Boolean(content.trim());
+
+  const handleKindChange = (value: TemplateKind) => {
+    setKind(value);
+    if (value === 'chat' && messages.length === 0) {
+      setMessages([{ role: 'user', content }]);
+    }
+  };
+
+  const handleMessageChange = (index: number, patch: Partial<ChatMessage>) => {
+    setMessages((prev) => prev.map((message, i) => (i === index ? { ...message, ...patch } : message)));
+  };
+
+  const handleAddMessage = () => {
+    setMessages((prev) => [...prev, { role: 'user', content: '' }]);
+  };
+
+  const handleRemoveMessage = (index: number) => {
+    setMessages((prev) => prev.filter((_, i) => i !== index));
+  };
+
   const handleExtractVariables = async () => {
-    if (!content.trim()) return;
+    if (!hasBody) return;
 
     setExtracting(true);
     try {
-      const response = await templateAPI.extractVariables(content);
+      const response = await templateAPI.extractVariables(content, isChat ? messages : undefined);
       const extracted = response.variables || [];
 
       setVariables((prev) => {
@@ -84,7 +125,7 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
   };
 
   const handleSave = async () => {
-    if (!name.trim() || !content.trim()) {
+    if (!name.trim() || !hasBody) {
       alert('请填写模板名称和模板内容');
       return;
     }
@@ -97,6 +138,10 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
         display_name: (variable.display_name || variable.name).trim(),
         sort_order: index,
         required: variable.required ?? true,
+        options:
+          variable.type === 'enum'
+            ? (variable.options || []).map((option) => option.trim()).filter((option) => option !== '')
+            : undefined,
       }));
 
     // 客户端校验变量名，确保符合后端要求：^[a-zA-Z_][a-zA-Z0-9_]*$
@@ -111,10 +156,15 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
     const payload: CreateTemplateRequest = {
       name: name.trim(),
       description: description.trim(),
-      content,
+      content: isChat ? undefined : content,
+      kind,
+      messages: isChat ? messages.filter((message) => message.content.trim()) : undefined,
       variables: sanitizedVariables,
       category: category.trim(),
+      tags: tags.split(/[,，]/).map((tag) => tag.trim()).filter(Boolean),
       is_public: isPublic,
+      redact_runs: redactRuns,
+      slug: slug.trim(),
     };
 
     setSaving(true);
@@ -177,6 +227,28 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
         </div>
       </div>
 
+      <div>
+        <label className="block text-sm font-medium text-gray-700 mb-2">标签（可选）</label>
+        <input
+          type="text"
+          value={tags}
+          onChange={(event) => setTags(event.target.value)}
+          className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+          placeholder="多个标签以逗号分隔，例如：邮件, 英文"
+        />
+      </div>
+
+      <div>
+        <label className="block text-sm font-medium text-gray-700 mb-2">别名（可选）</label>
+        <input
+          type="text"
+          value={slug}
+          onChange={(event) => setSlug(event.target.value)}
+          className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500"
+          placeholder="例如：json-output-format，其他模板可通过 {{> template:json-output-format}} 引用"
+        />
+      </div>
+
       <div>
         <label className="block text-sm font-medium text-gray-700 mb-2">模板描述</label>
         <textarea
@@ -190,22 +262,71 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
 
       <div>
         <div className="flex items-center justify-between mb-2">
-          <label className="block text-sm font-medium text-gray-700">模板内容</label>
+          <div className="flex items-center gap-3">
+            <label className="block text-sm font-medium text-gray-700">模板内容</label>
+            <select
+              value={kind}
+              onChange={(event) => handleKindChange(event.target.value as TemplateKind)}
+              className="px-2 py-1 text-sm border border-gray-300 rounded"
+            >
+              <option value="text">普通文本</option>
+              <option value="chat">对话消息</option>
+            </select>
+          </div>
           <button
             onClick={handleExtractVariables}
-            disabled={extracting || !content.trim()}
+            disabled={extracting || !hasBody}
             className="px-3 py-1 text-sm bg-gray-100 rounded hover:bg-gray-200 disabled:opacity-50"
           >
             {extracting ? '提取中...' : '从内容提取变量'}
           </button>
         </div>
-        <textarea
-          value={content}
-          onChange={(event) => setContent(event.target.value)}
-          rows={8}
-          className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 font-mono text-sm"
-          placeholder="在这里输入模板内容，例如：请总结 {{topic}} 的核心观点"
-        />
+        {isChat ? (
+          <div className="space-y-3">
+            {messages.map((message, index) => (
+              <div key={index} className="border border-gray-200 rounded-lg p-3">
+                <div className="flex items-center justify-between mb-2">
+                  <select
+                    value={message.role}
+                    onChange={(event) => handleMessageChange(index, { role: event.target.value as ChatRole })}
+                    className="px-2 py-1 text-sm border border-gray-300 rounded"
+                  >
+                    <option value="system">system</option>
+                    <option value="user">user</option>
+                    <option value="assistant">assistant</option>
+                  </select>
+                  <button
+                    onClick={() => handleRemoveMessage(index)}
+                    className="text-sm text-red-600 hover:text-red-700"
+                  >
+                    删除
+                  </button>
+                </div>
+                <textarea
+                  value={message.content}
+                  onChange={(event) => handleMessageChange(index, { content: event.target.value })}
+                  rows={4}
+                  className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 font-mono text-sm"
+                  placeholder="消息内容，可使用 {{variable}} 等模板语法"
+                />
+              </div>
+            ))}
+            <button
+              onClick={handleAddMessage}
+              className="px-3 py-1 text-sm bg-gray-100 rounded hover:bg-gray-200"
+            >
+              添加消息
+            </button>
+          </div>
+        ) : (
+          <textarea
+            value={content}
+            onChange={(event) => setContent(event.target.value)}
+            rows={8}
+            className="w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 font-mono text-sm"
+            placeholder="在这里输入模板内容，例如：请总结 {{topic}} 的核心观点"
+          />
+        )}
         <label className="flex items-center gap-2 mt-3 text-sm text-gray-600">
           <input
             type="checkbox"
@@ -215,6 +336,15 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
           />
           公开模板
         </label>
+        <label className="flex items-center gap-2 mt-2 text-sm text-gray-600">
+          <input
+            type="checkbox"
+            checked={redactRuns}
+            onChange={(event) => setRedactRuns(event.target.checked)}
+            className="rounded border-gray-300"
+          />
+          生成记录中不保存变量值和输出
+        </label>
       </div>
 
       <div>
@@ -264,6 +394,38 @@ export default function TemplateEditor({ template, onCancel, onSaved }: Template
                       placeholder="可选"
                     />
                   </div>
+                  <div>
+                    <label className="block text-xs text-gray-600 mb-1">类型</label>
+                    <select
+                      value={variable.type || 'string'}
+                      onChange={(event) => handleVariableChange(index, { type: event.target.value as VariableType })}
+                      className="w-full px-2 py-1 border border-gray-300 rounded"
+                    >
+                      <option value="string">单行文本</option>
+                      <option value="text">多行文本</option>
+                      <option value="number">数字</option>
+                      <option value="integer">整数</option>
+                      <option value="boolean">布尔</option>
+                      <option value="enum">枚举</option>
+                      <option value="date">日期</option>
+                      <option value="json">JSON</option>
+                      <option value="array">列表</option>
+                    </select>
+                  </div>
+                  {variable.type === 'enum' && (
+                    <div>
+                      <label className="block text-xs text-gray-600 mb-1">可选值（逗号分隔）</label>
+                      <input
+                        type="text"
+                        value={(variable.options || []).join(',')}
+                        onChange={(event) =>
+                          handleVariableChange(index, { options: event.target.value.split(',') })
+                        }
+                        className="w-full px-2 py-1 border border-gray-300 rounded"
+                        placeholder="例如：正式,友好,简洁"
+                      />
+                    </div>
+                  )}
                   <div>
                     <label className="block text-xs text-gray-600 mb-1">说明</label>
                     <input
@@ -8,6 +8,82 @@ interface VariableInputsProps {
   onChange: (name: string, value: string) => void;
 }
 
+const inputClassName =
+  'w-full px-3 py-2 border border-gray-300 rounded-lg focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent';
+
+// 根据变量类型渲染输入控件，未声明类型（或为 string）时返回 null，由旧的规则处理
+function renderTypedInput(
+  variable: TemplateVariable,
+  inputId: string,
+  value: string,
+  onChange: (name: string, value: string) => void
+) {
+  switch (variable.type) {
+    case 'text':
+    case 'json':
+    case 'array':
+      return (
+        <textarea
+          id={inputId}
+          value={value}
+          onChange={(e) => onChange(variable.name, e.target.value)}
+          rows={6}
+          maxLength={variable.max_length}
+          className={`${inputClassName} ${variable.type === 'json' ? 'font-mono text-sm' : ''}`}
+          placeholder={
+            variable.default_value ||
+            (variable.type === 'array' ? '每行一项，或输入 JSON 数组' : `请输入${variable.display_name}...`)
+          }
+        />
+      );
+    case 'number':
+    case 'integer':
+      return (
+        <input
+          id={inputId}
+          type="number"
+          value={value}
+          min={variable.min}
+          max={variable.max}
+          step={variable.type === 'integer' ? 1 : 'any'}
+          onChange={(e) => onChange(variable.name, e.target.value)}
+          className={inputClassName}
+        />
+      );
+    case 'boolean':
+      return (
+        <select id={inputId} value={value} onChange={(e) => onChange(variable.name, e.target.value)} className={inputClassName}>
+          <option value="">请选择...</option>
+          <option value="true">是</option>
+          <option value="false">否</option>
+        </select>
+      );
+    case 'enum':
+      return (
+        <select id={inputId} value={value} onChange={(e) => onChange(variable.name, e.target.value)} className={inputClassName}>
+          <option value="">请选择...</option>
+          {(variable.options || []).map((option) => (
+            <option key={option} value={option}>
+              {option}
+            </option>
+          ))}
+        </select>
+      );
+    case 'date':
+      return (
+        <input
+          id={inputId}
+          type="date"
+          value={value}
+          onChange={(e) => onChange(variable.name, e.target.value)}
+          className={inputClassName}
+        />
+      );
+    default:
+      return null;
+  }
+}
+
 export default function VariableInputs({ variables, values, onChange }: VariableInputsProps) {
   return (
     <div className="space-y-4">
@@ -26,7 +102,9 @@ export default function VariableInputs({ variables, values, onChange }: Variable
               {variable.description && (
                 <p className="text-xs text-gray-500 mb-2">{variable.description}</p>
               )}
-              {variable.name === 'tone' || variable.name === 'type' || variable.name === 'length' ? (
+              {variable.type && variable.type !== 'string' ? (
+                renderTypedInput(variable, inputId, values[variable.name] || variable.default_value || '', onChange)
+              ) : variable.name === 'tone' || variable.name === 'type' || variable.name === 'length' ? (
                 <select
                   id={inputId}
                   value={values[variable.name] || variable.default_value || ''}
@@ -14,9 +14,30 @@ const api = axios.create({
   },
 });
 
-// 请求拦截器
+const TOKEN_STORAGE_KEY = 'auth_token';
+
+export const getAuthToken = (): string | null => {
+  if (typeof window === 'undefined') return null;
+  return window.localStorage.getItem(TOKEN_STORAGE_KEY);
+};
+
+export const setAuthToken = (token: string | null) => {
+  if (typeof window === 'undefined') return;
+  if (token) {
+    window.localStorage.setItem(TOKEN_STORAGE_KEY, token);
+  } else {
+    window.localStorage.removeItem(TOKEN_STORAGE_KEY);
+  }
+};
+
+// 请求拦截器：携带登录令牌
 api.interceptors.request.use(
   (config) => {
+    const token = getAuthToken();
+    if (token) {
+      config.headers = config.headers || {};
+      config.headers.Authorization = `Bearer ${token}`;
+    }
     return config;
   },
   (error) => {
@@ -44,6 +65,16 @@ api.interceptors.response.use(
   }
 );
 
+export type TemplateKind = 'text' | 'chat';
+
+export type ChatRole = 'system' | 'user' | 'assistant';
+
+// 与 OpenAI 兼容 chat 接口的消息结构一致
+export interface ChatMessage {
+  role: ChatRole;
+  content: string;
+}
+
 export interface Template {
   id: string;
   user_id: string;
@@ -51,9 +82,15 @@ export interface Template {
   description: string;
   content: string;
   variables: TemplateVariable[];
+  kind?: TemplateKind;
+  messages?: ChatMessage[];
   category: string;
   is_public: boolean;
+  slug?: string;
+  redact_runs?: boolean;
   usage_count: number;
+  version: number;
+  tags?: string[];
   created_at: string;
   updated_at: string;
 }
@@ -62,6 +99,14 @@ type RawTemplate = Omit<Template, 'variables'> & {
   variables?: unknown;
 };
 
+// 检索结果，snippet 已做 HTML 转义，命中词以 <mark> 标出
+export interface TemplateSearchResult extends Template {
+  rank: number;
+  snippet: string;
+}
+
+export type VariableType = 'string' | 'text' | 'number' | 'integer' | 'boolean' | 'enum' | 'date' | 'json' | 'array';
+
 export interface TemplateVariable {
   id?: string;
   name: string;
@@ -70,25 +115,169 @@ export interface TemplateVariable {
   default_value?: string;
   required: boolean;
   sort_order?: number;
+  type?: VariableType;
+  min_length?: number;
+  max_length?: number;
+  pattern?: string;
+  options?: string[];
+  min?: number;
+  max?: number;
+}
+
+export interface VariableError {
+  variable: string;
+  code: string;
+  message: string;
 }
 
 export interface GenerateRequest {
   template_id: string;
   variables: Record<string, string>;
+  version?: number;
+  strict?: boolean;
 }
 
 export interface GenerateResponse {
   result: string;
   prompt: string;
+  messages?: ChatMessage[];
+  // 本次生成的记录 ID
+  run_id?: string;
+}
+
+export interface RunRequest extends GenerateRequest {
+  model?: string;
+  max_tokens?: number;
+  temperature?: number;
+}
+
+export interface TokenUsage {
+  prompt_tokens: number;
+  completion_tokens: number;
+  total_tokens: number;
+}
+
+// result 为模型输出，prompt/messages 为发送给模型的内容
+export interface RunResponse extends GenerateResponse {
+  model: string;
+  finish_reason?: string;
+  usage: TokenUsage;
+  latency_ms: number;
+}
+
+export type RunStreamEvent =
+  | { event: 'prompt'; data: GenerateResponse }
+  | { event: 'delta'; data: { content: string } }
+  | { event: 'done'; data: RunResponse }
+  | { event: 'error'; data: { error: string; message: string } }
+  | { event: 'ping'; data: Record<string, never> };
+
+export interface GenerationRun {
+  id: string;
+  template_id: string;
+  template_version: number;
+  user_id: string | null;
+  variables: Record<string, string>;
+  output: string;
+  redacted: boolean;
+  status: 'success' | 'error';
+  error?: string;
+  latency_ms: number;
+  created_at: string;
+}
+
+export type StatsInterval = 'hour' | 'day';
+
+export interface UsageCounts {
+  generations: number;
+  errors: number;
+  error_rate: number;
+  unique_callers: number;
+}
+
+export interface UsageBucket extends UsageCounts {
+  start: string;
+}
+
+export interface TemplateStats {
+  template_id: string;
+  interval: StatsInterval;
+  from: string;
+  to: string;
+  total: UsageCounts;
+  buckets: UsageBucket[];
+  top_values: { variable: string; value: string; uses: number }[];
+}
+
+export interface TemplateUsage extends UsageCounts {
+  template_id: string;
+  name: string;
+}
+
+export interface BatchGenerateRequest {
+  template_id: string;
+  items: Record<string, string>[];
+  version?: number;
+  strict?: boolean;
+}
+
+export interface BatchGenerateResult extends Partial<GenerateResponse> {
+  index: number;
+  error?: string;
+  errors?: VariableError[];
+}
+
+export interface BatchGenerateResponse {
+  results: BatchGenerateResult[];
+  succeeded: number;
+  failed: number;
 }
 
 export interface CreateTemplateRequest {
   name: string;
   description?: string;
-  content: string;
+  // 对话模板无需传入，由 messages 生成
+  content?: string;
   variables?: TemplateVariable[];
   category?: string;
   is_public?: boolean;
+  redact_runs?: boolean;
+  slug?: string;
+  tags?: string[];
+  kind?: TemplateKind;
+  messages?: ChatMessage[];
+}
+
+export type TagMatch = 'any' | 'all';
+
+export type TemplateSortField = 'created_at' | 'updated_at' | 'name' | 'usage_count';
+
+// 模板列表的标签筛选、排序和游标；cursor 为上一页返回的 next_cursor，需与 sort 一致
+export interface TemplateListOptions {
+  tags?: string[];
+  tagMatch?: TagMatch;
+  sort?: TemplateSortField | `${TemplateSortField}:${'asc' | 'desc'}`;
+  cursor?: string;
+}
+
+export interface TagCount {
+  name: string;
+  count: number;
+}
+
+export interface User {
+  id: string;
+  email: string;
+  display_name: string;
+  role: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface AuthResponse {
+  token: string;
+  expires_at: string;
+  user: User;
 }
 
 export interface PaginatedResponse<T> {
@@ -96,6 +285,8 @@ export interface PaginatedResponse<T> {
   page: number;
   page_size: number;
   total: number;
+  // 还有下一页时返回，可作为 cursor 参数获取下一页
+  next_cursor?: string;
 }
 
 export const templateAPI = {
@@ -105,8 +296,8 @@ export const templateAPI = {
   },
 
   // 获取模板列表
-  getTemplates: async (category?: string, page = 1, pageSize = 20): Promise<PaginatedResponse<Template>> => {
-    const params: any = { page, page_size: pageSize };
+  getTemplates: async (category?: string, page = 1, pageSize = 20, options: TemplateListOptions = {}): Promise<PaginatedResponse<Template>> => {
+    const params: any = { page, page_size: pageSize, ...listParams(options) };
     if (category) params.category = category;
     const response = await api.get('/templates', { params }) as PaginatedResponse<RawTemplate>;
     return {
@@ -115,9 +306,20 @@ export const templateAPI = {
     };
   },
 
+  // 获取当前用户的模板（需要登录）
+  getMyTemplates: async (category?: string, page = 1, pageSize = 20, options: TemplateListOptions = {}): Promise<PaginatedResponse<Template>> => {
+    const params: any = { page, page_size: pageSize, ...listParams(options) };
+    if (category) params.category = category;
+    const response = await api.get('/templates/mine', { params }) as PaginatedResponse<RawTemplate>;
+    return {
+      ...response,
+      data: normalizeTemplateList(response.data || []),
+    };
+  },
+
   // 获取公开模板
-  getPublicTemplates: async (category?: string, page = 1, pageSize = 20): Promise<PaginatedResponse<Template>> => {
-    const params: any = { page, page_size: pageSize };
+  getPublicTemplates: async (category?: string, page = 1, pageSize = 20, options: TemplateListOptions = {}): Promise<PaginatedResponse<Template>> => {
+    const params: any = { page, page_size: pageSize, ...listParams(options) };
     if (category) params.category = category;
     const response = await api.get('/templates/public', { params }) as PaginatedResponse<RawTemplate>;
     return {
@@ -126,6 +328,25 @@ export const templateAPI = {
     };
   },
 
+  // 获取标签及其模板数（标签云）
+  getTags: async (publicOnly = false, limit = 100): Promise<{ data: TagCount[] }> => {
+    const params: any = { limit };
+    if (publicOnly) params.public = true;
+    return api.get('/tags', { params });
+  },
+
+  // 全文检索模板
+  searchTemplates: async (q: string, options: { category?: string; publicOnly?: boolean; page?: number; pageSize?: number } = {}): Promise<PaginatedResponse<TemplateSearchResult>> => {
+    const params: any = { q, page: options.page ?? 1, page_size: options.pageSize ?? 20 };
+    if (options.category) params.category = options.category;
+    if (options.publicOnly) params.public = true;
+    const response = await api.get('/templates/search', { params }) as PaginatedResponse<RawTemplate & { rank: number; snippet: string }>;
+    return {
+      ...response,
+      data: (response.data || []).map((result) => ({ ...normalizeTemplate(result), rank: result.rank, snippet: result.snippet })),
+    };
+  },
+
   // 获取单个模板
   getTemplate: async (id: string): Promise<Template> => {
     const response = await api.get(`/templates/${id}`) as RawTemplate;
@@ -154,12 +375,123 @@ export const templateAPI = {
     return api.post('/generate', data);
   },
 
-  // 提取变量
-  extractVariables: async (content: string): Promise<{ variables: string[] }> => {
+  // 批量生成提示词，结果与 items 一一对应
+  generateBatch: async (data: BatchGenerateRequest): Promise<BatchGenerateResponse> => {
+    return api.post('/generate/batch', data);
+  },
+
+  // 渲染模板并调用模型（需要登录）
+  run: async (data: RunRequest): Promise<RunResponse> => {
+    return api.post('/run', data);
+  },
+
+  // 流式运行模板，逐个回调 SSE 事件；通过 signal 取消时服务端会中止对模型的请求
+  runStream: async (data: RunRequest, onEvent: (e: RunStreamEvent) => void, signal?: AbortSignal): Promise<void> => {
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    const token = getAuthToken();
+    if (token) {
+      headers.Authorization = `Bearer ${token}`;
+    }
+    const resp = await fetch(`${getBaseURL()}/run/stream`, {
+      method: 'POST',
+      headers,
+      body: JSON.stringify(data),
+      signal,
+    });
+    if (!resp.ok || !resp.body) {
+      const body = await resp.json().catch(() => null);
+      throw new Error(body?.message || body?.error || resp.statusText);
+    }
+
+    const reader = resp.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+      let sep;
+      while ((sep = buffer.indexOf('\n\n')) >= 0) {
+        const block = buffer.slice(0, sep);
+        buffer = buffer.slice(sep + 2);
+        let event = 'message';
+        const lines: string[] = [];
+        for (const line of block.split('\n')) {
+          if (line.startsWith('event:')) event = line.slice(6).trim();
+          else if (line.startsWith('data:')) lines.push(line.slice(5));
+        }
+        if (lines.length > 0) {
+          onEvent({ event, data: JSON.parse(lines.join('\n')) } as RunStreamEvent);
+        }
+      }
+    }
+  },
+
+  // 模板的生成记录（所有者可见全部，其他用户只能看到自己的调用）
+  getTemplateRuns: async (id: string, page = 1, pageSize = 20): Promise<Omit<PaginatedResponse<GenerationRun>, 'total'>> => {
+    return api.get(`/templates/${id}/runs`, { params: { page, page_size: pageSize } });
+  },
+
+  getRun: async (id: string): Promise<GenerationRun> => {
+    return api.get(`/runs/${id}`);
+  },
+
+  // 模板的使用统计（仅所有者可见），from/to 为 RFC 3339 或 YYYY-MM-DD
+  getTemplateStats: async (id: string, interval: StatsInterval = 'day', from?: string, to?: string): Promise<TemplateStats> => {
+    return api.get(`/templates/${id}/stats`, { params: { interval, from, to } });
+  },
+
+  // 生成次数最多的模板
+  getTopTemplates: async (limit = 10, from?: string, to?: string): Promise<{ data: TemplateUsage[]; from: string; to: string }> => {
+    return api.get('/stats/top', { params: { limit, from, to } });
+  },
+
+  // 提取变量，对话模板传入 messages
+  extractVariables: async (content: string, messages?: ChatMessage[]): Promise<{ variables: string[] }> => {
+    if (messages && messages.length > 0) {
+      return api.post('/generate/extract-variables', { kind: 'chat', messages });
+    }
     return api.post('/generate/extract-variables', { content });
   },
 };
 
+export const authAPI = {
+  // 注册
+  register: async (email: string, password: string, displayName?: string): Promise<AuthResponse> => {
+    const response = await api.post('/auth/register', { email, password, display_name: displayName }) as AuthResponse;
+    setAuthToken(response.token);
+    return response;
+  },
+
+  // 登录
+  login: async (email: string, password: string): Promise<AuthResponse> => {
+    const response = await api.post('/auth/login', { email, password }) as AuthResponse;
+    setAuthToken(response.token);
+    return response;
+  },
+
+  // 退出登录
+  logout: () => {
+    setAuthToken(null);
+  },
+
+  // 当前用户
+  me: async (): Promise<User> => {
+    return api.get('/auth/me');
+  },
+};
+
+const listParams = (options: TemplateListOptions) => {
+  const params: any = {};
+  if (options.tags && options.tags.length > 0) {
+    params.tags = options.tags.join(',');
+    params.tag_match = options.tagMatch || 'any';
+  }
+  if (options.sort) params.sort = options.sort;
+  if (options.cursor) params.cursor = options.cursor;
+  return params;
+};
+
 const normalizeTemplateList = (templates: RawTemplate[]): Template[] => {
   return templates.map(normalizeTemplate);
 };